@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cbergoon/diffq"
+)
+
+// newFlagSet returns a flag set for the subcommand name reporting errors to the
+// standard error of env.
+func newFlagSet(env *environment, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(env.stderr, "usage: diffq %s\n", commands[name].usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseArgs parses the flags in args returning the remaining positional
+// arguments. Unlike FlagSet.Parse flags may follow positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// loadDiff loads the documents old and new and calculates their differential.
+// The changes are sorted so that output is the same from run to run.
+func loadDiff(env *environment, args []string) (*diffq.Diff, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected two documents, got %d", len(args))
+	}
+	if args[0] == "-" && args[1] == "-" {
+		return nil, fmt.Errorf("only one document may be read from standard input")
+	}
+	a, err := loadDocument(args[0], env.stdin)
+	if err != nil {
+		return nil, err
+	}
+	b, err := loadDocument(args[1], env.stdin)
+	if err != nil {
+		return nil, err
+	}
+	d, err := diffq.Differential(a, b)
+	if err != nil {
+		return nil, err
+	}
+	sortChanges(d.Changes)
+	return d, nil
+}
+
+// sortChanges sorts cs by path, then by type. The changes of maps are returned
+// by the underlying diff library in random order.
+func sortChanges(cs diffq.Changes) {
+	sort.SliceStable(cs, func(i, j int) bool {
+		if c := comparePaths(cs[i].Path, cs[j].Path); c != 0 {
+			return c < 0
+		}
+		return cs[i].Type < cs[j].Type
+	})
+}
+
+// comparePaths compares the paths a and b component by component returning -1,
+// 0 or 1. Components that are both indices are compared as numbers.
+func comparePaths(a, b []string) int {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] == b[k] {
+			continue
+		}
+		x, errX := strconv.Atoi(a[k])
+		y, errY := strconv.Atoi(b[k])
+		if errX == nil && errY == nil {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+		if a[k] < b[k] {
+			return -1
+		}
+		return 1
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// runDiff prints the changes between two documents.
+func runDiff(env *environment, args []string) int {
+	fs := newFlagSet(env, "diff")
+	format := fs.String("format", "text", "output format: text, json, markdown or html")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+
+	d, err := loadDiff(env, args)
+	if err != nil {
+		return env.errorf("%v", err)
+	}
+
+	switch *format {
+	case "text":
+		fmt.Fprint(env.stdout, d.RenderText())
+	case "markdown":
+		fmt.Fprint(env.stdout, d.RenderMarkdown())
+	case "html":
+		fmt.Fprint(env.stdout, d.RenderHTML())
+	case "json":
+		if err := writeJSON(env, d); err != nil {
+			return env.errorf("%v", err)
+		}
+	default:
+		return env.errorf("unknown format %q", *format)
+	}
+	return exitTrue
+}
+
+// writeJSON writes v to standard output as indented JSON.
+func writeJSON(env *environment, v interface{}) error {
+	enc := json.NewEncoder(env.stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
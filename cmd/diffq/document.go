@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// loadDocument reads and decodes the JSON or YAML document at path. A path of
+// "-" reads the document from stdin. The document is decoded into generic maps,
+// slices and primitives; YAML documents are normalized to the values produced
+// by decoding the equivalent JSON so that JSON and YAML documents may be
+// compared with each other.
+func loadDocument(path string, stdin io.Reader) (interface{}, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return decodeJSON(data)
+	case ".yaml", ".yml":
+		return decodeYAML(data)
+	}
+	v, err := decodeJSON(data)
+	if err != nil {
+		if v, yerr := decodeYAML(data); yerr == nil {
+			return v, nil
+		}
+		return nil, errors.Wrapf(err, "failed to decode %s as JSON or YAML", path)
+	}
+	return v, nil
+}
+
+// decodeJSON decodes the JSON document data. Numbers are decoded as
+// json.Number so that integers beyond the precision of a float64 are compared
+// exactly; see number.
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON")
+	}
+	if dec.More() {
+		return nil, errors.New("invalid JSON: unexpected data after document")
+	}
+	return numbers(v), nil
+}
+
+// numbers replaces each json.Number within v with the value of number.
+func numbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		return number(t)
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = numbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = numbers(e)
+		}
+	}
+	return v
+}
+
+// number returns n written in a canonical form as numbers are compared by
+// their text: integers, including those written with a fraction or exponent
+// such as 1.0 or 1e2, are written in full and other numbers are written as
+// the nearest float64, as encoding/json decodes them by default.
+func number(n json.Number) json.Number {
+	r, ok := new(big.Rat).SetString(string(n))
+	if !ok {
+		return n
+	}
+	if r.IsInt() {
+		return json.Number(r.Num().String())
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return n
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+}
+
+// decodeYAML decodes the YAML document data normalizing the result to the
+// values produced by decodeJSON.
+func decodeYAML(data []byte) (interface{}, error) {
+	var n yaml.Node
+	if err := yaml.Unmarshal(data, &n); err != nil {
+		return nil, errors.Wrap(err, "invalid YAML")
+	}
+	markBigInts(&n)
+	var v interface{}
+	if err := n.Decode(&v); err != nil {
+		return nil, errors.Wrap(err, "invalid YAML")
+	}
+	raw, err := json.Marshal(stringKeys(v))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid YAML")
+	}
+	return decodeJSON(raw)
+}
+
+// bigIntPrefix marks the YAML integers decoded as strings by markBigInts.
+const bigIntPrefix = "\x00bigint:"
+
+// markBigInts replaces the integers within the YAML node n that are beyond the
+// range of an int64 or uint64, which would otherwise be decoded as a float64,
+// with strings holding their decimal value prefixed by bigIntPrefix. stringKeys
+// converts the strings to json.Number.
+func markBigInts(n *yaml.Node) {
+	// integers beyond the range of a uint64 resolve as floats
+	if tag := n.ShortTag(); n.Kind == yaml.ScalarNode && (tag == "!!int" || tag == "!!float") {
+		var v interface{}
+		if err := n.Decode(&v); err == nil {
+			if _, ok := v.(float64); ok {
+				if i, ok := new(big.Int).SetString(strings.Replace(n.Value, "_", "", -1), 0); ok {
+					n.Tag, n.Value = "!!str", bigIntPrefix+i.String()
+				}
+			}
+		}
+	}
+	for i, c := range n.Content {
+		// map keys are converted to strings by stringKeys
+		if n.Kind != yaml.MappingNode || i%2 == 1 {
+			markBigInts(c)
+		}
+	}
+}
+
+// stringKeys converts maps with non-string keys, which YAML permits, to maps
+// keyed by the string representation of each key, and strings marked by
+// markBigInts to json.Number.
+func stringKeys(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		if strings.HasPrefix(t, bigIntPrefix) {
+			return json.Number(strings.TrimPrefix(t, bigIntPrefix))
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = stringKeys(e)
+		}
+		return t
+	case []interface{}:
+		for i, e := range t {
+			t[i] = stringKeys(e)
+		}
+		return t
+	}
+	return v
+}
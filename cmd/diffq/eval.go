@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cbergoon/diffq"
+)
+
+// evalOutput is the JSON output of the eval and explain subcommands.
+type evalOutput struct {
+	Statement string      `json:"statement"`
+	Result    bool        `json:"result"`
+	Trace     []traceStep `json:"trace,omitempty"`
+}
+
+// traceStep is the JSON representation of a diffq.TraceStep.
+type traceStep struct {
+	Depth      int           `json:"depth"`
+	Operation  string        `json:"operation"`
+	Expression string        `json:"expression"`
+	Result     bool          `json:"result"`
+	Binding    []string      `json:"binding,omitempty"`
+	Matched    diffq.Changes `json:"matched,omitempty"`
+}
+
+// runEval evaluates a statement against the changes between two documents.
+func runEval(env *environment, args []string) int {
+	return evalCommand(env, "eval", args)
+}
+
+// runExplain evaluates a statement against the changes between two documents
+// printing the result of each operation of the statement.
+func runExplain(env *environment, args []string) int {
+	return evalCommand(env, "explain", args)
+}
+
+// evalCommand implements the eval and explain subcommands.
+func evalCommand(env *environment, name string, args []string) int {
+	fs := newFlagSet(env, name)
+	statement := fs.String("q", "", "statement to evaluate")
+	format := fs.String("format", "text", "output format: text or json")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if *statement == "" {
+		fs.Usage()
+		return env.errorf("a statement must be provided with -q")
+	}
+	if *format != "text" && *format != "json" {
+		return env.errorf("unknown format %q", *format)
+	}
+
+	d, err := loadDiff(env, args)
+	if err != nil {
+		return env.errorf("%v", err)
+	}
+
+	out := evalOutput{Statement: *statement}
+	var trace []diffq.TraceStep
+	if name == "explain" {
+		out.Result, trace, err = d.Explain(*statement)
+	} else {
+		out.Result, err = d.EvaluateStatement(*statement)
+	}
+	if err != nil {
+		return env.errorf("%v", err)
+	}
+
+	if *format == "json" {
+		for _, s := range trace {
+			out.Trace = append(out.Trace, traceStep{
+				Depth:      s.Depth,
+				Operation:  s.Operation,
+				Expression: s.Expression,
+				Result:     s.Result,
+				Binding:    s.Binding,
+				Matched:    s.Matched,
+			})
+		}
+		if err := writeJSON(env, out); err != nil {
+			return env.errorf("%v", err)
+		}
+	} else if name == "explain" {
+		fmt.Fprint(env.stdout, formatTrace(trace))
+	} else {
+		fmt.Fprintln(env.stdout, out.Result)
+	}
+
+	if !out.Result {
+		return exitFalse
+	}
+	return exitTrue
+}
+
+// formatTrace formats the trace of an evaluation as an indented tree. Each
+// operation is prefixed with its result, suffixed with the element it was
+// evaluated against within an EACH expression and followed by the changes
+// matched by EVAL operations.
+func formatTrace(trace []diffq.TraceStep) string {
+	var b strings.Builder
+	for _, s := range trace {
+		indent := strings.Repeat("  ", s.Depth)
+		fmt.Fprintf(&b, "%s[%t] %s", indent, s.Result, s.Expression)
+		if s.Binding != nil {
+			fmt.Fprintf(&b, " (in %s)", strings.Join(s.Binding, "."))
+		}
+		b.WriteString("\n")
+		if s.Operation != "EVAL" && s.Operation != "eval" {
+			continue
+		}
+		if len(s.Matched) == 0 {
+			fmt.Fprintf(&b, "%s    (no matching changes)\n", indent)
+			continue
+		}
+		for _, line := range strings.Split(strings.TrimSuffix(diffq.NewDiffFromChanges(s.Matched).RenderText(), "\n"), "\n") {
+			fmt.Fprintf(&b, "%s    %s\n", indent, line)
+		}
+	}
+	return b.String()
+}
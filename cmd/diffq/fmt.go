@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cbergoon/diffq"
+)
+
+// runFmt formats statements and rule files read from files, or from standard
+// input when no files are given, writing the canonical form to standard output.
+func runFmt(env *environment, args []string) int {
+	fs := newFlagSet(env, "fmt")
+	list := fs.Bool("l", false, "list files whose formatting differs from the canonical form")
+	write := fs.Bool("w", false, "write the result to the source file instead of standard output")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+
+	if len(files) == 0 {
+		if *write {
+			return env.errorf("cannot use -w with standard input")
+		}
+		src, err := ioutil.ReadAll(env.stdin)
+		if err != nil {
+			return env.errorf("%v", err)
+		}
+		formatted, err := formatSource(string(src))
+		if err != nil {
+			return env.errorf("<stdin>: %v", err)
+		}
+		if *list {
+			if formatted != string(src) {
+				fmt.Fprintln(env.stdout, "<stdin>")
+			}
+			return exitTrue
+		}
+		fmt.Fprint(env.stdout, formatted)
+		return exitTrue
+	}
+
+	status := exitTrue
+	for _, path := range files {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			status = env.errorf("%v", err)
+			continue
+		}
+		formatted, err := formatSource(string(src))
+		if err != nil {
+			status = env.errorf("%s: %v", path, err)
+			continue
+		}
+		changed := formatted != string(src)
+		if *list && changed {
+			fmt.Fprintln(env.stdout, path)
+		}
+		if *write {
+			if changed {
+				if err := ioutil.WriteFile(path, []byte(formatted), 0644); err != nil {
+					status = env.errorf("%v", err)
+				}
+			}
+		} else if !*list {
+			fmt.Fprint(env.stdout, formatted)
+		}
+	}
+	return status
+}
+
+// formatSource formats the statement or rule file src terminating it with a
+// newline.
+func formatSource(src string) (string, error) {
+	if strings.TrimSpace(src) == "" {
+		return "", nil
+	}
+	return diffq.FormatRuleFile(src)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestFmt(t *testing.T) {
+	const (
+		src       = "and(eval(status =gt> 1), EVAL(count => 2),)"
+		formatted = "AND(\n    EVAL(status =GT> 1),\n    EVAL(count => 2)\n)\n"
+	)
+
+	status, out, errOut := runCommand(src, "fmt")
+	if status != exitTrue || out != formatted {
+		t.Errorf("incorrect output formatting stdin, got: %d %q; %s", status, out, errOut)
+	}
+
+	a, b, cleanup := writeDocuments(t, "a.dq", src, "b.dq", formatted)
+	defer cleanup()
+
+	status, out, _ = runCommand("", "fmt", "-l", a, b)
+	if status != exitTrue || out != a+"\n" {
+		t.Errorf("incorrect list output, got: %d %q", status, out)
+	}
+
+	status, out, _ = runCommand("", "fmt", "-w", a)
+	if status != exitTrue || out != "" {
+		t.Errorf("incorrect write output, got: %d %q", status, out)
+	}
+	written, err := ioutil.ReadFile(a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(written) != formatted {
+		t.Errorf("incorrect file contents, got: %q, want: %q", written, formatted)
+	}
+
+	status, _, errOut = runCommand("AND(EVAL(status => 1)", "fmt")
+	if status != exitError || errOut == "" {
+		t.Errorf("incorrect status for invalid statement, got: %d %q", status, errOut)
+	}
+	rules := "RULE a=eval(status => 1)\n\n/* b */\nRULE b = or(EVAL(count => 2))"
+	want := "RULE a = EVAL(status => 1)\n\n/* b */\nRULE b = OR(\n    EVAL(count => 2)\n)\n"
+	if status, out, errOut := runCommand(rules, "fmt"); status != exitTrue || out != want {
+		t.Errorf("incorrect output formatting rule file, got: %d %q, want: %q; %s", status, out, want, errOut)
+	}
+
+	if status, _, _ := runCommand("", "fmt", filepath.Join(filepath.Dir(a), "missing.dq")); status != exitError {
+		t.Errorf("incorrect status for missing file, got: %d", status)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/cbergoon/diffq"
+)
+
+// lintOutput is the JSON representation of a diagnostic reported by the lint
+// subcommand.
+type lintOutput struct {
+	File     string         `json:"file"`
+	Line     int            `json:"line"`
+	Column   int            `json:"column"`
+	Rule     string         `json:"rule"`
+	Severity diffq.Severity `json:"severity"`
+	Message  string         `json:"message"`
+}
+
+// runLint checks statements and rule files read from files, or from standard input when no
+// files are given, reporting each diagnostic found.
+func runLint(env *environment, args []string) int {
+	fs := newFlagSet(env, "lint")
+	format := fs.String("format", "text", "output format: text or json")
+	files, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if *format != "text" && *format != "json" {
+		return env.errorf("unknown format %q", *format)
+	}
+
+	sources := make(map[string]string)
+	if len(files) == 0 {
+		src, err := ioutil.ReadAll(env.stdin)
+		if err != nil {
+			return env.errorf("%v", err)
+		}
+		files = []string{"<stdin>"}
+		sources["<stdin>"] = string(src)
+	} else {
+		for _, path := range files {
+			src, err := ioutil.ReadFile(path)
+			if err != nil {
+				return env.errorf("%v", err)
+			}
+			sources[path] = string(src)
+		}
+	}
+
+	outputs := []lintOutput{}
+	for _, path := range files {
+		src := sources[path]
+		if strings.TrimSpace(src) == "" {
+			continue
+		}
+		for _, d := range lintSource(src) {
+			line, col := position(src, d.Offset)
+			outputs = append(outputs, lintOutput{
+				File:     path,
+				Line:     line,
+				Column:   col,
+				Rule:     d.Rule,
+				Severity: d.Severity,
+				Message:  d.Message,
+			})
+		}
+	}
+
+	if *format == "json" {
+		if err := writeJSON(env, outputs); err != nil {
+			return env.errorf("%v", err)
+		}
+	} else {
+		for _, o := range outputs {
+			fmt.Fprintf(env.stdout, "%s:%d:%d: %s: %s (%s)\n", o.File, o.Line, o.Column, o.Severity, o.Message, o.Rule)
+		}
+	}
+
+	if len(outputs) > 0 {
+		return exitFalse
+	}
+	return exitTrue
+}
+
+// lintSource lints each statement of the statement or rule file src returning
+// diagnostics with offsets in src. An error in the structure of a rule file is
+// reported as a syntax diagnostic.
+func lintSource(src string) []diffq.Diagnostic {
+	decls, err := diffq.ParseRuleFile(src)
+	if err != nil {
+		d := diffq.Diagnostic{Rule: diffq.LintSyntax, Severity: diffq.SeverityError, Message: err.Error()}
+		if rerr, ok := err.(*diffq.RuleFileError); ok {
+			d.Offset, d.End, d.Message = rerr.Offset, rerr.Offset, rerr.Message
+		}
+		return []diffq.Diagnostic{d}
+	}
+
+	var diags []diffq.Diagnostic
+	for _, decl := range decls {
+		for _, d := range diffq.Lint(decl.Statement) {
+			d.Offset += decl.Offset
+			d.End += decl.Offset
+			if decl.Name != "" {
+				d.Message = fmt.Sprintf("rule %s: %s", decl.Name, d.Message)
+			}
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// position returns the 1-based line and column of the byte offset in src.
+func position(src string, offset int) (int, int) {
+	if offset > len(src) {
+		offset = len(src)
+	}
+	line := 1 + strings.Count(src[:offset], "\n")
+	col := offset - strings.LastIndex(src[:offset], "\n")
+	return line, col
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	src := "AND(\n    EVAL(count => 1),\n    EVAL(count => 2)\n)\n"
+	status, out, errOut := runCommand(src, "lint")
+	if status != exitFalse {
+		t.Fatalf("incorrect status, got: %d, want: %d; %s", status, exitFalse, errOut)
+	}
+	want := "<stdin>:3:5: hint: AND is never true: EVAL(count => 2) contradicts EVAL(count => 1) unless count identifies a struct, map or slice (contradiction)\n"
+	if out != want {
+		t.Errorf("incorrect output, got: %q, want: %q", out, want)
+	}
+
+	a, b, cleanup := writeDocuments(t, "a.dq", src, "b.dq", "EVAL(status => \"Done\")\n")
+	defer cleanup()
+
+	status, out, _ = runCommand("", "lint", "--format", "json", a, b)
+	var decoded []lintOutput
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != exitFalse || len(decoded) != 1 || decoded[0].File != a || decoded[0].Line != 3 || decoded[0].Rule != "contradiction" {
+		t.Errorf("incorrect json output, got: %d %s", status, out)
+	}
+
+	if status, out, _ := runCommand("", "lint", b); status != exitTrue || out != "" {
+		t.Errorf("incorrect output for clean file, got: %d %q", status, out)
+	}
+}
+
+func TestLintRuleFile(t *testing.T) {
+	tests := map[string]string{
+		"RULE a = EVAL(count => 1)\nRULE b = OR(EVAL(count => *), EVAL(count =!> *))\n": "<stdin>:2:31: warning: rule b: OR is always true: EVAL(count => *) and EVAL(count =!> *) together match every change (tautology)\n",
+		"RULE a = EVAL(count => 1)\nRULE a = TRUE\n":                                    "<stdin>:2:6: error: rule a declared more than once (syntax)\n",
+	}
+	for src, want := range tests {
+		status, out, errOut := runCommand(src, "lint")
+		if status != exitFalse || out != want {
+			t.Errorf("incorrect output for %q, got: %d %q, want: %q; %s", src, status, out, want, errOut)
+		}
+	}
+}
+
+func TestPosition(t *testing.T) {
+	src := "ab\ncd\n\nef"
+	tests := map[int][2]int{0: {1, 1}, 1: {1, 2}, 3: {2, 1}, 7: {4, 1}, 8: {4, 2}}
+	for offset, want := range tests {
+		if line, col := position(src, offset); line != want[0] || col != want[1] {
+			t.Errorf("incorrect position for %d, got: %d:%d, want: %d:%d", offset, line, col, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/cbergoon/diffq"
+	"github.com/cbergoon/diffq/lsp"
+)
+
+// runLsp serves the Language Server Protocol on standard input and output
+// until the client exits.
+func runLsp(env *environment, args []string) int {
+	fs := newFlagSet(env, "lsp")
+	schema := fs.String("schema", "", "JSON Schema file describing the values rules are evaluated against")
+	rest, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+	if len(rest) > 0 {
+		return env.errorf("lsp takes no arguments")
+	}
+
+	var opts lsp.Options
+	if *schema != "" {
+		data, err := ioutil.ReadFile(*schema)
+		if err != nil {
+			return env.errorf("%v", err)
+		}
+		if opts.Schema, err = diffq.ParseJSONSchema(data); err != nil {
+			return env.errorf("%s: %v", *schema, err)
+		}
+	}
+	if err := lsp.NewServer(opts).Serve(env.stdin, env.stdout); err != nil {
+		return env.errorf("%v", err)
+	}
+	return exitTrue
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// frame returns the JSON-RPC messages framed with Content-Length headers.
+func frame(messages ...string) string {
+	var b strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&b, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return b.String()
+}
+
+func TestLsp(t *testing.T) {
+	a, _, cleanup := writeDocuments(t, "schema.json", `{"properties": {"Status": {"type": "string"}}}`, "b.json", "{}")
+	defer cleanup()
+
+	stdin := frame(
+		`{"jsonrpc": "2.0", "id": 1, "method": "initialize", "params": {}}`,
+		`{"jsonrpc": "2.0", "method": "textDocument/didOpen", "params": {"textDocument": {"uri": "file:///a.dq", "text": "EVAL(Stat => 1)"}}}`,
+		`{"jsonrpc": "2.0", "id": 2, "method": "shutdown"}`,
+		`{"jsonrpc": "2.0", "method": "exit"}`,
+	)
+	status, out, errOut := runCommand(stdin, "lsp", "--schema", a)
+	if status != exitTrue {
+		t.Fatalf("incorrect status, got: %d, want: %d; %s", status, exitTrue, errOut)
+	}
+	for _, want := range []string{`"hoverProvider":true`, `"code":"unknown-path"`, `"id":2,"result":null`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("incorrect output, got: %s, want: %s", out, want)
+		}
+	}
+
+	if status, _, _ := runCommand(frame(`{"jsonrpc": "2.0", "method": "exit"}`), "lsp"); status != exitError {
+		t.Errorf("incorrect status for exit without shutdown, got: %d", status)
+	}
+}
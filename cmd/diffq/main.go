@@ -0,0 +1,126 @@
+// Command diffq calculates the differential of two JSON or YAML documents and
+// evaluates diffq statements against it.
+//
+// Usage:
+//
+//	diffq diff [--format text|json|markdown|html] old new
+//	diffq eval -q statement [--format text|json] old new
+//	diffq explain -q statement [--format text|json] old new
+//	diffq repl [--history file] old new
+//	diffq fmt [-l] [-w] [file ...]
+//	diffq lint [--format text|json] [file ...]
+//	diffq lsp [--schema file]
+//
+// Documents ending in .yaml or .yml are read as YAML, documents ending in .json
+// as JSON and any other document as JSON falling back to YAML. A document of
+// "-" is read from standard input.
+//
+// eval and explain exit with status 0 when the statement holds, 1 when it does
+// not and 2 when an error occurs. diff exits with status 0 unless an error
+// occurs.
+//
+// repl prints the changes between the documents and evaluates each statement
+// entered, printing its result and the result of each operation within it.
+//
+// fmt rewrites statements in their canonical form. Statements are read from the
+// files given, or standard input when none are, and written to standard output;
+// -w rewrites the files in place and -l lists the files that are not formatted.
+//
+// lint reports likely mistakes in the statements read from the files given, or
+// standard input when none are, exiting with status 1 when any are found.
+//
+// fmt and lint accept rule files declaring named statements as well as single
+// statements.
+//
+// lsp serves the Language Server Protocol on standard input and output for
+// editors. --schema names a JSON Schema file describing the values rules are
+// evaluated against, used to complete and check paths.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Exit statuses of the command.
+const (
+	exitTrue  = 0
+	exitFalse = 1
+	exitError = 2
+)
+
+// command is a subcommand of diffq. run receives the arguments following the
+// subcommand name and returns the exit status.
+type command struct {
+	usage string
+	run   func(env *environment, args []string) int
+}
+
+// commands holds the subcommands of diffq by name. It is populated by init as
+// the subcommands refer to it when reporting their usage.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"diff":    {"diff [--format text|json|markdown|html] old new", runDiff},
+		"eval":    {"eval -q statement [--format text|json] old new", runEval},
+		"explain": {"explain -q statement [--format text|json] old new", runExplain},
+		"repl":    {"repl [--history file] old new", runRepl},
+		"fmt":     {"fmt [-l] [-w] [file ...]", runFmt},
+		"lint":    {"lint [--format text|json] [file ...]", runLint},
+		"lsp":     {"lsp [--schema file]", runLsp},
+	}
+}
+
+// environment holds the standard streams used by a subcommand.
+type environment struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// errorf reports an error on standard error returning exitError.
+func (env *environment) errorf(format string, args ...interface{}) int {
+	fmt.Fprintf(env.stderr, "diffq: "+format+"\n", args...)
+	return exitError
+}
+
+func main() {
+	os.Exit(run(&environment{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}, os.Args[1:]))
+}
+
+// run executes the subcommand named by the first argument.
+func run(env *environment, args []string) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(env.stderr)
+		if len(args) == 0 {
+			return exitError
+		}
+		return exitTrue
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		usage(env.stderr)
+		return env.errorf("unknown command %q", args[0])
+	}
+	return cmd.run(env, args[1:])
+}
+
+// usage writes the usage of each subcommand to w.
+func usage(w io.Writer) {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("usage:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  diffq %s\n", commands[name].usage)
+	}
+	fmt.Fprint(w, b.String())
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDocuments writes the old and new documents to a temporary directory
+// returning their paths.
+func writeDocuments(t *testing.T, oldName, oldDoc, newName, newDoc string) (string, string, func()) {
+	dir, err := ioutil.TempDir("", "diffq")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a, b := filepath.Join(dir, oldName), filepath.Join(dir, newName)
+	if err := ioutil.WriteFile(a, []byte(oldDoc), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := ioutil.WriteFile(b, []byte(newDoc), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return a, b, func() { os.RemoveAll(dir) }
+}
+
+// runCommand runs diffq with args returning the exit status and output.
+func runCommand(stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	env := &environment{stdin: strings.NewReader(stdin), stdout: &stdout, stderr: &stderr}
+	status := run(env, args)
+	return status, stdout.String(), stderr.String()
+}
+
+const (
+	oldJSON = `{"status": "Draft", "count": 1, "tags": ["a"]}`
+	newYAML = "status: Done\ncount: 2\ntags: [a, b]\n"
+)
+
+func TestDiff(t *testing.T) {
+	a, b, cleanup := writeDocuments(t, "old.json", oldJSON, "new.yaml", newYAML)
+	defer cleanup()
+
+	status, out, errOut := runCommand("", "diff", a, b)
+	if status != exitTrue {
+		t.Fatalf("incorrect status, got: %d, want: %d; %s", status, exitTrue, errOut)
+	}
+	for _, line := range []string{`~ status: "Draft" → "Done"`, "~ count:  1 → 2", `+ tags.1: → "b"`} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("output missing %q, got:\n%s", line, out)
+		}
+	}
+
+	status, out, errOut = runCommand("", "diff", "--format", "json", a, b)
+	if status != exitTrue {
+		t.Fatalf("incorrect status, got: %d, want: %d; %s", status, exitTrue, errOut)
+	}
+	var decoded struct {
+		Changed bool
+		Changes []json.RawMessage
+	}
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !decoded.Changed || len(decoded.Changes) != 3 {
+		t.Errorf("incorrect json output, got:\n%s", out)
+	}
+
+	status, out, _ = runCommand(newYAML, "diff", b, "-")
+	if status != exitTrue || out != "" {
+		t.Errorf("incorrect output comparing stdin, got: %d %q", status, out)
+	}
+}
+
+func TestDiffOrder(t *testing.T) {
+	a, b, cleanup := writeDocuments(t, "old.json", `{"m": {"a": 1, "b": 1, "c": 1, "d": 1}, "l": [1]}`,
+		"new.json", `{"m": {"a": 2, "b": 2, "c": 2, "e": 1}, "l": [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]}`)
+	defer cleanup()
+
+	_, want, _ := runCommand("", "diff", a, b)
+	for i := 0; i < 10; i++ {
+		if _, out, _ := runCommand("", "diff", a, b); out != want {
+			t.Fatalf("output differs between runs, got:\n%s\nwant:\n%s", out, want)
+		}
+	}
+	if !strings.Contains(want, "l.9:  → 10\n+ l.10: → 11\n~ m.a:") || !strings.Contains(want, "- m.d:  1 →\n+ m.e:  → 1\n") {
+		t.Errorf("changes not sorted by path, got:\n%s", want)
+	}
+}
+
+func TestEval(t *testing.T) {
+	a, b, cleanup := writeDocuments(t, "old.json", oldJSON, "new.yml", newYAML)
+	defer cleanup()
+
+	tests := map[string]int{
+		`EVAL(status => "Done")`:                           exitTrue,
+		`EVAL(status ["Draft"] => "Done")`:                 exitTrue,
+		`AND(EVAL(count => 2), EVAL(tags.* => $created))`:  exitTrue,
+		`EVAL(count =GT> 2)`:                               exitFalse,
+		`OR(EVAL(status => "Failed"), EVAL(missing => *))`: exitFalse,
+		`EVAL(status => "Done"`:                            exitError,
+	}
+	for statement, want := range tests {
+		status, out, errOut := runCommand("", "eval", "-q", statement, a, b)
+		if status != want {
+			t.Errorf("incorrect status for %s, got: %d, want: %d; %s", statement, status, want, errOut)
+		}
+		if want != exitError && out != map[bool]string{true: "true\n", false: "false\n"}[want == exitTrue] {
+			t.Errorf("incorrect output for %s, got: %q", statement, out)
+		}
+	}
+
+	if status, _, _ := runCommand("", "eval", a, b); status != exitError {
+		t.Errorf("incorrect status without statement, got: %d, want: %d", status, exitError)
+	}
+	if status, _, _ := runCommand("", "eval", "-q", `EVAL(a => 1)`, a); status != exitError {
+		t.Errorf("incorrect status with one document, got: %d, want: %d", status, exitError)
+	}
+	if status, _, _ := runCommand("", "unknown"); status != exitError {
+		t.Errorf("incorrect status for unknown command, got: %d, want: %d", status, exitError)
+	}
+}
+
+func TestEvalNumbers(t *testing.T) {
+	oldDoc := `{"big": 1, "neg": 1, "huge": 1, "small": 1}`
+	newDocs := map[string]string{
+		"new.json": `{"big": 18446744073709551615, "neg": -9007199254740993, "huge": 123456789012345678901234567890, "small": 2.5}`,
+		"new.yaml": "big: 18446744073709551615\nneg: -9007199254740993\nhuge: 123_456_789_012_345_678_901_234_567_890\nsmall: 2.5\n",
+	}
+	tests := map[string]int{
+		`EVAL(big => 18446744073709551615)`:            exitTrue,
+		`EVAL(big => 18446744073709551614)`:            exitFalse,
+		`EVAL(neg => -9007199254740993)`:               exitTrue,
+		`EVAL(neg => -9007199254740992)`:               exitFalse,
+		`EVAL(huge => 123456789012345678901234567890)`: exitTrue,
+		`EVAL(huge => 123456789012345678901234567891)`: exitFalse,
+		`EVAL(small [1] => 2.5)`:                       exitTrue,
+	}
+	for name, newDoc := range newDocs {
+		a, b, cleanup := writeDocuments(t, "old.json", oldDoc, name, newDoc)
+		for statement, want := range tests {
+			if status, _, errOut := runCommand("", "eval", "-q", statement, a, b); status != want {
+				t.Errorf("incorrect status for %s against %s, got: %d, want: %d; %s", statement, name, status, want, errOut)
+			}
+		}
+		cleanup()
+	}
+}
+
+func TestExplain(t *testing.T) {
+	a, b, cleanup := writeDocuments(t, "old.json", oldJSON, "new.yaml", newYAML)
+	defer cleanup()
+
+	statement := `AND(EVAL(status => "Done"), EVAL(count => 3))`
+	status, out, errOut := runCommand("", "explain", "-q", statement, a, b)
+	if status != exitFalse {
+		t.Fatalf("incorrect status, got: %d, want: %d; %s", status, exitFalse, errOut)
+	}
+	want := `[false] AND(EVAL(status => "Done"), EVAL(count => 3))
+  [true] EVAL(status => "Done")
+      ~ status: "Draft" → "Done"
+  [false] EVAL(count => 3)
+      ~ count: 1 → 2
+`
+	if out != want {
+		t.Errorf("incorrect explanation, got:\n%s\nwant:\n%s", out, want)
+	}
+
+	status, out, _ = runCommand("", "explain", "--format", "json", "-q", statement, a, b)
+	var decoded evalOutput
+	if err := json.Unmarshal([]byte(out), &decoded); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status != exitFalse || decoded.Result || len(decoded.Trace) != 3 || len(decoded.Trace[1].Matched) != 1 {
+		t.Errorf("incorrect json explanation, got:\n%s", out)
+	}
+
+	statement = `EACH(tags.*, EVAL(. => "b"))`
+	status, out, errOut = runCommand("", "explain", "-q", statement, a, b)
+	if status != exitTrue {
+		t.Fatalf("incorrect status, got: %d, want: %d; %s", status, exitTrue, errOut)
+	}
+	want = `[true] EACH(tags.*, EVAL(. => "b"))
+  [false] EVAL(. => "b") (in tags.0)
+      (no matching changes)
+  [true] EVAL(. => "b") (in tags.1)
+      + tags.1: → "b"
+`
+	if out != want {
+		t.Errorf("incorrect explanation, got:\n%s\nwant:\n%s", out, want)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cbergoon/diffq"
+	"github.com/cbergoon/diffq/lsp"
+	"github.com/peterh/liner"
+)
+
+const replHelp = `Enter a statement to evaluate it against the changes, e.g.
+  EVAL(status => "Done")
+Statements may span several lines; input continues until the parentheses
+balance. A blank line evaluates an incomplete statement. Press tab to complete
+keywords and field paths.
+
+  :changes  print the changes
+  :help     print this message
+  :quit     exit
+`
+
+// lineReader reads lines of input for the repl.
+type lineReader interface {
+	// Prompt displays prompt and returns the next line of input or io.EOF.
+	Prompt(prompt string) (string, error)
+	// AppendHistory records an entered statement.
+	AppendHistory(item string)
+	Close() error
+}
+
+// scanReader is a lineReader reading from a non-interactive input.
+type scanReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scanReader) Prompt(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+func (r *scanReader) AppendHistory(item string) {}
+
+func (r *scanReader) Close() error { return nil }
+
+// linerReader is a lineReader supporting line editing, history and tab
+// completion on a terminal. The history is persisted to path when not empty.
+type linerReader struct {
+	*liner.State
+	path string
+}
+
+func (r *linerReader) Close() error {
+	if r.path != "" {
+		if f, err := os.Create(r.path); err == nil {
+			r.WriteHistory(f)
+			f.Close()
+		}
+	}
+	return r.State.Close()
+}
+
+// newLinerReader returns a linerReader completing words with c and loading the
+// history from path.
+func newLinerReader(c *completer, path string) *linerReader {
+	s := liner.NewLiner()
+	s.SetCtrlCAborts(true)
+	s.SetTabCompletionStyle(liner.TabPrints)
+	s.SetWordCompleter(c.complete)
+	if path != "" {
+		if f, err := os.Open(path); err == nil {
+			s.ReadHistory(f)
+			f.Close()
+		}
+	}
+	return &linerReader{State: s, path: path}
+}
+
+// defaultHistoryPath returns the path of the history file in the home
+// directory of the user or an empty string if it cannot be determined.
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".diffq_history")
+}
+
+// runRepl evaluates statements entered interactively against the changes
+// between two documents.
+func runRepl(env *environment, args []string) int {
+	fs := newFlagSet(env, "repl")
+	history := fs.String("history", defaultHistoryPath(), "file used to persist statement history; empty disables persistence")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return exitError
+	}
+
+	d, err := loadDiff(env, args)
+	if err != nil {
+		return env.errorf("%v", err)
+	}
+
+	c := newCompleter(d)
+	var r lineReader
+	if f, ok := env.stdin.(*os.File); ok && f == os.Stdin && liner.TerminalSupported() {
+		r = newLinerReader(c, *history)
+	} else {
+		r = &scanReader{scanner: bufio.NewScanner(env.stdin), out: env.stdout}
+	}
+	defer r.Close()
+
+	printChanges(env.stdout, d)
+	fmt.Fprintln(env.stdout, "Type :help for help.")
+
+	var pending []string
+	for {
+		prompt := "diffq> "
+		if len(pending) > 0 {
+			prompt = "   ... "
+		}
+		line, err := r.Prompt(prompt)
+		if err == io.EOF || err == liner.ErrPromptAborted {
+			fmt.Fprintln(env.stdout)
+			return exitTrue
+		} else if err != nil {
+			return env.errorf("%v", err)
+		}
+
+		if len(pending) == 0 {
+			switch strings.TrimSpace(line) {
+			case "":
+				continue
+			case ":quit", ":q", ":exit":
+				return exitTrue
+			case ":help", ":h":
+				fmt.Fprint(env.stdout, replHelp)
+				continue
+			case ":changes", ":c":
+				printChanges(env.stdout, d)
+				continue
+			}
+		}
+
+		pending = append(pending, line)
+		statement := strings.Join(pending, "\n")
+		if !statementComplete(statement) && strings.TrimSpace(line) != "" {
+			continue
+		}
+		pending = nil
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+
+		r.AppendHistory(statement)
+		result, trace, err := d.Explain(statement)
+		if err != nil {
+			fmt.Fprintf(env.stdout, "error: %v\n", err)
+			continue
+		}
+		fmt.Fprintln(env.stdout, result)
+		fmt.Fprint(env.stdout, formatTrace(trace))
+	}
+}
+
+// printChanges writes the changes of d to w.
+func printChanges(w io.Writer, d *diffq.Diff) {
+	if len(d.Changes) == 0 {
+		fmt.Fprintln(w, "No changes.")
+		return
+	}
+	fmt.Fprintf(w, "%d change(s):\n", len(d.Changes))
+	fmt.Fprint(w, d.RenderText())
+}
+
+// statementComplete reports whether the parentheses of statement are balanced
+// and it does not end within a string or comment.
+func statementComplete(statement string) bool {
+	depth := 0
+	for i := 0; i < len(statement); i++ {
+		switch {
+		case statement[i] == '"' || statement[i] == '`':
+			quote := statement[i]
+			for i++; i < len(statement) && statement[i] != quote; i++ {
+				if statement[i] == '\\' && quote == '"' {
+					i++
+				}
+			}
+			if i >= len(statement) {
+				return false
+			}
+		case strings.HasPrefix(statement[i:], "/*"):
+			end := strings.Index(statement[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+		case statement[i] == '(':
+			depth++
+		case statement[i] == ')':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+// completer completes keywords and the field paths of a Diff.
+type completer struct {
+	words []string
+}
+
+// newCompleter returns a completer offering the keywords of the query language
+// and the paths of the changes and of the original and new values of d.
+func newCompleter(d *diffq.Diff) *completer {
+	seen := make(map[string]bool)
+	add := func(path []string) {
+		for i := 1; i <= len(path); i++ {
+			seen[strings.Join(path[:i], ".")] = true
+		}
+	}
+	for _, c := range d.Changes {
+		add(c.Path)
+	}
+	walkPaths(reflect.ValueOf(d.Original), nil, 0, add)
+	walkPaths(reflect.ValueOf(d.New), nil, 0, add)
+
+	c := &completer{}
+	for p := range seen {
+		c.words = append(c.words, p)
+	}
+	sort.Strings(c.words)
+	// the keywords are shared with the language server so both stay current
+	c.words = append(c.words, lsp.Keywords()...)
+	return c
+}
+
+// maxCompletionDepth limits the depth of the paths walked for completion.
+const maxCompletionDepth = 16
+
+// walkPaths calls add with the path of each value nested within v. Slices
+// contribute the index of each element as well as the * wildcard and the
+// $first and $last modifiers.
+func walkPaths(v reflect.Value, path []string, depth int, add func([]string)) {
+	if depth > maxCompletionDepth {
+		return
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	child := func(name string, cv reflect.Value) {
+		p := append(append([]string{}, path...), name)
+		add(p)
+		walkPaths(cv, p, depth+1, add)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if tag := strings.Split(f.Tag.Get("diff"), ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+			child(name, v.Field(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			child(fmt.Sprint(k.Interface()), v.MapIndex(k))
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return
+		}
+		for _, m := range []string{"*", "$first", "$last"} {
+			add(append(append([]string{}, path...), m))
+		}
+		for i := 0; i < v.Len(); i++ {
+			child(strconv.Itoa(i), v.Index(i))
+		}
+	}
+}
+
+// complete implements liner.WordCompleter completing the word ending at pos,
+// which is an index of a rune in line rather than of a byte.
+func (c *completer) complete(line string, pos int) (string, []string, string) {
+	runes := []rune(line)
+	if pos > len(runes) {
+		pos = len(runes)
+	}
+	start := pos
+	for start > 0 && !strings.ContainsRune(" \t\n(),[", runes[start-1]) {
+		start--
+	}
+	head, word, tail := string(runes[:start]), string(runes[start:pos]), string(runes[pos:])
+
+	// paths are completed one component at a time; keywords ignore case
+	var completions []string
+	for _, w := range c.words {
+		if strings.HasPrefix(w, word) && !strings.Contains(w[len(word):], ".") {
+			completions = append(completions, w)
+		} else if !strings.Contains(w, ".") && strings.HasPrefix(strings.ToUpper(w), strings.ToUpper(word)) {
+			completions = append(completions, w)
+		}
+	}
+	return head, completions, tail
+}
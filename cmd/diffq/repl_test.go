@@ -0,0 +1,114 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/cbergoon/diffq"
+)
+
+func TestRepl(t *testing.T) {
+	a, b, cleanup := writeDocuments(t, "old.json", oldJSON, "new.yaml", newYAML)
+	defer cleanup()
+
+	input := strings.Join([]string{
+		`EVAL(status => "Done")`,
+		`AND(`,
+		`  EVAL(count => 3),`,
+		`  EVAL(tags.* => $created)`,
+		`)`,
+		`EVAL(status =>`,
+		``,
+		`:quit`,
+		`EVAL(count => 2)`,
+	}, "\n")
+	status, out, errOut := runCommand(input, "repl", "--history", "", a, b)
+	if status != exitTrue {
+		t.Fatalf("incorrect status, got: %d, want: %d; %s", status, exitTrue, errOut)
+	}
+
+	for _, want := range []string{
+		"3 change(s):\n",
+		"diffq> true\n[true] EVAL(status => \"Done\")\n",
+		"diffq>    ...    ...    ... false\n[false] AND(\n  EVAL(count => 3),\n  EVAL(tags.* => $created)\n)\n  [false] EVAL(count => 3)\n",
+		"diffq>    ... error: ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "EVAL(count => 2)") {
+		t.Errorf("statement evaluated after :quit, got:\n%s", out)
+	}
+}
+
+func TestStatementComplete(t *testing.T) {
+	tests := map[string]bool{
+		`EVAL(A => 1)`:                true,
+		`AND(EVAL(A => 1),`:           false,
+		`EVAL(A => ")")`:              true,
+		`EVAL(A => "(`:                false,
+		`EVAL(A => 1) /* ( */`:        true,
+		`AND(EVAL(A => 1) /* ) */`:    false,
+		`AND(EVAL(A => 1) /* comment`: false,
+		`EVAL(A => "\")(")`:           true,
+		`EVAL(A => "\"`:               false,
+		"EVAL(A => `(\\`)":            true,
+		"EVAL(A => `)":                false,
+	}
+	for statement, want := range tests {
+		if got := statementComplete(statement); got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	type Item struct {
+		Name  string
+		Price int `diff:"cost"`
+	}
+	type Order struct {
+		Status string
+		Items  []Item
+		hidden string
+	}
+	a := &Order{Status: "Draft", Items: []Item{{Name: "A", Price: 1}}}
+	b := &Order{Status: "Done", Items: []Item{{Name: "A", Price: 2}}}
+	d, err := diffq.Differential(a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := newCompleter(d)
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`EVAL(Ite`, []string{"Items"}},
+		{`EVAL(Items.`, []string{"Items.$first", "Items.$last", "Items.*", "Items.0"}},
+		{`EVAL(Items.0.`, []string{"Items.0.Name", "Items.0.cost"}},
+		{`EVAL(St`, []string{"Status", "startOfDay("}},
+		{`an`, []string{"AND(", "ANY(", "ANY_STEP("}},
+		{`eac`, []string{"EACH("}},
+		{`EVAL(LE`, []string{"LEN("}},
+		{`EVAL(Status =st`, []string{"=STARTSWITH>"}},
+		{`EVAL(Status => $con`, []string{"$conflict"}},
+		{`EVAL(Status => $cr`, []string{"$created"}},
+		{`EVAL(hid`, nil},
+		{`AND(EVAL(Status => "café ✓"), EVAL(Ite`, []string{"Items"}},
+		{`AND(EVAL(Status =CONTAINS> "日本"), EVAL(St`, []string{"Status", "startOfDay("}},
+	}
+	for _, tt := range tests {
+		// liner passes the cursor position as a rune index
+		head, got, tail := c.complete(tt.line+" )", utf8.RuneCountInString(tt.line))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("incorrect completions for %q, got: %v, want: %v", tt.line, got, tt.want)
+		}
+		if tail != " )" || !strings.HasPrefix(tt.line, head) {
+			t.Errorf("incorrect head or tail for %q, got: %q %q", tt.line, head, tail)
+		}
+	}
+}
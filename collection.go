@@ -0,0 +1,352 @@
+package diffq
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+)
+
+// Functions of collection expressions. A collection expression takes the place
+// of the identifier of an EVAL expression, e.g. EVAL(LEN(Items) =GT> 10).
+const (
+	aggregateLen   = "LEN"
+	aggregateCount = "COUNT"
+)
+
+// aggregate is a parsed collection expression:
+//
+//	LEN(path)           the length of the collection at path
+//	COUNT(path, action) the number of elements of the collection at path with a
+//	                    change of the action, e.g. $deleted, or any change for *
+type aggregate struct {
+	// fn is aggregateLen or aggregateCount.
+	fn string
+	// path identifies the collection and may hold wildcards and modifiers.
+	path string
+	// action is the action literal counted by COUNT.
+	action tokenType
+}
+
+// isAggregateFunction reports whether name, the identifier at the start of a
+// token, begins a collection expression.
+func isAggregateFunction(name string) bool {
+	switch strings.ToUpper(name) {
+	case aggregateLen, aggregateCount:
+		return name == strings.ToUpper(name) || name == strings.ToLower(name)
+	}
+	return false
+}
+
+// parseAggregate parses the collection expression s.
+func parseAggregate(s string) (*aggregate, error) {
+	s = strings.TrimSpace(s)
+	name, rest := splitTimeFunction(s)
+	// the arguments are lexed separately as the lexer reads the whole
+	// expression as a single token
+	var toks []*token
+	l := newLexer(rest)
+	for tok := l.nextToken(); tok.ttype != cEOF; tok = l.nextToken() {
+		if tok.ttype != cCOMMENT {
+			toks = append(toks, tok)
+		}
+	}
+	invalid := errors.Errorf("invalid collection expression %s", s)
+	if !isAggregateFunction(name) || len(toks) < 3 || toks[0].ttype != cLPAREN || toks[1].ttype != cIDENT || toks[len(toks)-1].ttype != cRPAREN {
+		return nil, invalid
+	}
+	a := &aggregate{fn: strings.ToUpper(name), path: toks[1].tliteral}
+	args := toks[2 : len(toks)-1]
+	switch a.fn {
+	case aggregateLen:
+		if len(args) != 0 {
+			return nil, invalid
+		}
+	case aggregateCount:
+		if len(args) != 2 || args[0].ttype != cCOMMA {
+			return nil, errors.Errorf("expected COUNT(path, action) in %s", s)
+		}
+		switch args[1].ttype {
+		case cASTERISK, cCREATED, cDELETED, cUPDATED, cMOVED, cCONFLICT:
+			a.action = args[1].ttype
+		default:
+			return nil, errors.Errorf("expected action literal or * in %s got %s", s, args[1].tliteral)
+		}
+	}
+	return a, nil
+}
+
+// String returns the canonical source form of the collection expression a.
+func (a *aggregate) String() string {
+	if a.fn == aggregateCount {
+		return a.fn + "(" + a.path + ", " + string(a.action) + ")"
+	}
+	return a.fn + "(" + a.path + ")"
+}
+
+// collection is a map, slice or array identified by a path in the Original and
+// New values of a Diff. Either value is invalid when the collection does not
+// exist in it.
+type collection struct {
+	path          []string
+	original, new reflect.Value
+}
+
+// collectionLen returns the number of elements of the collection v or 0 if v
+// is not a collection.
+func collectionLen(v reflect.Value) int {
+	if isCollection(v) {
+		return v.Len()
+	}
+	return 0
+}
+
+// isCollection reports whether v is a map, slice or array.
+func isCollection(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return true
+	}
+	return false
+}
+
+// collections returns the collections identified by the expanded path in the
+// Original or New value of the Diff, d, ordered by path.
+func (d *Diff) collections(path []string) []collection {
+	var order []string
+	found := make(map[string]*collection)
+	add := func(v interface{}, original bool) {
+		findValues(reflect.ValueOf(v), path, nil, func(p []string, v reflect.Value) {
+			if !isCollection(v) {
+				return
+			}
+			key := strings.Join(p, ".")
+			c, ok := found[key]
+			if !ok {
+				c = &collection{path: p}
+				found[key] = c
+				order = append(order, key)
+			}
+			if original {
+				c.original = v
+			} else {
+				c.new = v
+			}
+		})
+	}
+	add(d.Original, true)
+	add(d.New, false)
+
+	sort.Strings(order)
+	result := make([]collection, 0, len(order))
+	for _, key := range order {
+		result = append(result, *found[key])
+	}
+	return result
+}
+
+// findValues calls found with the path and value of each value within v
+// identified by pattern, which may hold wildcards. Path components are named
+// the same way as Differential names them.
+func findValues(v reflect.Value, pattern, path []string, found func([]string, reflect.Value)) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return
+	}
+	if len(pattern) == 0 {
+		found(path, v)
+		return
+	}
+	c := pattern[0]
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			name, ok := fieldPathName(v.Type().Field(i))
+			if ok && (c == "*" || c == name) {
+				findValues(v.Field(i), pattern[1:], appendPath(path, name), found)
+			}
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			name := fmt.Sprint(k.Interface())
+			if c == "*" || c == name {
+				findValues(v.MapIndex(k), pattern[1:], appendPath(path, name), found)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		identified := hasIdentifiedElements(v)
+		for i := 0; i < v.Len(); i++ {
+			name := fmt.Sprint(i)
+			if identified {
+				name = elementIdentifier(v.Index(i))
+			}
+			if c == "*" || c == name {
+				findValues(v.Index(i), pattern[1:], appendPath(path, name), found)
+			}
+		}
+	}
+}
+
+// valueAt returns the value at path within v and false if there is none.
+func valueAt(v interface{}, path []string) (interface{}, bool) {
+	var value interface{}
+	ok := false
+	findValues(reflect.ValueOf(v), path, nil, func(_ []string, e reflect.Value) {
+		if e.CanInterface() {
+			value, ok = e.Interface(), true
+		}
+	})
+	return value, ok
+}
+
+// aggregateChanges returns the changes the collection expression a is compared
+// to. LEN yields a change from the original to the new length of each
+// collection whose length changed; COUNT yields a change to the number of
+// elements with a change of the action for each collection.
+func (d *Diff) aggregateChanges(a *aggregate) Changes {
+	path := d.expandIdentifier(a.path)
+	var result Changes
+	for _, c := range d.collections(path) {
+		switch a.fn {
+		case aggregateLen:
+			from, to := collectionLen(c.original), collectionLen(c.new)
+			if from != to {
+				result = append(result, Change{Type: ChangeUpdate, Path: c.path, From: from, To: to})
+			}
+		case aggregateCount:
+			result = append(result, Change{Type: ChangeUpdate, Path: c.path, To: d.countElements(c.path, a.action)})
+		}
+	}
+	return result
+}
+
+// countElements returns the number of elements of the collection at path with
+// a change of the action literal action, or with any change for '*'.
+func (d *Diff) countElements(path []string, action tokenType) int {
+	elements := make(map[string]bool)
+	for _, c := range d.Changes {
+		if len(c.Path) <= len(path) || !wildcardPathMatch(path, c.Path) {
+			continue
+		}
+		if action == cASTERISK || actionOf(action) == c.Type {
+			elements[c.Path[len(path)]] = true
+		}
+	}
+	return len(elements)
+}
+
+// actionOf returns the change type of the action literal t.
+func actionOf(t tokenType) ChangeType {
+	switch t {
+	case cCREATED:
+		return ChangeCreate
+	case cDELETED:
+		return ChangeDelete
+	case cUPDATED:
+		return ChangeUpdate
+	case cMOVED:
+		return ChangeMove
+	case cCONFLICT:
+		return ChangeConflict
+	}
+	return ""
+}
+
+// containsElement reports whether the collection v holds an element equal to
+// the literal tok. The keys of a map are its elements.
+func (d *Diff) containsElement(v reflect.Value, tok *token) bool {
+	switch v.Kind() {
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if d.equalsLiteral(k.Interface(), tok) {
+				return true
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if d.equalsLiteral(v.Index(i).Interface(), tok) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equalsLiteral reports whether the value v is equal to the literal tok in the
+// same manner as the => operator.
+func (d *Diff) equalsLiteral(v interface{}, tok *token) bool {
+	switch tok.ttype {
+	case cINT, cFLOAT:
+		c, ok := compareNumber(v, tok)
+		return ok && c == 0
+	case cSTRING:
+		c, ok := compareString(v, tok)
+		return ok && c == 0
+	case cDURATION:
+		dur, err := time.ParseDuration(tok.tliteral)
+		return err == nil && dur == cast.ToDuration(v)
+	case cTIME, cTIMEEXPR:
+		c, ok := d.compareTime(v, tok)
+		return ok && c == 0
+	case cTRUE:
+		return v == true
+	case cFALSE:
+		return v == false
+	case cNIL:
+		return isNil(v)
+	case cASTERISK:
+		return true
+	}
+	return false
+}
+
+// isNil reports whether v is nil or a nil pointer, interface, map or slice.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// containsChange reports whether the collection c satisfies the =CONTAINS>
+// expression with the optional previous value and the literal given the changes
+// matched by the expression: a change must be matched within the collection,
+// the new collection must hold the literal and the original collection must hold
+// the previous value.
+func (d *Diff) containsChange(c collection, matched Changes, previous, literal *token) bool {
+	changed := false
+	for _, mc := range matched {
+		if len(mc.Path) > len(c.path) && wildcardPathMatch(c.path, mc.Path) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false
+	}
+	if previous != nil && previous.ttype != cASTERISK && !d.containsElement(c.original, previous) {
+		return false
+	}
+	return d.containsElement(c.new, literal)
+}
@@ -0,0 +1,78 @@
+package diffq
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAggregate(t *testing.T) {
+	tests := map[string]string{
+		`LEN(Items)`:                 `LEN(Items)`,
+		`len( Items.* )`:             `LEN(Items.*)`,
+		`COUNT(Items,$deleted)`:      `COUNT(Items, $deleted)`,
+		`count(NTS.*.NSS, $CREATED)`: `COUNT(NTS.*.NSS, $created)`,
+		`COUNT(Items, *)`:            `COUNT(Items, *)`,
+	}
+	for expr, want := range tests {
+		a, err := parseAggregate(expr)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", expr, err)
+			continue
+		}
+		if got := a.String(); got != want {
+			t.Errorf("incorrect result for %s, got: %s, want: %s", expr, got, want)
+		}
+	}
+
+	errs := map[string]string{
+		`Len(Items)`:            "invalid collection expression Len(Items)",
+		`LEN()`:                 "invalid collection expression LEN()",
+		`LEN(Items, $created)`:  "invalid collection expression LEN(Items, $created)",
+		`COUNT(Items)`:          "expected COUNT(path, action) in COUNT(Items)",
+		`COUNT(Items, "a")`:     `expected action literal or * in COUNT(Items, "a") got a`,
+		`COUNT(Items, $created`: "invalid collection expression COUNT(Items, $created",
+	}
+	for expr, want := range errs {
+		if _, err := parseAggregate(expr); err == nil || err.Error() != want {
+			t.Errorf("incorrect error for %s, got: %v, want: %s", expr, err, want)
+		}
+	}
+}
+
+func TestCollections(t *testing.T) {
+	a := &OuterType{SS: []string{"a"}, NTS: []*NestedType{{NSS: []string{"x"}}, {}}}
+	b := &OuterType{SS: []string{"a", "b"}, NTS: []*NestedType{{}}, M: map[string]int{"one": 1}}
+	d, _ := Differential(a, b)
+
+	tests := map[string][]string{
+		"SS":        {"SS"},
+		"NTS.*.NSS": {"NTS.0.NSS", "NTS.1.NSS"},
+		"M":         {"M"},
+		"S":         nil,
+		"NT.NS":     nil,
+		"Missing":   nil,
+	}
+	for path, want := range tests {
+		var got []string
+		for _, c := range d.collections(strings.Split(path, ".")) {
+			got = append(got, strings.Join(c.path, "."))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect result for %s, got: %v, want: %v", path, got, want)
+		}
+	}
+
+	lens := map[string][2]int{"SS": {1, 2}, "NTS.0.NSS": {1, 0}, "NTS.1.NSS": {0, 0}, "M": {0, 1}}
+	for path, want := range lens {
+		c := d.collections(strings.Split(path, "."))
+		if len(c) != 1 {
+			t.Errorf("incorrect number of collections for %s, got: %d", path, len(c))
+			continue
+		}
+		got := [2]int{collectionLen(c[0].original), collectionLen(c[0].new)}
+		if got != want {
+			t.Errorf("incorrect lengths for %s, got: %v, want: %v", path, got, want)
+		}
+	}
+}
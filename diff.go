@@ -1,7 +1,12 @@
 package diffq
 
 import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/pkg/errors"
@@ -11,12 +16,32 @@ import (
 // Changes and Change are abstracted to eliminate tight-coupling with underlying
 // diff library.
 
+// ChangeType indicates the kind of change represented by a Change.
+type ChangeType string
+
+const (
+	// ChangeCreate indicates a field, element or key was added.
+	ChangeCreate ChangeType = "create"
+	// ChangeUpdate indicates the value of a field, element or key was modified.
+	ChangeUpdate ChangeType = "update"
+	// ChangeDelete indicates a field, element or key was removed.
+	ChangeDelete ChangeType = "delete"
+	// ChangeMove indicates an unmodified slice element changed position. For
+	// moves the Path identifies the new position of the element, From and To
+	// both hold the element and FromIndex and ToIndex hold the original and new
+	// index respectively.
+	ChangeMove ChangeType = "move"
+	// ChangeConflict indicates a path was changed differently by both sides of
+	// a three way differential. Conflicts are only produced by Differential3.
+	ChangeConflict ChangeType = "conflict"
+)
+
 // Change represents a single change identified by the differential. Change is
 // intentionally abstracted from the r3labs/diff library to avoid tight coupling
 // to the dependancy.
 type Change struct {
-	// Type indicates the change type: create, delete or update.
-	Type string
+	// Type indicates the change type: create, update, delete or move.
+	Type ChangeType
 	// Path is an array of field names representing the path to the field in
 	// question from the outer struct.
 	Path []string
@@ -24,6 +49,10 @@ type Change struct {
 	From interface{}
 	// To contains the new value of the field.
 	To interface{}
+	// FromIndex contains the original index of a moved slice element.
+	FromIndex int
+	// ToIndex contains the new index of a moved slice element.
+	ToIndex int
 }
 
 // Changes represents a list of changes identified by the differential process.
@@ -44,41 +73,346 @@ type Diff struct {
 	Original interface{}
 	// New holds the new struct value
 	New interface{}
+	// Clock returns the current time used by the relative time expressions of
+	// statements, e.g. now(); time.Now is used when nil.
+	Clock func() time.Time
+
+	// binding holds the path of the element relative paths are resolved
+	// against while evaluating the statement of an EACH expression.
+	binding []string
+}
+
+// DiffOption configures the differential calculated by Differential.
+type DiffOption func(*diffConfig)
+
+// diffConfig holds the options of Differential.
+type diffConfig struct {
+	moves bool
+}
+
+// WithMoves records slice elements which changed position relative to the
+// other elements as move changes. By default reordered elements are not
+// reported as the underlying diff library ignores the ordering of slices.
+func WithMoves() DiffOption {
+	return func(c *diffConfig) {
+		c.moves = true
+	}
 }
 
 // Differential calculates the differential of a and b returning an initialized
 // Diff and an error if encountered.
-func Differential(a, b interface{}) (*Diff, error) {
+func Differential(a, b interface{}, opts ...DiffOption) (*Diff, error) {
+	var config diffConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
 	// calculate diff using r3labs/diff
 	changes, err := diff.Diff(a, b)
 	if err != nil {
 		return nil, err
 	}
 
-	result := &Diff{
-		ChangeLogMap: make(map[string]Change),
-		Original:     a,
-		New:          b,
-	}
-
-	// map changes to internal change type and build lookup map
+	// map changes to internal change type
+	var result Changes
 	for _, c := range changes {
-		nc := Change{
-			Type: c.Type,
+		ch := Change{
+			Type: ChangeType(c.Type),
 			Path: c.Path,
 			To:   c.To,
 			From: c.From,
 		}
-		result.Changes = append(result.Changes, nc)
+		if ch.Type == ChangeUpdate {
+			ch.From, ch.To = numberAt(a, ch.Path, ch.From), numberAt(b, ch.Path, ch.To)
+		}
+		result = append(result, ch)
+	}
+
+	// r3labs/diff ignores ordering of slices; identify elements which were
+	// reordered and record them as moves
+	if config.moves {
+		result = append(result, detectMoves([]string{}, reflect.ValueOf(a), reflect.ValueOf(b))...)
+	}
+
+	return newDiff(a, b, result), nil
+}
+
+// numberAt returns the json.Number at path within v if there is one and value
+// otherwise. r3labs/diff reports updated values of any string kind as plain
+// strings so numbers decoded as json.Number are restored to compare and render
+// as numbers.
+func numberAt(v interface{}, path []string, value interface{}) interface{} {
+	if _, ok := value.(string); !ok {
+		return value
+	}
+	if n, ok := valueAt(v, path); ok {
+		if n, ok := n.(json.Number); ok {
+			return n
+		}
+	}
+	return value
+}
+
+// newDiff initializes a Diff from a list of changes building the lookup map.
+// Moves do not replace other changes with the same identifier in the lookup
+// map as their path refers to the new position of an element.
+func newDiff(original, new interface{}, changes Changes) *Diff {
+	result := &Diff{
+		Changes:      changes,
+		ChangeLogMap: make(map[string]Change),
+		Original:     original,
+		New:          new,
+	}
+
+	for _, c := range changes {
 		ident := strings.Join(c.Path, ".")
-		result.ChangeLogMap[ident] = nc
+		if _, ok := result.ChangeLogMap[ident]; !ok || c.Type != ChangeMove {
+			result.ChangeLogMap[ident] = c
+		}
 	}
 
 	if len(changes) > 0 {
 		result.Changed = true
 	}
 
-	return result, nil
+	return result
+}
+
+// Reverse returns a new Diff representing the change from New back to Original.
+// From and To values are swapped for each change and created values become
+// deleted values and vice versa. Moved elements are moved back to their original
+// position. The Diff, d, is not modified.
+func (d *Diff) Reverse() *Diff {
+	var changes Changes
+	for _, c := range d.Changes {
+		rc := Change{
+			Type:      c.Type,
+			Path:      appendPath(c.Path),
+			From:      c.To,
+			To:        c.From,
+			FromIndex: c.ToIndex,
+			ToIndex:   c.FromIndex,
+		}
+		switch c.Type {
+		case ChangeCreate:
+			rc.Type = ChangeDelete
+		case ChangeDelete:
+			rc.Type = ChangeCreate
+		case ChangeMove:
+			// the path of a move identifies the new position of the element
+			if len(rc.Path) > 0 {
+				rc.Path[len(rc.Path)-1] = fmt.Sprint(c.FromIndex)
+			}
+		}
+		changes = append(changes, rc)
+	}
+
+	return newDiff(d.New, d.Original, changes)
+}
+
+// Subset returns a new Diff containing only the changes of the Diff, d, under
+// the paths identified. Identifiers use the syntax of the query language
+// including wildcards and the $first and $last modifiers. Original and New are
+// retained.
+func (d *Diff) Subset(identifiers ...string) *Diff {
+	var filters [][]string
+	for _, ident := range identifiers {
+		filters = append(filters, d.expandIdentifier(ident))
+	}
+
+	var changes Changes
+	for _, c := range d.Changes {
+		for _, f := range filters {
+			if wildcardPathMatch(f, c.Path) {
+				changes = append(changes, c)
+				break
+			}
+		}
+	}
+
+	return newDiff(d.Original, d.New, changes)
+}
+
+// Filter returns a new Diff containing only the changes of the Diff, d, under
+// the identifiers of the EVAL expressions in statement. The result is suitable
+// for rendering the portion of a diff relevant to a statement.
+func (d *Diff) Filter(statement string) (*Diff, error) {
+	err := validate(statement)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.Subset(absoluteIdentifiers(statement)...), nil
+}
+
+// detectMoves walks a and b in parallel and returns a move change for each slice
+// element present in both values whose position changed relative to the other
+// elements. Elements that merely shifted due to the insertion or removal of
+// other elements are not considered moved. Path components are named the same
+// way as the underlying diff library names them.
+func detectMoves(path []string, a, b reflect.Value) Changes {
+	for a.Kind() == reflect.Ptr || a.Kind() == reflect.Interface {
+		if a.IsNil() {
+			return nil
+		}
+		a = a.Elem()
+	}
+	for b.Kind() == reflect.Ptr || b.Kind() == reflect.Interface {
+		if b.IsNil() {
+			return nil
+		}
+		b = b.Elem()
+	}
+	if a.Kind() != b.Kind() || a.Type() != b.Type() {
+		return nil
+	}
+
+	var moves Changes
+	switch a.Kind() {
+	case reflect.Struct:
+		if a.Type() == reflect.TypeOf(time.Time{}) {
+			return nil
+		}
+		for i := 0; i < a.NumField(); i++ {
+			name, ok := fieldPathName(a.Type().Field(i))
+			if !ok {
+				continue
+			}
+			moves = append(moves, detectMoves(appendPath(path, name), a.Field(i), b.Field(i))...)
+		}
+	case reflect.Map:
+		for _, k := range a.MapKeys() {
+			bv := b.MapIndex(k)
+			if !bv.IsValid() {
+				continue
+			}
+			moves = append(moves, detectMoves(appendPath(path, fmt.Sprint(k.Interface())), a.MapIndex(k), bv)...)
+		}
+	case reflect.Slice, reflect.Array:
+		if hasIdentifiedElements(a) || hasIdentifiedElements(b) {
+			// elements are matched by identifier rather than position
+			return nil
+		}
+		// match each element of b with the first unmatched equal element of a
+		matchedA := make([]bool, a.Len())
+		matchedB := make([]bool, b.Len())
+		var pairs [][2]int
+		for j := 0; j < b.Len(); j++ {
+			for i := 0; i < a.Len(); i++ {
+				if !matchedA[i] && reflect.DeepEqual(a.Index(i).Interface(), b.Index(j).Interface()) {
+					matchedA[i], matchedB[j] = true, true
+					pairs = append(pairs, [2]int{i, j})
+					break
+				}
+			}
+		}
+		// elements in the longest run of increasing original indices kept their
+		// relative order; everything else moved
+		kept := longestIncreasingRun(pairs)
+		for p, pair := range pairs {
+			if !kept[p] {
+				moves = append(moves, Change{
+					Type:      ChangeMove,
+					Path:      appendPath(path, fmt.Sprint(pair[1])),
+					From:      a.Index(pair[0]).Interface(),
+					To:        b.Index(pair[1]).Interface(),
+					FromIndex: pair[0],
+					ToIndex:   pair[1],
+				})
+			}
+		}
+		// unmatched elements at the same index are compared by the underlying
+		// diff library; do the same to find nested moves
+		for i := 0; i < a.Len() && i < b.Len(); i++ {
+			if !matchedA[i] && !matchedB[i] {
+				moves = append(moves, detectMoves(appendPath(path, fmt.Sprint(i)), a.Index(i), b.Index(i))...)
+			}
+		}
+	}
+	return moves
+}
+
+// longestIncreasingRun returns, for each pair, whether it belongs to the longest
+// subsequence of pairs whose original indices are strictly increasing. Pairs
+// must be ordered by their new index.
+func longestIncreasingRun(pairs [][2]int) []bool {
+	kept := make([]bool, len(pairs))
+	if len(pairs) == 0 {
+		return kept
+	}
+	// tails[k] holds the index of the pair ending the best run of length k+1
+	var tails []int
+	prev := make([]int, len(pairs))
+	for p := range pairs {
+		k := sort.Search(len(tails), func(k int) bool {
+			return pairs[tails[k]][0] >= pairs[p][0]
+		})
+		if k > 0 {
+			prev[p] = tails[k-1]
+		} else {
+			prev[p] = -1
+		}
+		if k == len(tails) {
+			tails = append(tails, p)
+		} else {
+			tails[k] = p
+		}
+	}
+	for p := tails[len(tails)-1]; p >= 0; p = prev[p] {
+		kept[p] = true
+	}
+	return kept
+}
+
+// hasIdentifiedElements reports whether the first element of the slice v is a
+// struct with a field tagged as an identifier; such slices are compared by
+// identifier rather than by position.
+func hasIdentifiedElements(v reflect.Value) bool {
+	if v.Len() == 0 {
+		return false
+	}
+	e := v.Index(0)
+	for e.Kind() == reflect.Ptr || e.Kind() == reflect.Interface {
+		if e.IsNil() {
+			return false
+		}
+		e = e.Elem()
+	}
+	if e.Kind() != reflect.Struct {
+		return false
+	}
+	for i := 0; i < e.NumField(); i++ {
+		parts := strings.Split(e.Type().Field(i).Tag.Get("diff"), ",")
+		for _, opt := range parts[1:] {
+			if opt == "identifier" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fieldPathName returns the path component used for the struct field f and
+// false if the field is excluded from the differential.
+func fieldPathName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	name := strings.Split(f.Tag.Get("diff"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+// appendPath returns a copy of path with elems appended.
+func appendPath(path []string, elems ...string) []string {
+	np := make([]string, 0, len(path)+len(elems))
+	np = append(np, path...)
+	return append(np, elems...)
 }
 
 // HumanDifferential calculates the differential between Original and New fields
@@ -102,3 +436,47 @@ func (d *Diff) EvaluateStatement(statement string) (bool, error) {
 	}
 	return result, nil
 }
+
+// TraceStep records the result of a single operation evaluated as part of a
+// statement.
+type TraceStep struct {
+	// Depth is the nesting depth of the operation within the statement; the
+	// outermost operation has a depth of zero.
+	Depth int
+	// Operation is the keyword of the operation, e.g. AND, OR or EVAL.
+	Operation string
+	// Expression is the text of the operation as it appears in the statement.
+	Expression string
+	// Matched holds the changes matched by the identifier of an EVAL operation.
+	Matched Changes
+	// Result holds the result of the operation.
+	Result bool
+	// Binding holds the path of the element of the innermost enclosing EACH
+	// expression the operation was evaluated against, or nil outside of EACH.
+	Binding []string
+
+	offset int
+}
+
+// Explain executes statement provided against Diff, d, in the same manner as
+// EvaluateStatement and additionally returns the trace of the evaluation. The
+// trace holds a step for each operation of the statement in the order they
+// appear in the statement, outermost first. The step of an EACH expression is
+// followed by the steps of its statement for each element it was evaluated
+// against, in the order the elements were evaluated.
+func (d *Diff) Explain(statement string) (bool, []TraceStep, error) {
+	err := validate(statement)
+	if err != nil {
+		return false, nil, err
+	}
+	var trace []TraceStep
+	result, err := evaluateTrace(statement, d, &trace)
+	if err != nil {
+		return false, nil, errors.Wrap(err, "error: failed to evaluate")
+	}
+	// operations complete innermost first; order them as they appear
+	sort.SliceStable(trace, func(i, j int) bool {
+		return trace[i].offset < trace[j].offset
+	})
+	return result, trace, nil
+}
@@ -0,0 +1,320 @@
+package diffq
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MergeConflict describes a path changed differently by both sides of a three
+// way differential.
+type MergeConflict struct {
+	// Path is the path of the conflicting change. When one side changes a value
+	// nested within a value changed by the other side Path is the shorter of the
+	// two paths.
+	Path []string
+	// Ours holds the change made by our side.
+	Ours Change
+	// Theirs holds the change made by their side.
+	Theirs Change
+}
+
+// Diff3 represents the three way differential of two values derived from a
+// common base. Queries may be evaluated against either side using Ours and
+// Theirs, against the conflicts using Conflicts or against the merged result
+// using EvaluateStatement.
+type Diff3 struct {
+	// Ours holds the differential from the base to our value.
+	Ours *Diff
+	// Theirs holds the differential from the base to their value.
+	Theirs *Diff
+	// Merged holds the differential from the base to the merged value
+	// containing every change that does not conflict.
+	Merged *Diff
+	// Conflicts holds a change of type ChangeConflict for each conflicting
+	// path. From contains our new value and To contains their new value.
+	Conflicts *Diff
+	// ConflictList holds the details of each conflicting path.
+	ConflictList []MergeConflict
+	// Result holds the merged value: a copy of the base with every change that
+	// does not conflict applied.
+	Result interface{}
+}
+
+// Differential3 calculates the three way differential of ours and theirs
+// relative to base returning an initialized Diff3 and an error if encountered.
+// Changes made by only one side, or identically by both sides, are merged.
+// Changes to the same path, or to a path nested within another changed path,
+// that differ are conflicts and are excluded from the merged result.
+//
+// Slice elements are identified by position, so when one side inserts or
+// removes elements of a slice that the other side also changes the slice as a
+// whole is a conflict. Any remaining change that cannot be applied to the base
+// is reported as a conflict and the rest of the changes are still merged.
+func Differential3(base, ours, theirs interface{}) (*Diff3, error) {
+	if base == nil {
+		return nil, errors.New("error: base value must not be nil")
+	}
+
+	od, err := Differential(base, ours)
+	if err != nil {
+		return nil, errors.Wrap(err, "error: failed to calculate differential of ours")
+	}
+	td, err := Differential(base, theirs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error: failed to calculate differential of theirs")
+	}
+
+	result := &Diff3{
+		Ours:   od,
+		Theirs: td,
+	}
+
+	var conflicts Changes
+	conflict := func(path []string, oc, tc Change) {
+		result.ConflictList = append(result.ConflictList, MergeConflict{
+			Path:   path,
+			Ours:   oc,
+			Theirs: tc,
+		})
+		conflicts = append(conflicts, Change{
+			Type: ChangeConflict,
+			Path: path,
+			From: oc.To,
+			To:   tc.To,
+		})
+	}
+
+	// changes within slices resized concurrently are replaced by a conflict
+	// on the slice
+	var sliceConflicts [][]string
+	for _, path := range resizedSlices(base, ours, theirs, od.Changes, td.Changes) {
+		oursIn := changesWithin(od.Changes, path)
+		theirsIn := changesWithin(td.Changes, path)
+		if len(oursIn) == 0 || len(theirsIn) == 0 || changesEqual(oursIn, theirsIn) || withinAny(path, sliceConflicts) {
+			continue
+		}
+		sliceConflicts = append(sliceConflicts, path)
+		from, _ := valueAt(base, path)
+		oc := Change{Type: ChangeUpdate, Path: path, From: from}
+		tc := oc
+		oc.To, _ = valueAt(ours, path)
+		tc.To, _ = valueAt(theirs, path)
+		conflict(path, oc, tc)
+	}
+	var oursLeft, theirsLeft Changes
+	for _, c := range od.Changes {
+		if !withinAny(c.Path, sliceConflicts) {
+			oursLeft = append(oursLeft, c)
+		}
+	}
+	for _, c := range td.Changes {
+		if !withinAny(c.Path, sliceConflicts) {
+			theirsLeft = append(theirsLeft, c)
+		}
+	}
+
+	var merged Changes
+	conflicted := make(map[int]bool)
+	for _, oc := range oursLeft {
+		overlaps := false
+		for ti, tc := range theirsLeft {
+			if !pathOverlaps(oc.Path, tc.Path) {
+				continue
+			}
+			if changeEquals(oc, tc) {
+				continue
+			}
+			overlaps = true
+			conflicted[ti] = true
+			path := oc.Path
+			if len(tc.Path) < len(path) {
+				path = tc.Path
+			}
+			conflict(path, oc, tc)
+		}
+		if !overlaps {
+			merged = append(merged, oc)
+		}
+	}
+	for ti, tc := range theirsLeft {
+		if conflicted[ti] {
+			continue
+		}
+		// identical changes made by both sides are merged from ours
+		duplicate := false
+		for _, oc := range oursLeft {
+			if pathOverlaps(oc.Path, tc.Path) && changeEquals(oc, tc) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, tc)
+		}
+	}
+
+	// apply the merged changes to a copy of the base; changes that cannot be
+	// applied are skipped by Apply and reported as conflicts
+	rv := reflect.New(reflect.TypeOf(base))
+	rv.Elem().Set(reflect.ValueOf(base))
+	if err := merged.Apply(rv.Interface()); err != nil {
+		cerr, ok := err.(*ConflictError)
+		if !ok {
+			return nil, errors.Wrap(err, "error: failed to apply merged changes")
+		}
+		var applied Changes
+		for _, c := range merged {
+			if !conflictsWith(cerr, c) {
+				applied = append(applied, c)
+				continue
+			}
+			var oc, tc Change
+			if containsChange(od.Changes, c) {
+				oc = c
+			} else {
+				tc = c
+			}
+			conflict(c.Path, oc, tc)
+		}
+		merged = applied
+	}
+	result.Result = rv.Elem().Interface()
+	result.Merged = newDiff(base, result.Result, merged)
+	result.Conflicts = newDiff(ours, theirs, conflicts)
+
+	return result, nil
+}
+
+// resizedSlices returns the paths of the slices in base, ours or theirs that
+// have elements created or deleted by the changes of either side, ordered
+// by path. Slices whose elements are identified by a field rather than by
+// position are excluded.
+func resizedSlices(base, ours, theirs interface{}, changes ...Changes) [][]string {
+	var paths [][]string
+	seen := make(map[string]bool)
+	for _, cs := range changes {
+		for _, c := range cs {
+			if (c.Type != ChangeCreate && c.Type != ChangeDelete) || len(c.Path) == 0 {
+				continue
+			}
+			path := c.Path[:len(c.Path)-1]
+			key := strings.Join(path, "\x00")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			for _, v := range []interface{}{base, ours, theirs} {
+				if isPositionalSlice(v, path) {
+					paths = append(paths, path)
+					break
+				}
+			}
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Join(paths[i], "\x00") < strings.Join(paths[j], "\x00")
+	})
+	return paths
+}
+
+// isPositionalSlice reports whether the value at path within v is a slice or
+// array whose elements are identified by position.
+func isPositionalSlice(v interface{}, path []string) bool {
+	positional := false
+	findValues(reflect.ValueOf(v), path, nil, func(_ []string, e reflect.Value) {
+		switch e.Kind() {
+		case reflect.Slice, reflect.Array:
+			positional = !hasIdentifiedElements(e)
+		}
+	})
+	return positional
+}
+
+// changesWithin returns the changes of cs nested within path.
+func changesWithin(cs Changes, path []string) Changes {
+	var within Changes
+	for _, c := range cs {
+		if len(c.Path) > len(path) && pathOverlaps(c.Path, path) {
+			within = append(within, c)
+		}
+	}
+	return within
+}
+
+// withinAny reports whether path is nested within any of paths.
+func withinAny(path []string, paths [][]string) bool {
+	for _, p := range paths {
+		if len(path) > len(p) && pathOverlaps(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// changesEqual reports whether a and b hold identical changes in any order.
+func changesEqual(a, b Changes) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, c := range a {
+		if !containsChange(b, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsChange reports whether cs holds a change identical to c.
+func containsChange(cs Changes, c Change) bool {
+	for _, other := range cs {
+		if changeEquals(other, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictsWith reports whether c is one of the changes that could not be
+// applied in err.
+func conflictsWith(err *ConflictError, c Change) bool {
+	for _, conflict := range err.Conflicts {
+		if changeEquals(conflict.Change, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// EvaluateStatement executes statement provided against the merged changes and
+// the conflicts of the Diff3, d. Conflicting paths are matched using the
+// $conflict literal, e.g. EVAL(Spec.* => $conflict).
+func (d *Diff3) EvaluateStatement(statement string) (bool, error) {
+	var changes Changes
+	changes = append(changes, d.Merged.Changes...)
+	changes = append(changes, d.Conflicts.Changes...)
+	merged := newDiff(d.Merged.Original, d.Merged.New, changes)
+	merged.Clock = d.Merged.Clock
+	return merged.EvaluateStatement(statement)
+}
+
+// pathOverlaps reports whether the paths a and b are equal or one contains the
+// other.
+func pathOverlaps(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// changeEquals reports whether the changes a and b are identical.
+func changeEquals(a, b Change) bool {
+	return a.Type == b.Type &&
+		strings.Join(a.Path, ".") == strings.Join(b.Path, ".") &&
+		reflect.DeepEqual(a.From, b.From) &&
+		reflect.DeepEqual(a.To, b.To)
+}
@@ -0,0 +1,91 @@
+package diffq
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDifferential3(t *testing.T) {
+	base := OuterType{S: "Base", I: 1, F64: 1.5, NT: NestedType{NS: "Base", NI: 1}, M: map[string]int{"one": 1}}
+	ours := OuterType{S: "Ours", I: 2, F64: 1.5, NT: NestedType{NS: "Ours", NI: 1}, M: map[string]int{"one": 1}}
+	theirs := OuterType{S: "Base", I: 2, F64: 2.5, NT: NestedType{NS: "Theirs", NI: 2}, M: map[string]int{"one": 1, "two": 2}}
+
+	d, err := Differential3(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(d.ConflictList) != 1 || strings.Join(d.ConflictList[0].Path, ".") != "NT.NS" {
+		t.Fatalf("incorrect conflicts, got: %+v", d.ConflictList)
+	}
+	if d.ConflictList[0].Ours.To != "Ours" || d.ConflictList[0].Theirs.To != "Theirs" {
+		t.Errorf("incorrect conflicting changes, got: %+v", d.ConflictList[0])
+	}
+
+	want := OuterType{S: "Ours", I: 2, F64: 2.5, NT: NestedType{NS: "Base", NI: 2}, M: map[string]int{"one": 1, "two": 2}}
+	if !reflect.DeepEqual(d.Result, want) {
+		t.Errorf("incorrect merged result, got: %+v, want: %+v", d.Result, want)
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(NT.* => $conflict))`:         true,
+		`AND(EVAL(S =!> $conflict))`:           true,
+		`AND(EVAL(S => "Ours"), EVAL(I => 2))`: true,
+		`AND(EVAL(M.two => 2))`:                true,
+		`AND(EVAL(NT.NS => "Ours"))`:           false,
+	}
+	for statement, want := range tests {
+		got, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+
+	if ok, _ := d.Theirs.EvaluateStatement(`AND(EVAL(NT.NS => "Theirs"))`); !ok {
+		t.Errorf("incorrect result evaluating theirs, got: %t, want: %t", ok, true)
+	}
+}
+
+func TestDifferential3Slices(t *testing.T) {
+	base := OuterType{S: "Base", SS: []string{"a", "b", "c"}, IS: []int{1, 2}}
+	ours := OuterType{S: "Ours", SS: []string{"a", "b", "c", "d"}, IS: []int{1, 2, 3}}
+	theirs := OuterType{S: "Base", SS: []string{"b", "c"}, IS: []int{1, 2, 3}}
+
+	d, err := Differential3(base, ours, theirs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(d.ConflictList) != 1 || strings.Join(d.ConflictList[0].Path, ".") != "SS" {
+		t.Fatalf("incorrect conflicts, got: %+v", d.ConflictList)
+	}
+	c := d.ConflictList[0]
+	if !reflect.DeepEqual(c.Ours.To, ours.SS) || !reflect.DeepEqual(c.Theirs.To, theirs.SS) || !reflect.DeepEqual(c.Ours.From, base.SS) {
+		t.Errorf("incorrect conflicting changes, got: %+v", c)
+	}
+
+	want := OuterType{S: "Ours", SS: []string{"a", "b", "c"}, IS: []int{1, 2, 3}}
+	if !reflect.DeepEqual(d.Result, want) {
+		t.Errorf("incorrect merged result, got: %+v, want: %+v", d.Result, want)
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(SS => $conflict))`: true,
+		`AND(EVAL(SS.3 => "d"))`:     false,
+		`AND(EVAL(IS.2 => 3))`:       true,
+		`AND(EVAL(S => "Ours"))`:     true,
+	}
+	for statement, want := range tests {
+		got, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+}
@@ -1,8 +1,13 @@
 package diffq
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -164,6 +169,166 @@ func TestDifferential(t *testing.T) {
 	// t.Error("TODO (cbergoon): Implement Test")
 }
 
+func TestDifferentialMoves(t *testing.T) {
+	a := &OuterType{SS: []string{"A", "B", "C", "D"}, IS: []int{1, 2, 3}}
+	b := &OuterType{SS: []string{"A", "D", "B", "C"}, IS: []int{0, 1, 2, 3}}
+
+	d, err := Differential(a, b, WithMoves())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var moves Changes
+	for _, c := range d.Changes {
+		if c.Type == ChangeMove {
+			moves = append(moves, c)
+		}
+	}
+	if len(moves) != 1 {
+		t.Fatalf("incorrect number of moves, got: %d, want: %d", len(moves), 1)
+	}
+	want := Change{Type: ChangeMove, Path: []string{"SS", "1"}, From: "D", To: "D", FromIndex: 3, ToIndex: 1}
+	if !reflect.DeepEqual(moves[0], want) {
+		t.Errorf("incorrect move, got: %v, want: %v", moves[0], want)
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(SS.* => $moved))`:    true,
+		`AND(EVAL(IS.* => $moved))`:    false,
+		`AND(EVAL(IS.* =!> $moved))`:   true,
+		`AND(EVAL(IS.* => $created))`:  true,
+		`AND(EVAL(I => $updated))`:     false,
+		`AND(EVAL(SS.* =!> $updated))`: true,
+	}
+	for statement, want := range tests {
+		got, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+
+	// moves are only compared to $moved as the value of the element is unchanged
+	d, _ = Differential(&OuterType{IS: []int{5, 6, 7}}, &OuterType{IS: []int{7, 5, 6}}, WithMoves())
+	tests = map[string]bool{
+		`EVAL(IS.* => $moved)`:      true,
+		`EVAL(IS.* => 0)`:           false,
+		`EVAL(IS.* => 7)`:           false,
+		`EVAL(IS.* => *)`:           false,
+		`EVAL(IS.* =!> *)`:          true,
+		`EVAL(IS.* =GTE> 0)`:        false,
+		`ALL(EVAL(IS.* =GT> 100))`:  true,
+		`ANY(EVAL(IS.* => $moved))`: true,
+	}
+	for statement, want := range tests {
+		if got, _ := d.EvaluateStatement(statement); got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+
+	// moves are only detected when requested
+	d, _ = Differential(&OuterType{IS: []int{5, 6, 7}}, &OuterType{IS: []int{7, 5, 6}})
+	if d.Changed || len(d.Changes) != 0 {
+		t.Errorf("incorrect changes without moves, got: %v", d.Changes)
+	}
+
+	b.I = 2
+	d, _ = Differential(a, b)
+	if ok, _ := d.EvaluateStatement(`AND(EVAL(I => $updated))`); !ok {
+		t.Errorf("incorrect result for $updated, got: %t, want: %t", ok, true)
+	}
+	if _, err := d.EvaluateStatement(`AND(EVAL(I [0] => $updated))`); err == nil {
+		t.Errorf("expected error using action literal with previous value")
+	}
+}
+
+func TestReverse(t *testing.T) {
+	a, b := newPatchTypes()
+	d, err := Differential(a, b, WithMoves())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := d.Reverse()
+
+	if r.Original != d.New || r.New != d.Original {
+		t.Errorf("original and new values not swapped")
+	}
+	if len(r.Changes) != len(d.Changes) || len(r.ChangeLogMap) != len(d.ChangeLogMap) {
+		t.Errorf("incorrect number of changes, got: %d, want: %d", len(r.Changes), len(d.Changes))
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(OuterType.S ["StringSU"] => "StringS"))`: true,
+		`AND(EVAL(OuterType.IS.* => $deleted))`:            true,
+		`AND(EVAL(OuterType.IS.* => $created))`:            false,
+		`AND(EVAL(OuterType.SS.* => $created))`:            true,
+	}
+	for statement, want := range tests {
+		got, err := r.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+
+	_, target := newPatchTypes()
+	if err := r.Apply(target); err != nil {
+		t.Fatalf("unexpected error applying reversed diff: %v", err)
+	}
+	if !reflect.DeepEqual(target, a) {
+		t.Errorf("incorrect result applying reversed diff, got: %+v, want: %+v", *target, *a)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	a, b := newPatchTypes()
+	d, _ := Differential(a, b, WithMoves())
+
+	f, err := d.Filter(`AND(EVAL(OuterType.S => "StringSU"), OR(EVAL(OuterType.NTS.*.NSS.$last => *), EVAL(OuterType.M.one => 2)))`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var paths []string
+	for _, c := range f.Changes {
+		paths = append(paths, strings.Join(c.Path, "."))
+	}
+	want := []string{"OuterType.S", "OuterType.M.one"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("incorrect filtered changes, got: %v, want: %v", paths, want)
+	}
+	if f.Original != d.Original || f.New != d.New || len(f.ChangeLogMap) != 2 {
+		t.Errorf("incorrect filtered diff, got: %+v", f)
+	}
+
+	s := d.Subset("OuterType.NTS.*.NSS", "OuterType.SS.$first")
+	paths = nil
+	for _, c := range s.Changes {
+		paths = append(paths, strings.Join(c.Path, "."))
+	}
+	want = []string{"OuterType.NTS.0.NSS.0", "OuterType.NTS.0.NSS.1", "OuterType.NTS.2.NSS.0", "OuterType.SS.0"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("incorrect subset changes, got: %v, want: %v", paths, want)
+	}
+
+	f, _ = d.Filter(`EVAL(COUNT(OuterType.M, $updated) => 1)`)
+	if len(f.Changes) != 3 || strings.Join(f.Changes[0].Path[:2], ".") != "OuterType.M" {
+		t.Errorf("incorrect filtered changes for collection expression, got: %v", f.Changes)
+	}
+
+	f, _ = d.Filter(`EACH(OuterType.M.*, EVAL(. => $updated))`)
+	if len(f.Changes) != 3 || strings.Join(f.Changes[0].Path[:2], ".") != "OuterType.M" {
+		t.Errorf("incorrect filtered changes for scope, got: %v", f.Changes)
+	}
+
+	if _, err := d.Filter(`AND(EVAL(S => 1)`); err == nil {
+		t.Errorf("expected error filtering invalid statement")
+	}
+}
+
 func TestHumanDifferential(t *testing.T) {
 	// t.Error("TODO (cbergoon): Implement Test")
 }
@@ -171,3 +336,529 @@ func TestHumanDifferential(t *testing.T) {
 func TestEvaluateStatement(t *testing.T) {
 	// t.Error("TODO (cbergoon): Implement Test")
 }
+
+func TestEvaluateStatementComments(t *testing.T) {
+	a := &OuterType{S: "Draft", I: 1}
+	b := &OuterType{S: "Done", I: 2}
+	d, _ := Differential(a, b)
+
+	tests := map[string]bool{
+		`OR(EVAL(I => 5) /* never */)`:             false,
+		`AND(/* first */ EVAL(I => 2), FALSE)`:     false,
+		`EVAL(I /* inline */ => 2)`:                true,
+		`EVAL(S ["Draft"] /* inline */ => "Done")`: true,
+	}
+	for statement, want := range tests {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+}
+
+func TestEvaluateStatementStrings(t *testing.T) {
+	d, _ := Differential(&OuterType{S: "Draft"}, &OuterType{S: "say \"hi\"\n\tcafé"})
+
+	tests := map[string]bool{
+		`EVAL(S => "say \"hi\"\n\tcaf\u00e9")`:      true,
+		"EVAL(S => `say \"hi\"\n\tcafé`)":           true,
+		"EVAL(S => `say \"hi\"`)":                   false,
+		`EVAL(S ["Draft"] => "say \"hi\"\n\tcafé")`: true,
+	}
+	for statement, want := range tests {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+
+	raw, _ := Differential(&OuterType{S: "a"}, &OuterType{S: `C:\path\n`})
+	if result, err := raw.EvaluateStatement("EVAL(S => `C:\\path\\n`)"); err != nil || !result {
+		t.Errorf("incorrect result for raw string, got: %t, %v", result, err)
+	}
+}
+
+func TestEvaluateStatementStringModifiers(t *testing.T) {
+	d, _ := Differential(&OuterType{S: " In Progress"}, &OuterType{S: "DONE \t"})
+
+	tests := map[string]bool{
+		`EVAL(S => "done")`:                                false,
+		`EVAL(S => i"done")`:                               false,
+		`EVAL(S => is"done")`:                              true,
+		`EVAL(S => si"Done")`:                              true,
+		`EVAL(S =!> is"done")`:                             false,
+		`EVAL(S [is"in progress"] => is"done")`:            true,
+		`EVAL(S [i"in progress"] => *)`:                    false,
+		`EVAL(S =LT> is"e")`:                               true,
+		`EVAL(S =STARTSWITH> "DO")`:                        true,
+		`EVAL(S =STARTSWITH> "do")`:                        false,
+		`EVAL(S =startswith> i"do")`:                       true,
+		`EVAL(S =ENDSWITH> "NE")`:                          false,
+		`EVAL(S =ENDSWITH> s"NE")`:                         true,
+		`EVAL(S =CONTAINS> i"on")`:                         true,
+		`EVAL(S =CONTAINS> "x")`:                           false,
+		`EVAL(S [s"In Progress"] =CONTAINS> "ON")`:         true,
+		`EVAL(SS =CONTAINS> "x")`:                          false,
+		`OR(EVAL(S => "Done"), EVAL(S =ENDSWITH> "E \t"))`: true,
+	}
+	for statement, want := range tests {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+
+	errs := map[string]string{
+		`EVAL(S =STARTSWITH> 1)`:      "validation error: expected string literal with =STARTSWITH> got 1",
+		`EVAL(S [*] =CONTAINS> *)`:    "validation error: cannot use literal value '*' or action literals with =CONTAINS>",
+		`EVAL(S =ENDSWITH> $created)`: "validation error: expected string literal with =ENDSWITH> got $created",
+	}
+	for statement, want := range errs {
+		_, err := d.EvaluateStatement(statement)
+		if err == nil || !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("incorrect error for %s, got: %v, want: %s", statement, err, want)
+		}
+	}
+}
+
+func TestEvaluateStatementCollections(t *testing.T) {
+	a := &OuterType{
+		SS:  []string{"bug", "triage"},
+		IS:  []int{1, 2, 3, 4, 5},
+		NTS: []*NestedType{{NS: "A", NSS: []string{"x"}}, {NS: "B"}, {NS: "C"}, {NS: "D"}, {NS: "E"}},
+		NT:  NestedType{NSS: []string{"x"}},
+		M:   map[string]int{"one": 1},
+	}
+	b := &OuterType{
+		SS:  []string{"bug", "urgent"},
+		IS:  []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12},
+		NTS: []*NestedType{{NS: "A", NSS: []string{"x", "y"}}},
+		NT:  NestedType{NSS: []string{"x"}},
+		M:   map[string]int{"one": 1, "two": 2},
+	}
+	d, _ := Differential(a, b)
+
+	tests := map[string]bool{
+		`EVAL(SS =CONTAINS> "urgent")`:                true,
+		`EVAL(SS =CONTAINS> i"URGENT")`:               true,
+		`EVAL(SS =CONTAINS> "bug")`:                   true,
+		`EVAL(SS =CONTAINS> "triage")`:                false,
+		`EVAL(SS ["triage"] =CONTAINS> "urgent")`:     true,
+		`EVAL(SS ["urgent"] =CONTAINS> "urgent")`:     false,
+		`EVAL(SS [*] =CONTAINS> "urgent")`:            true,
+		`EVAL(IS =CONTAINS> 12)`:                      true,
+		`EVAL(IS =CONTAINS> 13)`:                      false,
+		`EVAL(M =CONTAINS> "two")`:                    true,
+		`EVAL(M =CONTAINS> 2)`:                        false,
+		`EVAL(NTS.*.NSS =CONTAINS> "y")`:              true,
+		`EVAL(NT.NSS =CONTAINS> "x")`:                 false,
+		`EVAL(LEN(IS) =GT> 10)`:                       true,
+		`EVAL(LEN(IS) => 12)`:                         true,
+		`EVAL(LEN(IS) [5] => 12)`:                     true,
+		`EVAL(LEN(IS) [4] => *)`:                      false,
+		`EVAL(LEN(SS) =!> *)`:                         true,
+		`EVAL(LEN(SS) => 2)`:                          false,
+		`EVAL(LEN(NTS) =LT> 2)`:                       true,
+		`EVAL(LEN(NTS.*.NSS) => 2)`:                   true,
+		`EVAL(len(M) =GTE> 2)`:                        true,
+		`EVAL(COUNT(NTS, $deleted) =GT> 3)`:           true,
+		`EVAL(COUNT(NTS, $deleted) => 4)`:             true,
+		`EVAL(COUNT(IS, $created) => 7)`:              true,
+		`EVAL(COUNT(SS, $deleted) => 0)`:              true,
+		`EVAL(COUNT(SS, *) => 1)`:                     true,
+		`EVAL(COUNT(NTS, *) => 5)`:                    true,
+		`EVAL(COUNT(NTS.*.NSS, $created) => 1)`:       true,
+		`AND(EVAL(LEN(IS) =GT> 10), EVAL(IS.* => *))`: true,
+	}
+	for statement, want := range tests {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+
+	errs := map[string]string{
+		`EVAL(COUNT(NTS, $deleted) [1] => 2)`: "validation error: cannot specify previous value with COUNT",
+		`EVAL(SS =CONTAINS> $created)`:        "validation error: cannot use literal value '*' or action literals with =CONTAINS>",
+		`EVAL(LEN(SS, *) => 1)`:               "validation error: invalid collection expression LEN(SS, *) at offset 5",
+		`EVAL(COUNT(SS) => 1)`:                "validation error: expected COUNT(path, action) in COUNT(SS) at offset 5",
+		`EVAL(LEN(SS => 1)`:                   "validation error: invalid collection expression LEN(SS => 1) at offset 5",
+	}
+	for statement, want := range errs {
+		_, err := d.EvaluateStatement(statement)
+		if err == nil || !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("incorrect error for %s, got: %v, want: %s", statement, err, want)
+		}
+	}
+}
+
+func TestEvaluateStatementMatchQuantifiers(t *testing.T) {
+	a := &OuterType{NTS: []*NestedType{{NI: 1}, {NI: 2}, {NI: 3}}, SS: []string{"a", "b"}}
+	b := &OuterType{NTS: []*NestedType{{NI: 150}, {NI: 2}, {NI: 100}}, SS: []string{"a", "c"}}
+	d, _ := Differential(a, b)
+
+	tests := map[string]bool{
+		`EVAL(NTS.*.NI =GTE> 100)`:                              true,
+		`ANY(EVAL(NTS.*.NI =GTE> 100))`:                         true,
+		`ALL(EVAL(NTS.*.NI =GTE> 100))`:                         true,
+		`ALL(EVAL(NTS.*.NI =GT> 100))`:                          false,
+		`NONE(EVAL(NTS.*.NI =GT> 200))`:                         true,
+		`NONE(EVAL(NTS.*.NI => 150))`:                           false,
+		`all(EVAL(NTS.* [*] =!> 0))`:                            true,
+		`ALL(EVAL(NTS.*.NI [1] => *))`:                          false,
+		`ANY(EVAL(NTS.*.NI [3] => 100))`:                        true,
+		`ALL(EVAL(NTS.*.NS => *))`:                              true,
+		`ANY(EVAL(NTS.*.NS => *))`:                              false,
+		`NONE(EVAL(NTS.*.NS => *))`:                             true,
+		`EVAL(NTS.*.NS =!> "x")`:                                true,
+		`ANY(EVAL(NTS.*.NS =!> "x"))`:                           false,
+		`ALL(EVAL(SS.* => $updated))`:                           true,
+		`ALL(EVAL(COUNT(NTS, $updated) => 2))`:                  true,
+		`ALL(/* every */ EVAL(NTS.*.NI =GTE> 100),)`:            true,
+		`AND(ALL(EVAL(NTS.*.NI =GTE> 100)), EVAL(SS.1 => "c"))`: true,
+		`OR(NONE(EVAL(SS.* => "c")), ANY(EVAL(SS.* => "b")))`:   false,
+	}
+	for statement, want := range tests {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+
+	errs := map[string]string{
+		`ALL(AND(EVAL(S => 1)))`:          "validation error: expected ALL(EVAL(...)) at offset 0",
+		`ANY(EVAL(S => 1), EVAL(I => 1))`: "validation error: expected ANY(EVAL(...)) at offset 0",
+		`AND(NONE())`:                     "validation error: expected NONE(EVAL(...)) at offset 4",
+		`ALL(TRUE)`:                       "validation error: expected ALL(EVAL(...)) at offset 0",
+		`ALL EVAL(S => 1)`:                "validation error: expected ALL(EVAL(...)) at offset 0",
+	}
+	for statement, want := range errs {
+		_, err := d.EvaluateStatement(statement)
+		if err == nil || !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("incorrect error for %s, got: %v, want: %s", statement, err, want)
+		}
+	}
+}
+
+func TestEvaluateStatementScopes(t *testing.T) {
+	a := &OuterType{NTS: []*NestedType{
+		{NS: "open", NI: 1, NSS: []string{"a"}},
+		{NS: "open", NI: 2},
+		{NS: "open", NI: 3},
+	}}
+	b := &OuterType{NTS: []*NestedType{
+		{NS: "shipped", NI: 1, NSS: []string{"a", "b"}},
+		{NS: "open", NI: 20},
+		{NS: "shipped", NI: 3},
+	}}
+	d, _ := Differential(a, b)
+
+	tests := map[string]bool{
+		`EACH(NTS.*, EVAL(.NS => "shipped"))`:                                true,
+		`EACH(NTS.*, AND(EVAL(.NS => "shipped"), EVAL(.NI => *)))`:           false,
+		`AND(EVAL(NTS.*.NS => "shipped"), EVAL(NTS.*.NI => *))`:              true,
+		`EACH(NTS.*, AND(EVAL(.NS => "shipped"), EVAL(LEN(.NSS) => 2)))`:     true,
+		`EACH(NTS.*, AND(EVAL(.NI [2] => 20), EVAL(.NI =GT> 10)))`:           true,
+		`EACH(NTS.*, AND(EVAL(.NS => "shipped"), EVAL(.NI =GT> 10)))`:        false,
+		`EACH(NTS.*, AND(EVAL(.NS [*] =!> "shipped"), EVAL(. => $updated)))`: true,
+		`EACH(NTS.*, EACH(.NSS.*, EVAL(. => "b")))`:                          true,
+		`EACH(NTS.*, EACH(.NSS.*, EVAL(. => "c")))`:                          false,
+		`each(NTS.*, /* any shipped */ EVAL(.NS => "shipped"),)`:             true,
+		`EACH(NTS.1, EVAL(.NS => "shipped"))`:                                false,
+		`EACH(SS.*, EVAL(. => *))`:                                           false,
+		`OR(EACH(NTS.*, EVAL(.NI => 30)), EVAL(NTS.1.NI => 20))`:             true,
+		`AND(EACH(NTS.*, TRUE), NONE(EVAL(NTS.*.NS => "closed")))`:           true,
+		`EACH(NTS.*, ALL(EVAL(.NSS.* => *)))`:                                true,
+	}
+	for statement, want := range tests {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+
+	// elements are bound by path so map keys are never read as statements
+	type order struct {
+		Status  string
+		Carrier string
+	}
+	type orders struct {
+		Orders map[string]*order
+	}
+	d, _ = Differential(
+		&orders{Orders: map[string]*order{"a b": {Status: "open"}, "k)": {Status: "open", Carrier: "x"}, "x.y": {}}},
+		&orders{Orders: map[string]*order{"a b": {Status: "shipped"}, "k)": {Status: "open", Carrier: "y"}, "x.y": {Carrier: "z"}}},
+	)
+	keyed := map[string]bool{
+		`EVAL(Orders.*.Status => "shipped")`:                                   true,
+		`EACH(Orders.*, EVAL(.Status => "shipped"))`:                           true,
+		`EACH(Orders.*, AND(EVAL(.Status => "shipped"), EVAL(.Carrier => *)))`: false,
+		`EACH(Orders.*, AND(EVAL(.Carrier => *), EVAL(.Carrier [*] =!> "z")))`: true,
+		`EACH(Orders.*, AND(EVAL(.Carrier => "z"), EVAL(.Status => *)))`:       false,
+		`EACH(Orders.*, EACH(., EVAL(.Carrier => "y")))`:                       true,
+	}
+	for statement, want := range keyed {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+
+	errs := map[string]string{
+		`EVAL(.NS => "shipped")`:                  "validation error: relative path .NS outside of EACH at offset 5",
+		`EACH(.NTS, EVAL(S => 1))`:                "validation error: relative path .NTS outside of EACH at offset 5",
+		`EACH(NTS.*)`:                             "validation error: expected EACH(path, statement) at offset 0",
+		`EACH(NTS.*, EVAL(S => 1), EVAL(I => 1))`: "validation error: expected EACH(path, statement) at offset 0",
+		`AND(EACH(NTS.*, 1))`:                     "validation error: expected EACH(path, statement) at offset 4",
+		`EACH NTS.*`:                              "validation error: expected EACH(path, statement) at offset 0",
+	}
+	for statement, want := range errs {
+		_, err := d.EvaluateStatement(statement)
+		if err == nil || !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("incorrect error for %s, got: %v, want: %s", statement, err, want)
+		}
+	}
+}
+
+func TestEvaluateStatementNumbers(t *testing.T) {
+	type Counters struct {
+		U64 uint64
+		I   int
+		F64 float64
+	}
+	a := &Counters{U64: 1, I: 1, F64: 1}
+	b := &Counters{U64: math.MaxUint64, I: 1_000_000, F64: 0.1}
+	counters, _ := Differential(a, b)
+	// big numbers are not diffed by Differential; they arrive as external changes
+	d := NewDiffFromChanges(append(counters.Changes,
+		Change{Type: ChangeUpdate, Path: []string{"Total"}, From: big.NewInt(1), To: new(big.Int).Lsh(big.NewInt(1), 70)}))
+
+	tests := map[string]bool{
+		`EVAL(U64 => 18446744073709551615)`:         true,
+		`EVAL(U64 => 0xFFFF_FFFF_FFFF_FFFF)`:        true,
+		`EVAL(U64 => -1)`:                           false,
+		`EVAL(U64 =GT> 9223372036854775807)`:        true,
+		`EVAL(U64 =LT> 0)`:                          false,
+		`EVAL(U64 [1] => 18446744073709551615)`:     true,
+		`EVAL(I => 1e6)`:                            true,
+		`EVAL(I => 1_000_000)`:                      true,
+		`EVAL(I =GT> 999_999.5)`:                    true,
+		`EVAL(I =LTE> 999_999.5)`:                   false,
+		`EVAL(I =!> 0xF4240)`:                       false,
+		`EVAL(F64 => 0.1)`:                          true,
+		`EVAL(F64 => 1e-1)`:                         true,
+		`EVAL(F64 =GT> 0)`:                          true,
+		`EVAL(F64 =LT> 1)`:                          true,
+		`EVAL(Total => 1180591620717411303424)`:     true,
+		`EVAL(Total =GT> 1180591620717411303423.5)`: true,
+	}
+	for statement, want := range tests {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+}
+
+func TestEvaluateStatementTimes(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 30, 0, 0, time.UTC)
+	a := &OuterType{T: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	b := &OuterType{T: time.Date(2024, 3, 10, 9, 15, 0, 0, time.UTC)}
+	d, _ := Differential(a, b)
+	d.Clock = func() time.Time { return now }
+
+	tests := map[string]bool{
+		`EVAL(T => t"2024-03-10T09:15:00Z")`:                     true,
+		`EVAL(T => t"2024-03-10T09:15:00.000000000Z")`:           true,
+		`EVAL(T => t"2024-03-10T09:15")`:                         true,
+		`EVAL(T => t"@1710062100")`:                              true,
+		`EVAL(T =GT> t"2024-03-10")`:                             true,
+		`EVAL(T ["2024-03-01"] => *)`:                            false,
+		`EVAL(T [t"2024-03-01"] => *)`:                           true,
+		`EVAL(T =LT> now())`:                                     true,
+		`EVAL(T =GT> now() - d"24h")`:                            true,
+		`EVAL(T =GT> now()-d"6h")`:                               false,
+		`EVAL(T =GTE> startOfDay())`:                             true,
+		`EVAL(T =LT> startOfDay() + d"9h")`:                      false,
+		`EVAL(T => day(now()))`:                                  true,
+		`EVAL(T => day(now() - d"24h"))`:                         false,
+		`EVAL(T =!> day(now()))`:                                 false,
+		`EVAL(T => hour(t"2024-03-10T09:59:59Z"))`:               true,
+		`EVAL(T => hour(t"2024-03-10T10:00:00Z"))`:               false,
+		`EVAL(T =LT> hour(t"2024-03-10T10:00:00Z"))`:             true,
+		`EVAL(T => day(t"2024-03-09T23:00:00-12:00"))`:           true,
+		`EVAL(T [month(t"2024-03-31")] => day(t"2024-03-10"))`:   true,
+		`AND(EVAL(T => day(now())), EVAL(T =LT> now() - d"1h"))`: true,
+	}
+	for statement, want := range tests {
+		result, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, want)
+		}
+	}
+
+	errs := map[string]string{
+		`EVAL(T => t"2024-03-10 09:15")`: "invalid time 2024-03-10 09:15 at offset 11",
+		`EVAL(T => now(1))`:              "invalid time expression now(1) at offset 10",
+		`EVAL(T => week(now()))`:         "",
+		`EVAL(T => day(now()`:            "unterminated time expression at offset 10",
+		`EVAL(T => now() - d"1x")`:       "invalid duration 1x in time expression at offset 10",
+	}
+	for statement, want := range errs {
+		_, err := d.EvaluateStatement(statement)
+		if err == nil || (want != "" && err.Error() != "validation error: "+want) {
+			t.Errorf("incorrect error for %s, got: %v, want: %s", statement, err, want)
+		}
+	}
+}
+
+func TestEvaluateStatementReference(t *testing.T) {
+	d, _ := Differential(&OuterType{I: 1}, &OuterType{I: 2})
+	_, err := d.EvaluateStatement(`AND(REF(terminal), EVAL(I => 2))`)
+	if err == nil || !strings.Contains(err.Error(), "undefined reference terminal") {
+		t.Errorf("incorrect error for unresolved reference, got: %v", err)
+	}
+	if _, err := d.EvaluateStatement(`AND(REF(a b))`); err == nil {
+		t.Error("expected error for malformed reference")
+	}
+}
+
+func TestDifferentialNumbers(t *testing.T) {
+	a := map[string]interface{}{"n": json.Number("1"), "s": "a"}
+	b := map[string]interface{}{"n": json.Number("18446744073709551615"), "s": "b"}
+	d, err := Differential(a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range d.Changes {
+		want := reflect.TypeOf("")
+		if c.Path[0] == "n" {
+			want = reflect.TypeOf(json.Number(""))
+		}
+		if reflect.TypeOf(c.From) != want || reflect.TypeOf(c.To) != want {
+			t.Errorf("incorrect value types for %s, got: %T %T, want: %v", c.Path[0], c.From, c.To, want)
+		}
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(n => 18446744073709551615))`: true,
+		`AND(EVAL(n => 18446744073709551614))`: false,
+		`AND(EVAL(n [1] =GT> 1e19))`:           true,
+	}
+	for statement, want := range tests {
+		got, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	a := &OuterType{S: "Draft", I: 1, M: map[string]int{"one": 1}}
+	b := &OuterType{S: "Done", I: 2, M: map[string]int{"one": 1}}
+	d, _ := Differential(a, b)
+
+	statement := `AND(EVAL(S => "Done"), OR(EVAL(I => 3), EVAL(M.one => *)))`
+	result, trace, err := d.Explain(statement)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result {
+		t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, false)
+	}
+
+	want := []struct {
+		depth      int
+		expression string
+		matched    int
+		result     bool
+	}{
+		{0, statement, 0, false},
+		{1, `EVAL(S => "Done")`, 1, true},
+		{1, `OR(EVAL(I => 3), EVAL(M.one => *))`, 0, false},
+		{2, `EVAL(I => 3)`, 1, false},
+		{2, `EVAL(M.one => *)`, 0, false},
+	}
+	if len(trace) != len(want) {
+		t.Fatalf("incorrect trace length, got: %d, want: %d", len(trace), len(want))
+	}
+	for i, w := range want {
+		s := trace[i]
+		if s.Depth != w.depth || s.Expression != w.expression || len(s.Matched) != w.matched || s.Result != w.result {
+			t.Errorf("incorrect trace step %d, got: %+v, want: %+v", i, s, w)
+		}
+	}
+}
+
+func TestExplainEach(t *testing.T) {
+	a := &OuterType{NTS: []*NestedType{{NS: "a", NI: 1}, {NS: "b", NI: 1}}}
+	b := &OuterType{NTS: []*NestedType{{NS: "a", NI: 2}, {NS: "c", NI: 3}}}
+	d, _ := Differential(a, b)
+
+	each := `EACH(NTS.*, AND(EVAL(.NS => "c"), EVAL(.NI => *)))`
+	statement := `OR(EVAL(S => *), ` + each + `)`
+	result, trace, err := d.Explain(statement)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !result {
+		t.Errorf("incorrect result for %s, got: %t, want: %t", statement, result, true)
+	}
+
+	want := []struct {
+		depth      int
+		expression string
+		binding    string
+		matched    int
+		result     bool
+	}{
+		{0, statement, "", 0, true},
+		{1, `EVAL(S => *)`, "", 0, false},
+		{1, each, "", 0, true},
+		{2, `AND(EVAL(.NS => "c"), EVAL(.NI => *))`, "NTS.0", 0, false},
+		{3, `EVAL(.NS => "c")`, "NTS.0", 0, false},
+		{3, `EVAL(.NI => *)`, "NTS.0", 1, true},
+		{2, `AND(EVAL(.NS => "c"), EVAL(.NI => *))`, "NTS.1", 0, true},
+		{3, `EVAL(.NS => "c")`, "NTS.1", 1, true},
+		{3, `EVAL(.NI => *)`, "NTS.1", 1, true},
+	}
+	if len(trace) != len(want) {
+		t.Fatalf("incorrect trace length, got: %d, want: %d (%+v)", len(trace), len(want), trace)
+	}
+	for i, w := range want {
+		s := trace[i]
+		if s.Depth != w.depth || s.Expression != w.expression || strings.Join(s.Binding, ".") != w.binding || len(s.Matched) != w.matched || s.Result != w.result {
+			t.Errorf("incorrect trace step %d, got: %+v, want: %+v", i, s, w)
+		}
+	}
+}
@@ -81,17 +81,32 @@ func (d *Diff) getStructSliceFieldLenByName(selector string, v interface{}) (int
 		return 0, errors.New("invalid type encountered for initial reflection")
 	}
 	for _, c := range components {
-		if r.Kind() == reflect.Ptr {
-			r = reflect.Indirect(r).FieldByName(c)
-		} else if r.Kind() == reflect.Slice || r.Kind() == reflect.Array {
-			i, _ := strconv.ParseInt(c, 10, 64)
+		if r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+			r = r.Elem()
+		}
+		if r.Kind() == reflect.Slice || r.Kind() == reflect.Array {
+			i, err := strconv.ParseInt(c, 10, 64)
+			if err != nil || i < 0 || int(i) >= r.Len() {
+				return 0, errors.Errorf("invalid index %s encountered during reflection", c)
+			}
 			r = r.Index(int(i))
 		} else if r.Kind() == reflect.Map {
-			r = r.MapIndex(reflect.ValueOf(c))
+			k, ok := mapKey(r, c)
+			if !ok {
+				return 0, errors.Errorf("invalid key %s encountered during reflection", c)
+			}
+			r = r.MapIndex(k)
+		} else if r.Kind() == reflect.Struct {
+			r = r.FieldByName(c)
 		} else {
-			tmp := r.FieldByName(c)
-			r = tmp
+			return 0, errors.Errorf("cannot select %s from %s during reflection", c, r.Kind())
 		}
+		if !r.IsValid() {
+			return 0, errors.Errorf("invalid selector %s encountered during reflection", c)
+		}
+	}
+	if r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+		r = r.Elem()
 	}
 	if r.Kind() == reflect.Slice || r.Kind() == reflect.Array {
 		return r.Len(), nil
@@ -108,21 +123,68 @@ func (d *Diff) getStructFieldByName(selector string, v interface{}) (interface{}
 		return 0, errors.New("invalid type encountered for initial reflection")
 	}
 	for _, c := range components {
-		if r.Kind() == reflect.Ptr {
-			r = reflect.Indirect(r).FieldByName(c)
-		} else if r.Kind() == reflect.Slice || r.Kind() == reflect.Array {
-			i, _ := strconv.ParseInt(c, 10, 64)
+		if r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface {
+			r = r.Elem()
+		}
+		if r.Kind() == reflect.Slice || r.Kind() == reflect.Array {
+			i, err := strconv.ParseInt(c, 10, 64)
+			if err != nil || i < 0 || int(i) >= r.Len() {
+				return 0, errors.Errorf("invalid index %s encountered during reflection", c)
+			}
 			r = r.Index(int(i))
 		} else if r.Kind() == reflect.Map {
-			r = r.MapIndex(reflect.ValueOf(c))
+			k, ok := mapKey(r, c)
+			if !ok {
+				return 0, errors.Errorf("invalid key %s encountered during reflection", c)
+			}
+			r = r.MapIndex(k)
+		} else if r.Kind() == reflect.Struct {
+			r = r.FieldByName(c)
 		} else {
-			tmp := r.FieldByName(c)
-			r = tmp
+			return 0, errors.Errorf("cannot select %s from %s during reflection", c, r.Kind())
+		}
+		if !r.IsValid() {
+			return 0, errors.Errorf("invalid selector %s encountered during reflection", c)
 		}
 	}
 	return r.Interface(), nil
 }
 
+// expandIdentifier splits the identifier into its path components replacing
+// the $first and $last modifiers with the index of the first and last element
+// of the array or slice they follow in the new value. Relative paths are
+// resolved against the element bound by an enclosing EACH expression.
+func (d *Diff) expandIdentifier(identifier string) []string {
+	identifierParts := strings.Split(identifier, ".")
+	if isRelativePath(identifier) && d.binding != nil {
+		// relative paths continue the path of the element bound by EACH
+		identifierParts = appendPath(d.binding)
+		if identifier != "." {
+			identifierParts = append(identifierParts, strings.Split(identifier[1:], ".")...)
+		}
+	}
+	for i := 1; i <= len(identifierParts); i++ {
+		cumulativeParts := strings.Join(identifierParts[:i], ".")
+		field, _ := d.getStructFieldByName(cumulativeParts, d.New)
+		fieldKind := reflect.ValueOf(field).Kind()
+		if fieldKind == reflect.Array || fieldKind == reflect.Slice {
+			length, _ := d.getStructSliceFieldLenByName(cumulativeParts, d.New)
+			if length > 0 {
+				if len(identifierParts) > i {
+					if identifierParts[i] == "$first" {
+						identifierParts[i] = "0"
+						i++
+					} else if identifierParts[i] == "$last" {
+						identifierParts[i] = fmt.Sprint(length - 1)
+						i++
+					}
+				}
+			}
+		}
+	}
+	return identifierParts
+}
+
 // validateTransformStack ensures that the transform stack is valid for
 // operation. The transform stack represents the actual operations/comparisons
 // to be executed (the portions of the statement that is contained in EVAL
@@ -131,36 +193,45 @@ func (d *Diff) getStructFieldByName(selector string, v interface{}) (interface{}
 // type and semantically correct.
 func validateTransformStack(stack *tokenStack) error {
 	if stack.size() == 3 { // Standard expression - assuming previous value not present expecting 3 components
-		if stack.Stack[2].ttype != cIDENT {
+		if stack.Stack[2].ttype != cIDENT && stack.Stack[2].ttype != cAGGREGATE {
 			return errors.Errorf("validation error: expected identifier got %s", stack.Stack[2].tliteral)
 		}
-		if stack.Stack[1].ttype != cGOESTO && stack.Stack[1].ttype != cNOTGOESTO && stack.Stack[1].ttype != cGOESGT && stack.Stack[1].ttype != cGOESGTE && stack.Stack[1].ttype != cGOESLT && stack.Stack[1].ttype != cGOESLTE {
+		if stack.Stack[1].ttype != cGOESTO && stack.Stack[1].ttype != cNOTGOESTO && stack.Stack[1].ttype != cGOESGT && stack.Stack[1].ttype != cGOESGTE && stack.Stack[1].ttype != cGOESLT && stack.Stack[1].ttype != cGOESLTE && stack.Stack[1].ttype != cSTARTSWITH && stack.Stack[1].ttype != cENDSWITH && stack.Stack[1].ttype != cCONTAINS {
 			return errors.Errorf("validation error: expected operator got %s", stack.Stack[1].tliteral)
 		}
-		if stack.Stack[0].ttype != cSTRING && stack.Stack[0].ttype != cINT && stack.Stack[0].ttype != cFLOAT && stack.Stack[0].ttype != cASTERISK && stack.Stack[0].ttype != cDURATION && stack.Stack[0].ttype != cTIME && stack.Stack[0].ttype != cTRUE && stack.Stack[0].ttype != cFALSE && stack.Stack[0].ttype != cNIL && stack.Stack[0].ttype != cCREATED && stack.Stack[0].ttype != cDELETED {
+		if stack.Stack[0].ttype != cSTRING && stack.Stack[0].ttype != cINT && stack.Stack[0].ttype != cFLOAT && stack.Stack[0].ttype != cASTERISK && stack.Stack[0].ttype != cDURATION && stack.Stack[0].ttype != cTIME && stack.Stack[0].ttype != cTIMEEXPR && stack.Stack[0].ttype != cTRUE && stack.Stack[0].ttype != cFALSE && stack.Stack[0].ttype != cNIL && stack.Stack[0].ttype != cCREATED && stack.Stack[0].ttype != cDELETED && stack.Stack[0].ttype != cUPDATED && stack.Stack[0].ttype != cMOVED && stack.Stack[0].ttype != cCONFLICT {
 			return errors.Errorf("validation error: expected literal got %s", stack.Stack[0].tliteral)
 		}
 		// If operator is comparison literal cannot be 'nil' or '*'
 		if stack.Stack[1].ttype == cGOESGT || stack.Stack[1].ttype == cGOESGTE || stack.Stack[1].ttype == cGOESLT || stack.Stack[1].ttype == cGOESLTE {
-			if stack.Stack[0].ttype == cASTERISK || stack.Stack[0].ttype == cNIL || stack.Stack[0].ttype == cCREATED || stack.Stack[0].ttype == cDELETED {
-				return errors.New("validation error: cannot use literal values '*' or 'nil' with comparison operators")
+			if stack.Stack[0].ttype == cASTERISK || stack.Stack[0].ttype == cNIL || stack.Stack[0].ttype == cCREATED || stack.Stack[0].ttype == cDELETED || stack.Stack[0].ttype == cUPDATED || stack.Stack[0].ttype == cMOVED || stack.Stack[0].ttype == cCONFLICT {
+				return errors.New("validation error: cannot use literal values '*', 'nil' or action literals with comparison operators")
 			}
 		}
+		if (stack.Stack[1].ttype == cSTARTSWITH || stack.Stack[1].ttype == cENDSWITH) && stack.Stack[0].ttype != cSTRING {
+			return errors.Errorf("validation error: expected string literal with %s got %s", stack.Stack[1].ttype, stack.Stack[0].tliteral)
+		}
+		if stack.Stack[1].ttype == cCONTAINS && (stack.Stack[0].ttype == cASTERISK || stack.Stack[0].ttype == cCREATED || stack.Stack[0].ttype == cDELETED || stack.Stack[0].ttype == cUPDATED || stack.Stack[0].ttype == cMOVED || stack.Stack[0].ttype == cCONFLICT) {
+			return errors.Errorf("validation error: cannot use literal value '*' or action literals with %s", stack.Stack[1].ttype)
+		}
 	} else if stack.size() == 4 { // Previous value - assuming previous value present expecting 4 components
-		if stack.Stack[3].ttype != cIDENT {
+		if stack.Stack[3].ttype != cIDENT && stack.Stack[3].ttype != cAGGREGATE {
 			return errors.Errorf("validation error: expected identifier got %s", stack.Stack[3].tliteral)
 		}
-		if stack.Stack[2].ttype != cSTRING && stack.Stack[2].ttype != cINT && stack.Stack[2].ttype != cFLOAT && stack.Stack[2].ttype != cASTERISK && stack.Stack[2].ttype != cDURATION && stack.Stack[2].ttype != cTIME && stack.Stack[2].ttype != cTRUE && stack.Stack[2].ttype != cFALSE && stack.Stack[2].ttype != cNIL {
+		if stack.Stack[3].ttype == cAGGREGATE && strings.HasPrefix(stack.Stack[3].tliteral, aggregateCount+"(") {
+			return errors.New("validation error: cannot specify previous value with COUNT")
+		}
+		if stack.Stack[2].ttype != cSTRING && stack.Stack[2].ttype != cINT && stack.Stack[2].ttype != cFLOAT && stack.Stack[2].ttype != cASTERISK && stack.Stack[2].ttype != cDURATION && stack.Stack[2].ttype != cTIME && stack.Stack[2].ttype != cTIMEEXPR && stack.Stack[2].ttype != cTRUE && stack.Stack[2].ttype != cFALSE && stack.Stack[2].ttype != cNIL {
 			return errors.Errorf("validation error: expected literal got %s", stack.Stack[2].tliteral)
 		}
-		if stack.Stack[1].ttype != cGOESTO && stack.Stack[1].ttype != cNOTGOESTO && stack.Stack[1].ttype != cGOESGT && stack.Stack[1].ttype != cGOESGTE && stack.Stack[1].ttype != cGOESLT && stack.Stack[1].ttype != cGOESLTE {
+		if stack.Stack[1].ttype != cGOESTO && stack.Stack[1].ttype != cNOTGOESTO && stack.Stack[1].ttype != cGOESGT && stack.Stack[1].ttype != cGOESGTE && stack.Stack[1].ttype != cGOESLT && stack.Stack[1].ttype != cGOESLTE && stack.Stack[1].ttype != cSTARTSWITH && stack.Stack[1].ttype != cENDSWITH && stack.Stack[1].ttype != cCONTAINS {
 			return errors.Errorf("validation error: expected operator got %s", stack.Stack[1].tliteral)
 		}
-		if stack.Stack[0].ttype != cSTRING && stack.Stack[0].ttype != cINT && stack.Stack[0].ttype != cFLOAT && stack.Stack[0].ttype != cASTERISK && stack.Stack[0].ttype != cDURATION && stack.Stack[0].ttype != cTIME && stack.Stack[0].ttype != cTRUE && stack.Stack[0].ttype != cFALSE && stack.Stack[0].ttype != cNIL {
+		if stack.Stack[0].ttype != cSTRING && stack.Stack[0].ttype != cINT && stack.Stack[0].ttype != cFLOAT && stack.Stack[0].ttype != cASTERISK && stack.Stack[0].ttype != cDURATION && stack.Stack[0].ttype != cTIME && stack.Stack[0].ttype != cTIMEEXPR && stack.Stack[0].ttype != cTRUE && stack.Stack[0].ttype != cFALSE && stack.Stack[0].ttype != cNIL {
 			// If length of stack is 4 then assume using previous value; cannot
-			// use deleted or created with previous value
-			if stack.Stack[0].ttype == cCREATED || stack.Stack[0].ttype == cDELETED {
-				return errors.New("validation error: cannot specify action literal of $created or $deleted when using previous value")
+			// use action literals with previous value
+			if stack.Stack[0].ttype == cCREATED || stack.Stack[0].ttype == cDELETED || stack.Stack[0].ttype == cUPDATED || stack.Stack[0].ttype == cMOVED || stack.Stack[0].ttype == cCONFLICT {
+				return errors.New("validation error: cannot specify action literal of $created, $deleted, $updated, $moved or $conflict when using previous value")
 			}
 			return errors.Errorf("validation error: expected literal got %s", stack.Stack[0].tliteral)
 		}
@@ -170,6 +241,12 @@ func validateTransformStack(stack *tokenStack) error {
 				return errors.New("validation error: cannot use literal values '*' or 'nil' with comparison operators")
 			}
 		}
+		if (stack.Stack[1].ttype == cSTARTSWITH || stack.Stack[1].ttype == cENDSWITH) && stack.Stack[0].ttype != cSTRING {
+			return errors.Errorf("validation error: expected string literal with %s got %s", stack.Stack[1].ttype, stack.Stack[0].tliteral)
+		}
+		if stack.Stack[1].ttype == cCONTAINS && stack.Stack[0].ttype == cASTERISK {
+			return errors.Errorf("validation error: cannot use literal value '*' or action literals with %s", stack.Stack[1].ttype)
+		}
 	} else {
 		return errors.New("validation error: invalid number of arguments in eval")
 	}
@@ -177,13 +254,118 @@ func validateTransformStack(stack *tokenStack) error {
 	return nil
 }
 
+// isStringOperator returns true if the token type t is an operator that applies
+// to strings.
+func isStringOperator(t tokenType) bool {
+	return t == cSTARTSWITH || t == cENDSWITH || t == cCONTAINS
+}
+
+// validateEvalArgs validates the tokens of an EVAL expression, in the order
+// they appear, ignoring comments and the brackets of the previous value.
+func validateEvalArgs(args []*token) error {
+	stack := &tokenStack{}
+	for i := len(args) - 1; i >= 0; i-- {
+		switch args[i].ttype {
+		case cCOMMENT, cLBRACKET, cRBRACKET, cCOMMA:
+			continue
+		}
+		stack.push(args[i])
+	}
+	return validateTransformStack(stack)
+}
+
+// matchChanges returns the changes of the Diff, d, whose path matches the
+// identifier after expansion of any modifiers.
+func (d *Diff) matchChanges(identifier string) Changes {
+	expandedPath := d.expandIdentifier(identifier)
+
+	var matchedChanges Changes
+	for _, c := range d.Changes {
+		if wildcardPathMatch(expandedPath, c.Path) {
+			matchedChanges = append(matchedChanges, c)
+		}
+	}
+	return matchedChanges
+}
+
+// identifierChanges returns the expanded path of the identifier of an EVAL
+// expression, tok, along with the changes it is compared to: the changes
+// matching the path or, for a collection expression, the changes it yields.
+func (d *Diff) identifierChanges(tok *token) ([]string, Changes) {
+	if tok.ttype == cAGGREGATE {
+		a, err := parseAggregate(tok.tliteral)
+		if err != nil {
+			return nil, nil
+		}
+		return d.expandIdentifier(a.path), d.aggregateChanges(a)
+	}
+	return d.expandIdentifier(tok.tliteral), d.matchChanges(tok.tliteral)
+}
+
+// comparedChanges returns the matched changes an EVAL expression with the
+// literal is compared to. Moves leave the value of an element unchanged so they
+// are only compared to the $moved literal.
+func comparedChanges(matched Changes, literal *token) Changes {
+	if literal.ttype == cMOVED {
+		return matched
+	}
+	var result Changes
+	for _, c := range matched {
+		if c.Type != ChangeMove {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
 // evaluateTransformStack evaluates the transform stack which represents the
 // actual comparison operations inside EVAL expressions. This function returns
 // the validity of the expression provided in the transform stack as either true
 // or false.
 func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
-	var identifier, previous, operator, literal *token
+	identifier, previous, operator, literal, ok := popTransformStack(stack)
+	if !ok {
+		return false // TODO (cbergoon): error here?
+	}
+
+	expandedPath, matchedChanges := d.identifierChanges(identifier)
+	matchedChanges = comparedChanges(matchedChanges, literal)
+	return evaluateChanges(d, identifier, expandedPath, matchedChanges, previous, operator, literal)
+}
+
+// evaluateMatchQuantifier evaluates the transform stack of an EVAL expression
+// enclosed by the quantifier ANY, ALL or NONE against each of the changes it
+// matches separately. The result is whether any, all or none of the changes
+// satisfy the expression; when no change matches ANY does not hold while ALL
+// and NONE hold.
+func evaluateMatchQuantifier(quantifier tokenType, stack *tokenStack, d *Diff) bool {
+	identifier, previous, operator, literal, ok := popTransformStack(stack)
+	if !ok {
+		return false
+	}
 
+	expandedPath, matchedChanges := d.identifierChanges(identifier)
+	matchedChanges = comparedChanges(matchedChanges, literal)
+	satisfied := 0
+	for _, mc := range matchedChanges {
+		if evaluateChanges(d, identifier, expandedPath, Changes{mc}, previous, operator, literal) {
+			satisfied++
+		}
+	}
+	switch quantifier {
+	case cANY:
+		return satisfied > 0
+	case cALL:
+		return satisfied == len(matchedChanges)
+	case cNONE:
+		return satisfied == 0
+	}
+	return false
+}
+
+// popTransformStack returns the components of the transform stack of an EVAL
+// expression; previous is nil if the expression has no previous value.
+func popTransformStack(stack *tokenStack) (identifier, previous, operator, literal *token, ok bool) {
 	if stack.size() == 3 {
 		identifier = stack.pop()
 		operator = stack.pop()
@@ -194,39 +376,24 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 		operator = stack.pop()
 		literal = stack.pop()
 	} else {
-		return false // TODO (cbergoon): error here?
+		return nil, nil, nil, nil, false
 	}
+	return identifier, previous, operator, literal, true
+}
 
-	// rewrite/expand expression
-	exprChangeIdentifier := identifier
-
-	identifierParts := strings.Split(exprChangeIdentifier.tliteral, ".")
-	for i := 1; i <= len(identifierParts); i++ {
-		cumulativeParts := strings.Join(identifierParts[:i], ".")
-		field, _ := d.getStructFieldByName(cumulativeParts, d.New)
-		fieldKind := reflect.ValueOf(field).Kind()
-		if fieldKind == reflect.Array || fieldKind == reflect.Slice {
-			length, _ := d.getStructSliceFieldLenByName(cumulativeParts, d.New)
-			if length > 0 {
-				if len(identifierParts) > i {
-					if identifierParts[i] == "$first" {
-						identifierParts[i] = "0"
-						i++
-					} else if identifierParts[i] == "$last" {
-						identifierParts[i] = fmt.Sprint(length - 1)
-						i++
-					}
+// evaluateChanges evaluates the components of an EVAL expression against the
+// changes matched by its identifier returning true if any change satisfies the
+// expression.
+func evaluateChanges(d *Diff, identifier *token, expandedPath []string, matchedChanges Changes, previous, operator, literal *token) bool {
+	// =CONTAINS> tests the elements of a collection rather than its changes
+	if operator.ttype == cCONTAINS && identifier.ttype == cIDENT {
+		if collections := d.collections(expandedPath); len(collections) > 0 {
+			for _, c := range collections {
+				if d.containsChange(c, matchedChanges, previous, literal) {
+					return true
 				}
 			}
-		}
-	}
-
-	expandedPath := identifierParts
-
-	var matchedChanges Changes
-	for _, c := range d.Changes {
-		if wildcardPathMatch(expandedPath, c.Path) {
-			matchedChanges = append(matchedChanges, c)
+			return false
 		}
 	}
 
@@ -240,25 +407,12 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 			previousConditionValid := true
 			if previous != nil {
 				previousConditionValid = false
-				if previous.ttype == cINT {
-					i, err := strconv.ParseInt(previous.tliteral, 10, 64)
-					if err != nil {
-
-					}
-					if i == cast.ToInt64(mc.From) {
-						previousConditionValid = true
-					}
-				} else if previous.ttype == cFLOAT {
-					i, err := strconv.ParseFloat(previous.tliteral, 64)
-					if err != nil {
-
-					}
-					if i == cast.ToFloat64(mc.From) {
+				if previous.ttype == cINT || previous.ttype == cFLOAT {
+					if c, ok := compareNumber(mc.From, previous); ok && c == 0 {
 						previousConditionValid = true
 					}
 				} else if previous.ttype == cSTRING {
-					s := previous.tliteral
-					if s == cast.ToString(mc.From) {
+					if c, ok := compareString(mc.From, previous); ok && c == 0 {
 						previousConditionValid = true
 					}
 				} else if previous.ttype == cDURATION {
@@ -269,11 +423,8 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 					if d == cast.ToDuration(mc.From) {
 						previousConditionValid = true
 					}
-				} else if previous.ttype == cTIME {
-					t, err := time.Parse(time.RFC3339, previous.tliteral)
-					if err != nil {
-					}
-					if t.Equal(cast.ToTime(mc.From)) {
+				} else if previous.ttype == cTIME || previous.ttype == cTIMEEXPR {
+					if c, ok := d.compareTime(mc.From, previous); ok && c == 0 {
 						previousConditionValid = true
 					}
 				} else if previous.ttype == cTRUE {
@@ -297,25 +448,12 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 
 			if previousConditionValid {
 				if operator.ttype == cGOESTO {
-					if literal.ttype == cINT {
-						i, err := strconv.ParseInt(literal.tliteral, 10, 64)
-						if err != nil {
-
-						}
-						if i == cast.ToInt64(mc.To) {
-							foundValidChange = true
-						}
-					} else if literal.ttype == cFLOAT {
-						i, err := strconv.ParseFloat(literal.tliteral, 64)
-						if err != nil {
-
-						}
-						if i == cast.ToFloat64(mc.To) {
+					if literal.ttype == cINT || literal.ttype == cFLOAT {
+						if c, ok := compareNumber(mc.To, literal); ok && c == 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cSTRING {
-						s := literal.tliteral
-						if s == cast.ToString(mc.To) {
+						if c, ok := compareString(mc.To, literal); ok && c == 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cDURATION {
@@ -326,12 +464,8 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 						if d == cast.ToDuration(mc.To) {
 							foundValidChange = true
 						}
-					} else if literal.ttype == cTIME {
-						t, err := time.Parse(time.RFC3339, literal.tliteral)
-						if err != nil {
-
-						}
-						if t.Equal(cast.ToTime(mc.To)) {
+					} else if literal.ttype == cTIME || literal.ttype == cTIMEEXPR {
+						if c, ok := d.compareTime(mc.To, literal); ok && c == 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cTRUE {
@@ -353,34 +487,33 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 						// therefore true
 						foundValidChange = true
 					} else if literal.ttype == cCREATED {
-						if mc.Type == "create" {
+						if mc.Type == ChangeCreate {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cDELETED {
-						if mc.Type == "delete" {
+						if mc.Type == ChangeDelete {
 							foundValidChange = true
 						}
-					}
-				} else if operator.ttype == cGOESGT {
-					if literal.ttype == cINT {
-						i, err := strconv.ParseInt(literal.tliteral, 10, 64)
-						if err != nil {
-
+					} else if literal.ttype == cUPDATED {
+						if mc.Type == ChangeUpdate {
+							foundValidChange = true
 						}
-						if cast.ToInt64(mc.To) > i {
+					} else if literal.ttype == cMOVED {
+						if mc.Type == ChangeMove {
 							foundValidChange = true
 						}
-					} else if literal.ttype == cFLOAT {
-						i, err := strconv.ParseFloat(literal.tliteral, 64)
-						if err != nil {
-
+					} else if literal.ttype == cCONFLICT {
+						if mc.Type == ChangeConflict {
+							foundValidChange = true
 						}
-						if cast.ToFloat64(mc.To) > i {
+					}
+				} else if operator.ttype == cGOESGT {
+					if literal.ttype == cINT || literal.ttype == cFLOAT {
+						if c, ok := compareNumber(mc.To, literal); ok && c > 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cSTRING {
-						s := literal.tliteral
-						if cast.ToString(mc.To) > s {
+						if c, ok := compareString(mc.To, literal); ok && c > 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cDURATION {
@@ -391,35 +524,18 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 						if cast.ToDuration(mc.To) > d {
 							foundValidChange = true
 						}
-					} else if literal.ttype == cTIME {
-						t, err := time.Parse(time.RFC3339, literal.tliteral)
-						if err != nil {
-
-						}
-						if cast.ToTime(mc.To).After(t) {
+					} else if literal.ttype == cTIME || literal.ttype == cTIMEEXPR {
+						if c, ok := d.compareTime(mc.To, literal); ok && c > 0 {
 							foundValidChange = true
 						}
 					}
 				} else if operator.ttype == cGOESGTE {
-					if literal.ttype == cINT {
-						i, err := strconv.ParseInt(literal.tliteral, 10, 64)
-						if err != nil {
-
-						}
-						if cast.ToInt64(mc.To) >= i {
-							foundValidChange = true
-						}
-					} else if literal.ttype == cFLOAT {
-						i, err := strconv.ParseFloat(literal.tliteral, 64)
-						if err != nil {
-
-						}
-						if cast.ToFloat64(mc.To) >= i {
+					if literal.ttype == cINT || literal.ttype == cFLOAT {
+						if c, ok := compareNumber(mc.To, literal); ok && c >= 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cSTRING {
-						s := literal.tliteral
-						if cast.ToString(mc.To) >= s {
+						if c, ok := compareString(mc.To, literal); ok && c >= 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cDURATION {
@@ -430,35 +546,18 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 						if cast.ToDuration(mc.To) >= d {
 							foundValidChange = true
 						}
-					} else if literal.ttype == cTIME {
-						t, err := time.Parse(time.RFC3339, literal.tliteral)
-						if err != nil {
-
-						}
-						if cast.ToTime(mc.To).After(t) || t.Equal(cast.ToTime(mc.To)) {
+					} else if literal.ttype == cTIME || literal.ttype == cTIMEEXPR {
+						if c, ok := d.compareTime(mc.To, literal); ok && c >= 0 {
 							foundValidChange = true
 						}
 					}
 				} else if operator.ttype == cGOESLT {
-					if literal.ttype == cINT {
-						i, err := strconv.ParseInt(literal.tliteral, 10, 64)
-						if err != nil {
-
-						}
-						if cast.ToInt64(mc.To) < i {
-							foundValidChange = true
-						}
-					} else if literal.ttype == cFLOAT {
-						i, err := strconv.ParseFloat(literal.tliteral, 64)
-						if err != nil {
-
-						}
-						if cast.ToFloat64(mc.To) < i {
+					if literal.ttype == cINT || literal.ttype == cFLOAT {
+						if c, ok := compareNumber(mc.To, literal); ok && c < 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cSTRING {
-						s := literal.tliteral
-						if cast.ToString(mc.To) < s {
+						if c, ok := compareString(mc.To, literal); ok && c < 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cDURATION {
@@ -469,35 +568,18 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 						if cast.ToDuration(mc.To) < d {
 							foundValidChange = true
 						}
-					} else if literal.ttype == cTIME {
-						t, err := time.Parse(time.RFC3339, literal.tliteral)
-						if err != nil {
-
-						}
-						if cast.ToTime(mc.To).Before(t) {
+					} else if literal.ttype == cTIME || literal.ttype == cTIMEEXPR {
+						if c, ok := d.compareTime(mc.To, literal); ok && c < 0 {
 							foundValidChange = true
 						}
 					}
 				} else if operator.ttype == cGOESLTE {
-					if literal.ttype == cINT {
-						i, err := strconv.ParseInt(literal.tliteral, 10, 64)
-						if err != nil {
-
-						}
-						if cast.ToInt64(mc.To) <= i {
-							foundValidChange = true
-						}
-					} else if literal.ttype == cFLOAT {
-						i, err := strconv.ParseFloat(literal.tliteral, 64)
-						if err != nil {
-
-						}
-						if cast.ToFloat64(mc.To) <= i {
+					if literal.ttype == cINT || literal.ttype == cFLOAT {
+						if c, ok := compareNumber(mc.To, literal); ok && c <= 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cSTRING {
-						s := literal.tliteral
-						if cast.ToString(mc.To) <= s {
+						if c, ok := compareString(mc.To, literal); ok && c <= 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cDURATION {
@@ -508,35 +590,22 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 						if cast.ToDuration(mc.To) <= d {
 							foundValidChange = true
 						}
-					} else if literal.ttype == cTIME {
-						t, err := time.Parse(time.RFC3339, literal.tliteral)
-						if err != nil {
-
-						}
-						if cast.ToTime(mc.To).Before(t) || t.Equal(cast.ToTime(mc.To)) {
+					} else if literal.ttype == cTIME || literal.ttype == cTIMEEXPR {
+						if c, ok := d.compareTime(mc.To, literal); ok && c <= 0 {
 							foundValidChange = true
 						}
 					}
+				} else if isStringOperator(operator.ttype) {
+					if matchString(operator.ttype, mc.To, literal) {
+						foundValidChange = true
+					}
 				} else if operator.ttype == cNOTGOESTO {
-					if literal.ttype == cINT {
-						i, err := strconv.ParseInt(literal.tliteral, 10, 64)
-						if err != nil {
-
-						}
-						if i != cast.ToInt64(mc.To) {
-							foundValidChange = true
-						}
-					} else if literal.ttype == cFLOAT {
-						i, err := strconv.ParseFloat(literal.tliteral, 64)
-						if err != nil {
-
-						}
-						if i != cast.ToFloat64(mc.To) {
+					if literal.ttype == cINT || literal.ttype == cFLOAT {
+						if c, ok := compareNumber(mc.To, literal); !ok || c != 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cSTRING {
-						s := literal.tliteral
-						if s != cast.ToString(mc.To) {
+						if c, ok := compareString(mc.To, literal); !ok || c != 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cDURATION {
@@ -547,12 +616,8 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 						if d != cast.ToDuration(mc.To) {
 							foundValidChange = true
 						}
-					} else if literal.ttype == cTIME {
-						t, err := time.Parse(time.RFC3339, literal.tliteral)
-						if err != nil {
-
-						}
-						if !t.Equal(cast.ToTime(mc.To)) {
+					} else if literal.ttype == cTIME || literal.ttype == cTIMEEXPR {
+						if c, ok := d.compareTime(mc.To, literal); !ok || c != 0 {
 							foundValidChange = true
 						}
 					} else if literal.ttype == cTRUE {
@@ -582,7 +647,7 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 					} else if literal.ttype == cCREATED {
 						notFound := true
 						for _, ch := range matchedChanges {
-							if ch.Type == "create" {
+							if ch.Type == ChangeCreate {
 								if wildcardPathMatch(expandedPath, ch.Path) {
 									notFound = false
 								}
@@ -594,7 +659,43 @@ func evaluateTransformStack(stack *tokenStack, d *Diff) bool {
 					} else if literal.ttype == cDELETED {
 						notFound := true
 						for _, ch := range matchedChanges {
-							if ch.Type == "delete" {
+							if ch.Type == ChangeDelete {
+								if wildcardPathMatch(expandedPath, ch.Path) {
+									notFound = false
+								}
+							}
+						}
+						if notFound {
+							foundValidChange = notFound
+						}
+					} else if literal.ttype == cUPDATED {
+						notFound := true
+						for _, ch := range matchedChanges {
+							if ch.Type == ChangeUpdate {
+								if wildcardPathMatch(expandedPath, ch.Path) {
+									notFound = false
+								}
+							}
+						}
+						if notFound {
+							foundValidChange = notFound
+						}
+					} else if literal.ttype == cMOVED {
+						notFound := true
+						for _, ch := range matchedChanges {
+							if ch.Type == ChangeMove {
+								if wildcardPathMatch(expandedPath, ch.Path) {
+									notFound = false
+								}
+							}
+						}
+						if notFound {
+							foundValidChange = notFound
+						}
+					} else if literal.ttype == cCONFLICT {
+						notFound := true
+						for _, ch := range matchedChanges {
+							if ch.Type == ChangeConflict {
 								if wildcardPathMatch(expandedPath, ch.Path) {
 									notFound = false
 								}
@@ -640,6 +741,9 @@ func validate(statement string) error {
 		tokenCount++
 		switch token.ttype {
 		case cILLEGAL:
+			if token.terr != nil {
+				return errors.Wrap(token.terr, "validation error")
+			}
 			return errors.Errorf("validation error: illegal token %s", token.tliteral)
 		case cAND:
 			fallthrough
@@ -647,8 +751,38 @@ func validate(statement string) error {
 			fallthrough
 		case cEVAL:
 			fallthrough
+		case cANYSTEP:
+			fallthrough
+		case cALLSTEPS:
+			fallthrough
+		case cEVENTUALLY:
+			fallthrough
 		case cLPAREN:
 			ts.push(token)
+		case cANY, cALL, cNONE:
+			if err := validateMatchQuantifier(token, *lexer); err != nil {
+				return err
+			}
+			ts.push(token)
+		case cEACH:
+			if err := validateScope(token, *lexer); err != nil {
+				return err
+			}
+			ts.push(token)
+		case cIDENT, cAGGREGATE:
+			path := token.tliteral
+			if token.ttype == cAGGREGATE {
+				if a, err := parseAggregate(path); err == nil {
+					path = a.path
+				}
+			}
+			if isRelativePath(path) && !inScope(ts) {
+				return errors.Errorf("validation error: relative path %s outside of EACH at offset %d", path, token.tpos)
+			}
+		case cREF:
+			if err := validateReference(lexer); err != nil {
+				return err
+			}
 		case cRPAREN:
 			if ts.isEmpty() {
 				isBalanced = false
@@ -658,7 +792,7 @@ func validate(statement string) error {
 					isBalanced = false
 				}
 				expectedOpDelimeter := ts.pop()
-				if expectedOpDelimeter.ttype != cAND && expectedOpDelimeter.ttype != cOR && expectedOpDelimeter.ttype != cEVAL {
+				if expectedOpDelimeter == nil || !isOperation(expectedOpDelimeter.ttype) {
 					isOpComplete = false
 				}
 			}
@@ -682,11 +816,92 @@ func validate(statement string) error {
 	return nil
 }
 
+// inScope reports whether a relative path read while the tokens of ts are open
+// is within the statement of an EACH expression rather than its scope.
+func inScope(ts *tokenStack) bool {
+	n := ts.size()
+	for i := n - 1; i > 0; i-- {
+		if ts.Stack[i-1].ttype == cEACH && ts.Stack[i].ttype == cLPAREN {
+			// the scope directly follows the parenthesis
+			if i != n-1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validateReference ensures that the tokens following REF name a statement,
+// e.g. REF(name).
+func validateReference(lexer *lexer) error {
+	open, name, close := lexer.nextToken(), lexer.nextToken(), lexer.nextToken()
+	if open.ttype != cLPAREN || name.ttype != cIDENT || close.ttype != cRPAREN {
+		return errors.Errorf("validation error: expected REF(name) at offset %d", open.tpos)
+	}
+	return nil
+}
+
+// validateMatchQuantifier ensures that the tokens read by the lexer l following
+// the quantifier q enclose a single EVAL expression, e.g. ALL(EVAL(...)). The
+// lexer is a copy so the tokens are read again by validate.
+func validateMatchQuantifier(q *token, l lexer) error {
+	next := func() *token {
+		tok := l.nextToken()
+		for tok.ttype == cCOMMENT {
+			tok = l.nextToken()
+		}
+		return tok
+	}
+	invalid := errors.Errorf("validation error: expected %s(EVAL(...)) at offset %d", q.ttype, q.tpos)
+	if next().ttype != cLPAREN || next().ttype != cEVAL || next().ttype != cLPAREN {
+		return invalid
+	}
+	tok := next()
+	for tok.ttype != cRPAREN {
+		if tok.ttype == cEOF || tok.ttype == cLPAREN {
+			return invalid
+		}
+		tok = next()
+	}
+	if tok = next(); tok.ttype == cCOMMA {
+		tok = next()
+	}
+	if tok.ttype != cRPAREN {
+		return invalid
+	}
+	return nil
+}
+
+// isOperation returns true if the token type t may precede a parenthesized
+// argument list.
+func isOperation(t tokenType) bool {
+	return t == cAND || t == cOR || t == cEVAL || t == cEACH || isStepQuantifier(t) || isMatchQuantifier(t)
+}
+
+// isMatchQuantifier returns true if the token type t quantifies an EVAL
+// expression over the changes it matches.
+func isMatchQuantifier(t tokenType) bool {
+	return t == cANY || t == cALL || t == cNONE
+}
+
+// isStepQuantifier returns true if the token type t quantifies a statement over
+// the steps of a History.
+func isStepQuantifier(t tokenType) bool {
+	return t == cANYSTEP || t == cALLSTEPS || t == cEVENTUALLY
+}
+
 // evaluate executes the the 'statement' against the Diff 'd' provided. Returns
 // the boolean result of the statement and an error if encountered. Evaluate
 // manages the entire execution and handles validation as well as the execution
 // of the individual transform stacks within the statement.
 func evaluate(statement string, d *Diff) (bool, error) {
+	return evaluateTrace(statement, d, nil)
+}
+
+// evaluateTrace executes the 'statement' against the Diff 'd' in the same
+// manner as evaluate. If trace is not nil the result of each operation is
+// appended to it in the order the operations complete.
+func evaluateTrace(statement string, d *Diff, trace *[]TraceStep) (bool, error) {
 	ts := &tokenStack{}
 
 	lexer := newLexer(statement)
@@ -694,6 +909,31 @@ func evaluate(statement string, d *Diff) (bool, error) {
 	tok := lexer.nextToken()
 	for tok.ttype != cEOF {
 
+		if tok.ttype == cCOMMENT { // comments do not contribute to the result
+			tok = lexer.nextToken()
+			continue
+		}
+
+		if tok.ttype == cEACH { // the statement of EACH is evaluated for each element
+			depth := 0
+			for _, t := range ts.Stack {
+				if isOperation(t.ttype) {
+					depth++
+				}
+			}
+			result, err := d.evaluateEach(statement, tok, lexer, depth, trace)
+			if err != nil {
+				return false, err
+			}
+			if result {
+				ts.push(&token{ttype: cTRUE, tliteral: cTRUE})
+			} else {
+				ts.push(&token{ttype: cFALSE, tliteral: cFALSE})
+			}
+			tok = lexer.nextToken()
+			continue
+		}
+
 		if tok.ttype != cRPAREN { // continue populating stack until hit right paren
 			ts.push(tok)
 		} else { // if right paren encountered then begin execution of the component until the most recent (previous) left paren.
@@ -711,6 +951,31 @@ func evaluate(statement string, d *Diff) (bool, error) {
 
 			op := ts.pop()
 
+			var step *TraceStep
+			if trace != nil && op != nil {
+				step = &TraceStep{
+					Operation:  op.tliteral,
+					Expression: statement[op.tpos : tok.tpos+1],
+					Binding:    d.binding,
+					offset:     op.tpos,
+				}
+				for _, t := range ts.Stack {
+					if isOperation(t.ttype) {
+						step.Depth++
+					}
+				}
+				if op.ttype == cEVAL && curexpts.size() > 0 {
+					_, step.Matched = d.identifierChanges(curexpts.peek())
+				}
+			}
+
+			if isStepQuantifier(op.ttype) {
+				return false, errors.Errorf("error: %s may only be evaluated against a History", op.tliteral)
+			}
+			if op.ttype == cREF {
+				return false, errors.Errorf("validation error: undefined reference %s", curexpts.peek().tliteral)
+			}
+
 			if op.ttype == cEVAL {
 				// if operator is EVAL then validate and execute pushing result
 				// onto the stack
@@ -718,12 +983,20 @@ func evaluate(statement string, d *Diff) (bool, error) {
 				if err != nil {
 					return false, errors.Wrap(err, "error: invalid transform stack; failed validation")
 				}
-				expres := evaluateTransformStack(curexpts, d)
+				var expres bool
+				if n := ts.size(); n >= 2 && ts.Stack[n-1].ttype == cLPAREN && isMatchQuantifier(ts.Stack[n-2].ttype) {
+					expres = evaluateMatchQuantifier(ts.Stack[n-2].ttype, curexpts, d)
+				} else {
+					expres = evaluateTransformStack(curexpts, d)
+				}
 				if expres == true {
 					ts.push(&token{ttype: cTRUE, tliteral: cTRUE})
 				} else {
 					ts.push(&token{ttype: cFALSE, tliteral: cFALSE})
 				}
+			} else if isMatchQuantifier(op.ttype) {
+				// the enclosed EVAL has been evaluated against each change
+				ts.push(curexpts.pop())
 			} else {
 				// if operator is not EVAL (AND or OR) then evaluate the boolean
 				// expression
@@ -752,6 +1025,10 @@ func evaluate(statement string, d *Diff) (bool, error) {
 				}
 			}
 
+			if step != nil {
+				step.Result = ts.peek().ttype == cTRUE
+				*trace = append(*trace, *step)
+			}
 		}
 		tok = lexer.nextToken()
 	}
@@ -0,0 +1,295 @@
+package diffq
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// formatIndent is the indentation of each nesting level of a formatted
+// statement.
+const formatIndent = "    "
+
+// formatNode represents an operation or boolean literal of a statement being
+// formatted along with the comments attached to it.
+type formatNode struct {
+	// tok is the keyword of the operation or the boolean literal.
+	tok *token
+	// args holds the tokens within the parentheses of an EVAL or the scope of
+	// an EACH.
+	args []*token
+	// children holds the nested operations of AND, OR, EACH and quantifiers.
+	children []*formatNode
+	// leading holds the comments on the lines preceding the node.
+	leading []*token
+	// trailing holds the comments following the node on the same line.
+	trailing []*token
+	// closing holds the comments following the last child of the node.
+	closing []*token
+	// end is the offset following the closing parenthesis of the node.
+	end int
+}
+
+// formatParser parses a statement into formatNodes.
+type formatParser struct {
+	input  string
+	tokens []*token
+	ends   []int
+	pos    int
+}
+
+// Format returns the canonical form of statement. Keywords and operators are
+// written in upper case, each operand of AND, OR and step quantifiers is written
+// on its own line indented by four spaces, EVAL expressions are written on a
+// single line and redundant commas are removed. Comments are preserved; a
+// comment on the same line as the preceding operand remains on that line and
+// any other comment is written on its own line. Formatting a formatted statement
+// returns it unchanged.
+func Format(statement string) (string, error) {
+	nodes, closing, err := parseStatement(statement)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, n := range nodes {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeFormatNode(&b, n, "", false)
+	}
+	for _, c := range closing {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(formatToken(c))
+	}
+	return b.String(), nil
+}
+
+// parseStatement validates and parses statement into its top level operations
+// returning them along with the comments following the last operation.
+func parseStatement(statement string) ([]*formatNode, []*token, error) {
+	if err := validate(statement); err != nil {
+		return nil, nil, err
+	}
+
+	p := &formatParser{input: statement}
+	l := newLexer(statement)
+	for {
+		tok := l.nextToken()
+		if tok.ttype == cEOF {
+			break
+		}
+		if tok.ttype == cILLEGAL {
+			return nil, nil, errors.Errorf("format error: illegal token %q at offset %d", tok.tliteral, tok.tpos)
+		}
+		p.tokens = append(p.tokens, tok)
+		p.ends = append(p.ends, l.position)
+	}
+
+	return p.parseList(false)
+}
+
+// parseList parses operations until the closing parenthesis of the enclosing
+// operation, or the end of the statement when nested is false. The comments
+// following the last operation are returned separately.
+func (p *formatParser) parseList(nested bool) ([]*formatNode, []*token, error) {
+	var nodes []*formatNode
+	var pending []*token
+	prevEnd := -1
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		p.pos++
+
+		switch {
+		case tok.ttype == cCOMMENT:
+			if prevEnd >= 0 && len(pending) == 0 && !strings.Contains(p.input[prevEnd:tok.tpos], "\n") {
+				last := nodes[len(nodes)-1]
+				last.trailing = append(last.trailing, tok)
+				prevEnd = p.ends[p.pos-1]
+			} else {
+				pending = append(pending, tok)
+			}
+		case tok.ttype == cCOMMA:
+			// commas are implied by the layout
+		case tok.ttype == cRPAREN:
+			if !nested {
+				return nil, nil, errors.Errorf("format error: unexpected ) at offset %d", tok.tpos)
+			}
+			return nodes, pending, nil
+		case tok.ttype == cREF:
+			// REF(name) is validated before parsing
+			if p.pos+2 >= len(p.tokens) {
+				return nil, nil, errors.Errorf("format error: expected REF(name) at offset %d", tok.tpos)
+			}
+			n := &formatNode{tok: tok, args: p.tokens[p.pos+1 : p.pos+2], leading: pending, end: p.ends[p.pos+2]}
+			pending = nil
+			p.pos += 3
+			nodes = append(nodes, n)
+			prevEnd = n.end
+		case tok.ttype == cTRUE || tok.ttype == cFALSE:
+			nodes = append(nodes, &formatNode{tok: tok, leading: pending, end: p.ends[p.pos-1]})
+			pending = nil
+			prevEnd = p.ends[p.pos-1]
+		case isOperation(tok.ttype):
+			n := &formatNode{tok: tok, leading: pending}
+			pending = nil
+			if p.pos >= len(p.tokens) || p.tokens[p.pos].ttype != cLPAREN {
+				return nil, nil, errors.Errorf("format error: expected ( after %s at offset %d", tok.tliteral, tok.tpos)
+			}
+			p.pos++
+			var err error
+			if tok.ttype == cEVAL {
+				err = p.parseEval(n)
+			} else if tok.ttype == cEACH {
+				err = p.parseScope(n)
+			} else {
+				n.children, n.closing, err = p.parseList(true)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			n.end = p.ends[p.pos-1]
+			nodes = append(nodes, n)
+			prevEnd = n.end
+		default:
+			return nil, nil, errors.Errorf("format error: unexpected %s at offset %d", tok.tliteral, tok.tpos)
+		}
+	}
+	if nested {
+		return nil, nil, errors.New("format error: mismatched parentheses")
+	}
+	return nodes, pending, nil
+}
+
+// parseEval collects the tokens of the EVAL expression n up to its closing
+// parenthesis.
+func (p *formatParser) parseEval(n *formatNode) error {
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		p.pos++
+		switch tok.ttype {
+		case cRPAREN:
+			return validateFormatEval(n)
+		case cLPAREN:
+			return errors.Errorf("format error: unexpected ( in EVAL at offset %d", tok.tpos)
+		case cCOMMA:
+			continue
+		}
+		n.args = append(n.args, tok)
+	}
+	return errors.New("format error: mismatched parentheses")
+}
+
+// parseScope collects the scope of the EACH expression n followed by its
+// statement up to the closing parenthesis.
+func (p *formatParser) parseScope(n *formatNode) error {
+	if p.pos+1 >= len(p.tokens) || p.tokens[p.pos].ttype != cIDENT || p.tokens[p.pos+1].ttype != cCOMMA {
+		return errors.Errorf("format error: expected EACH(path, statement) at offset %d", n.tok.tpos)
+	}
+	n.args = p.tokens[p.pos : p.pos+1]
+	p.pos += 2
+	var err error
+	n.children, n.closing, err = p.parseList(true)
+	return err
+}
+
+// validateFormatEval validates the expression of the EVAL n ignoring comments.
+func validateFormatEval(n *formatNode) error {
+	if err := validateEvalArgs(n.args); err != nil {
+		return errors.Wrapf(err, "format error: invalid EVAL at offset %d", n.tok.tpos)
+	}
+	return nil
+}
+
+// writeFormatNode writes the node n indented by indent. A comma is written after
+// the node when comma is true.
+func writeFormatNode(b *strings.Builder, n *formatNode, indent string, comma bool) {
+	for _, c := range n.leading {
+		b.WriteString(indent + formatToken(c) + "\n")
+	}
+
+	b.WriteString(indent + formatToken(n.tok))
+	if n.tok.ttype == cEVAL || n.tok.ttype == cREF {
+		b.WriteString("(" + formatEvalArgs(n.args) + ")")
+	} else if isOperation(n.tok.ttype) {
+		if len(n.children) == 0 && len(n.closing) == 0 {
+			b.WriteString("()")
+		} else {
+			b.WriteString("(\n")
+			if len(n.args) > 0 {
+				b.WriteString(indent + formatIndent + formatEvalArgs(n.args) + ",\n")
+			}
+			for i, c := range n.children {
+				writeFormatNode(b, c, indent+formatIndent, i < len(n.children)-1)
+				b.WriteString("\n")
+			}
+			for _, c := range n.closing {
+				b.WriteString(indent + formatIndent + formatToken(c) + "\n")
+			}
+			b.WriteString(indent + ")")
+		}
+	}
+
+	if comma {
+		b.WriteString(",")
+	}
+	for _, c := range n.trailing {
+		b.WriteString(" " + formatToken(c))
+	}
+}
+
+// formatEvalArgs formats the tokens of an EVAL expression separated by spaces
+// with the previous value enclosed in brackets.
+func formatEvalArgs(args []*token) string {
+	var parts []string
+	for i := 0; i < len(args); i++ {
+		switch args[i].ttype {
+		case cLBRACKET:
+			s := "["
+			for i+1 < len(args) && args[i+1].ttype != cRBRACKET {
+				i++
+				if s != "[" {
+					s += " "
+				}
+				s += formatToken(args[i])
+			}
+			if i+1 < len(args) {
+				i++
+			}
+			parts = append(parts, s+"]")
+		default:
+			parts = append(parts, formatToken(args[i]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatToken returns the canonical source form of tok.
+func formatToken(tok *token) string {
+	switch tok.ttype {
+	case cCOMMENT:
+		return "/*" + tok.tliteral + "*/"
+	case cSTRING:
+		if tok.traw {
+			return tok.tmods + "`" + tok.tliteral + "`"
+		}
+		return tok.tmods + strconv.Quote(tok.tliteral)
+	case cDURATION:
+		return `d"` + tok.tliteral + `"`
+	case cTIME:
+		return `t"` + tok.tliteral + `"`
+	case cTIMEEXPR, cAGGREGATE:
+		return tok.tliteral
+	case cNIL:
+		return "nil"
+	case cIDENT, cINT, cFLOAT:
+		return tok.tliteral
+	}
+	if _, ok := keywords[tok.tliteral]; ok {
+		return string(tok.ttype)
+	}
+	return tok.tliteral
+}
@@ -0,0 +1,98 @@
+package diffq
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := map[string]string{
+		`EVAL(A=> 1)`: `EVAL(A => 1)`,
+		`and(EVAL(A => 1), or(eval(B =gt> 2), EVAL(C ["x"] => "y"),),)`: `AND(
+    EVAL(A => 1),
+    OR(
+        EVAL(B =GT> 2),
+        EVAL(C ["x"] => "y")
+    )
+)`,
+		`AND(EVAL(A =gte> 1.5), EVAL(T =lt> t"2020-01-01T12:00:00Z"), EVAL(D =!> d"1h"), EVAL(P => NIL), EVAL(S.* => $CREATED))`: `AND(
+    EVAL(A =GTE> 1.5),
+    EVAL(T =LT> t"2020-01-01T12:00:00Z"),
+    EVAL(D =!> d"1h"),
+    EVAL(P => nil),
+    EVAL(S.* => $created)
+)`,
+		`/* rule */ AND( /* first */ EVAL(A => 1), /* same line */
+EVAL(B /* inline */ => *) /* last */ /* end */ )`: `/* rule */
+AND(
+    /* first */
+    EVAL(A => 1), /* same line */
+    EVAL(B /* inline */ => *) /* last */ /* end */
+)`,
+		`OR(EVAL(A => 1),
+/* dangling */)`: `OR(
+    EVAL(A => 1)
+    /* dangling */
+)`,
+		`ANY_STEP(eval(S => "Done"))`: `ANY_STEP(
+    EVAL(S => "Done")
+)`,
+		`AND()`: `AND()`,
+		`AND(EVAL(T =gt> now()-d"24h"), EVAL(T => day( t"2024-01-01" )))`: `AND(
+    EVAL(T =GT> now() - d"24h"),
+    EVAL(T => day(t"2024-01-01"))
+)`,
+		`AND(EVAL(D => d"24h"), EVAL(T =lt> startOfDay()+d"90m"))`: `AND(
+    EVAL(D => d"24h"),
+    EVAL(T =LT> startOfDay() + d"90m")
+)`,
+		`EVAL(S => "say \"hi\"\u00e9\t")`: `EVAL(S => "say \"hi\"é\t")`,
+		"EVAL(S => `C:\\path`)":           "EVAL(S => `C:\\path`)",
+		`all( eval(NTS.*.NI =gte> 100) )`: `ALL(
+    EVAL(NTS.*.NI =GTE> 100)
+)`,
+		`AND(EVAL(len( IS ) =gt> 10), EVAL(count(NTS,$DELETED) => 1))`: `AND(
+    EVAL(LEN(IS) =GT> 10),
+    EVAL(COUNT(NTS, $deleted) => 1)
+)`,
+		`EVAL(S =startswith> si"err")`: `EVAL(S =STARTSWITH> is"err")`,
+		"EVAL(S =contains> n`café`)":   "EVAL(S =CONTAINS> n`café`)",
+		`each(NTS.*, and(eval(.NS => "x"), eval(LEN(.NSS) => 1)))`: `EACH(
+    NTS.*,
+    AND(
+        EVAL(.NS => "x"),
+        EVAL(LEN(.NSS) => 1)
+    )
+)`,
+		`and(ref(terminal), EVAL(Owner => *))`: `AND(
+    REF(terminal),
+    EVAL(Owner => *)
+)`,
+	}
+	for statement, want := range tests {
+		got, err := Format(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got:\n%s\nwant:\n%s", statement, got, want)
+		}
+		again, err := Format(got)
+		if err != nil || again != got {
+			t.Errorf("format not idempotent for %s, got:\n%s", statement, again)
+		}
+	}
+
+	for _, statement := range []string{
+		`AND(EVAL(A => 1)`,
+		`EVAL(A => 1))`,
+		`AND(EVAL(A => 1) EVAL(B))`,
+		`AND(REF())`,
+		`EACH(EVAL(S => 1))`,
+		``,
+	} {
+		if _, err := Format(statement); err == nil {
+			t.Errorf("expected error for %s", statement)
+		}
+	}
+}
@@ -4,7 +4,10 @@ go 1.15
 
 require (
 	github.com/google/go-cmp v0.5.4
+	github.com/peterh/liner v1.2.2
 	github.com/pkg/errors v0.9.1
 	github.com/r3labs/diff v1.1.0
 	github.com/spf13/cast v1.3.1
+	golang.org/x/text v0.13.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,187 @@
+package diffq
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// History represents an ordered sequence of snapshots of a value and the
+// differential of each step between consecutive snapshots. Statements may be
+// evaluated against the net change or quantified over the steps.
+type History struct {
+	// Snapshots holds each version of the value in order.
+	Snapshots []interface{}
+	// Steps holds the differential between each pair of consecutive snapshots;
+	// Steps[i] is the differential of Snapshots[i] and Snapshots[i+1].
+	Steps []*Diff
+	// Clock returns the current time used by the relative time expressions of
+	// statements; time.Now is used when nil.
+	Clock func() time.Time
+}
+
+// NewHistory calculates the differential of each step between the ordered
+// snapshots returning an initialized History and an error if encountered. At
+// least two snapshots are required.
+func NewHistory(snapshots ...interface{}) (*History, error) {
+	if len(snapshots) < 2 {
+		return nil, errors.New("error: history requires at least two snapshots")
+	}
+	h := &History{Snapshots: snapshots[:1:1]}
+	for _, s := range snapshots[1:] {
+		if err := h.Append(s); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// Append adds a snapshot to the end of the History, h, calculating the
+// differential from the previous snapshot.
+func (h *History) Append(snapshot interface{}) error {
+	if len(h.Snapshots) > 0 {
+		d, err := Differential(h.Snapshots[len(h.Snapshots)-1], snapshot)
+		if err != nil {
+			return errors.Wrap(err, "error: failed to calculate step differential")
+		}
+		h.Steps = append(h.Steps, d)
+	}
+	h.Snapshots = append(h.Snapshots, snapshot)
+	return nil
+}
+
+// Net calculates the differential from the first to the last snapshot.
+func (h *History) Net() (*Diff, error) {
+	if len(h.Snapshots) == 0 {
+		return nil, errors.New("error: history contains no snapshots")
+	}
+	return Differential(h.Snapshots[0], h.Snapshots[len(h.Snapshots)-1])
+}
+
+// EvaluateStatement executes statement provided against the History, h, and
+// returns the validity of the statement and any errors encountered. Portions of
+// the statement wrapped in a step quantifier are evaluated as follows:
+//
+//	ANY_STEP(...)   true if the statement holds for at least one step
+//	ALL_STEPS(...)  true if the statement holds for every step
+//	EVENTUALLY(...) true if the statement holds for the cumulative change from
+//	                the first snapshot to any later snapshot
+//
+// The remainder of the statement is evaluated against the net change. Step
+// quantifiers cannot be nested.
+func (h *History) EvaluateStatement(statement string) (bool, error) {
+	err := validate(statement)
+	if err != nil {
+		return false, err
+	}
+	net, err := h.Net()
+	if err != nil {
+		return false, err
+	}
+	net.Clock = h.Clock
+
+	resolved, err := h.resolveQuantifiers(statement)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := evaluate(resolved, net)
+	if err != nil {
+		return false, errors.Wrap(err, "error: failed to evaluate")
+	}
+	return result, nil
+}
+
+// resolveQuantifiers evaluates each step quantified portion of statement and
+// replaces it with the resulting boolean literal.
+func (h *History) resolveQuantifiers(statement string) (string, error) {
+	var b strings.Builder
+	last := 0
+
+	l := newLexer(statement)
+	for tok := l.nextToken(); tok.ttype != cEOF; tok = l.nextToken() {
+		if !isStepQuantifier(tok.ttype) {
+			continue
+		}
+
+		// find the extent of the quantified statement
+		open := l.nextToken()
+		if open.ttype != cLPAREN {
+			return "", errors.Errorf("validation error: expected ( after %s", tok.tliteral)
+		}
+		depth := 1
+		var close *token
+		for depth > 0 {
+			close = l.nextToken()
+			switch close.ttype {
+			case cLPAREN:
+				depth++
+			case cRPAREN:
+				depth--
+			case cEOF:
+				return "", errors.New("validation error: mismatched parentheses")
+			default:
+				if isStepQuantifier(close.ttype) {
+					return "", errors.Errorf("validation error: %s cannot be nested", close.tliteral)
+				}
+			}
+		}
+
+		result, err := h.evaluateQuantifier(tok.ttype, statement[open.tpos+1:close.tpos])
+		if err != nil {
+			return "", err
+		}
+
+		b.WriteString(statement[last:tok.tpos])
+		if result {
+			b.WriteString(cTRUE)
+		} else {
+			b.WriteString(cFALSE)
+		}
+		last = close.tpos + 1
+	}
+	b.WriteString(statement[last:])
+
+	return b.String(), nil
+}
+
+// evaluateQuantifier evaluates statement against the steps of the History, h,
+// according to the quantifier q.
+func (h *History) evaluateQuantifier(q tokenType, statement string) (bool, error) {
+	if strings.TrimSpace(statement) == "" {
+		return false, errors.New("validation error: empty statement")
+	}
+
+	var diffs []*Diff
+	if q == cEVENTUALLY {
+		for _, s := range h.Snapshots[1:] {
+			d, err := Differential(h.Snapshots[0], s)
+			if err != nil {
+				return false, errors.Wrap(err, "error: failed to calculate cumulative differential")
+			}
+			diffs = append(diffs, d)
+		}
+	} else {
+		diffs = h.Steps
+	}
+
+	for _, d := range diffs {
+		if h.Clock != nil {
+			step := *d
+			step.Clock = h.Clock
+			d = &step
+		}
+		result, err := evaluate(statement, d)
+		if err != nil {
+			return false, errors.Wrap(err, "error: failed to evaluate")
+		}
+		if q == cALLSTEPS && !result {
+			return false, nil
+		}
+		if q != cALLSTEPS && result {
+			return true, nil
+		}
+	}
+	return q == cALLSTEPS, nil
+}
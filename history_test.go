@@ -0,0 +1,81 @@
+package diffq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	h, err := NewHistory(
+		&OuterType{S: "Draft", I: 1},
+		&OuterType{S: "Running", I: 2},
+		&OuterType{S: "Failed", I: 3},
+		&OuterType{S: "Done", I: 4},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(h.Steps) != 3 {
+		t.Fatalf("incorrect number of steps, got: %d, want: %d", len(h.Steps), 3)
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(S ["Draft"] => "Done"))`:                                         true,
+		`ANY_STEP(EVAL(S => "Failed"))`:                                            true,
+		`ANY_STEP(EVAL(S ["Draft"] => "Failed"))`:                                  false,
+		`EVENTUALLY(EVAL(S ["Draft"] => "Failed"))`:                                true,
+		`ALL_STEPS(EVAL(I =GT> 1))`:                                                true,
+		`ALL_STEPS(EVAL(S =!> "Failed"))`:                                          false,
+		`AND(ANY_STEP(EVAL(S => "Running")), EVAL(S => "Done"))`:                   true,
+		`OR(ALL_STEPS(EVAL(S => "Done")), ANY_STEP(EVAL(I => 5)))`:                 false,
+		`AND(EVENTUALLY(AND(EVAL(S => "Failed"), EVAL(I => 3))), EVAL(I =GTE> 4))`: true,
+	}
+	for statement, want := range tests {
+		got, err := h.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+
+	if _, err := h.EvaluateStatement(`ANY_STEP(ALL_STEPS(EVAL(S => *)))`); err == nil {
+		t.Errorf("expected error evaluating nested quantifiers")
+	}
+	if _, err := h.Steps[0].EvaluateStatement(`ANY_STEP(EVAL(S => *))`); err == nil {
+		t.Errorf("expected error evaluating quantifier against a diff")
+	}
+	if _, err := NewHistory(&OuterType{}); err == nil {
+		t.Errorf("expected error creating history from a single snapshot")
+	}
+}
+
+func TestHistoryClock(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 3, d, 12, 0, 0, 0, time.UTC) }
+	h, err := NewHistory(&OuterType{T: day(1)}, &OuterType{T: day(5)}, &OuterType{T: day(9)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	h.Clock = func() time.Time { return day(10) }
+
+	tests := map[string]bool{
+		`EVAL(T => day(now() - d"24h"))`:                 true,
+		`ANY_STEP(EVAL(T => day(now() - d"120h")))`:      true,
+		`ALL_STEPS(EVAL(T =GT> startOfDay() - d"240h"))`: true,
+		`EVENTUALLY(EVAL(T =LT> now() - d"96h"))`:        true,
+		`ALL_STEPS(EVAL(T =GT> now() - d"96h"))`:         false,
+	}
+	for statement, want := range tests {
+		got, err := h.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+	if h.Steps[0].Clock != nil {
+		t.Error("clock of history assigned to step")
+	}
+}
@@ -0,0 +1,431 @@
+package diffq
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Wire format
+//
+// A Diff is encoded as a JSON object holding the changes along with the
+// original and new values:
+//
+//	{
+//	  "changed": true,
+//	  "changes": [
+//	    {"type": "update", "path": ["T"], "from": {"type": "time", "value": "2020-01-01T12:00:00Z"}, "to": ...},
+//	    {"type": "move", "path": ["Tags", "0"], "from": ..., "to": ..., "fromIndex": 2, "toIndex": 0}
+//	  ],
+//	  "original": {...},
+//	  "new": {...}
+//	}
+//
+// Change values are wrapped in an envelope recording the type of the value so
+// that comparisons made during evaluation behave the same before and after a
+// round trip. The envelope types are "nil", "bool", "string", "int", "int8",
+// "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64",
+// "float32", "float64", "time" (RFC3339 with nanoseconds), "duration"
+// (nanoseconds), "number" (a json.Number) and "json" for any other value. Pointers are encoded as the
+// value they point to, or "nil" when nil, unless only the pointer encodes
+// itself, as with *big.Int. Values of named types are decoded as their
+// underlying kind and "json" values are decoded into generic maps, slices and
+// primitives.
+//
+// The original and new values are encoded as a tree of envelopes so that
+// paths, $first and $last, collection expressions and EACH resolve the same
+// way before and after a round trip. Structs and maps with string keys are
+// "object" envelopes keyed by path component, as Differential names them, and
+// decoded as map[string]interface{}; other maps are "map" envelopes holding
+// [key, value] pairs and decoded as map[interface{}]interface{}; slices and
+// arrays are "array" envelopes decoded as []interface{}, except slices whose
+// elements are identified by a field which are objects keyed by identifier.
+// Any other value is a change value envelope:
+//
+//	{"type": "object", "value": {"Items": {"type": "array", "value": [{"type": "string", "value": "a"}]}}}
+
+// typedValue wraps a change value to preserve its type when encoded as JSON.
+type typedValue struct {
+	v interface{}
+}
+
+// typedEnvelope is the JSON representation of a typedValue.
+type typedEnvelope struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// MarshalJSON encodes the value along with its type.
+func (t typedValue) MarshalJSON() ([]byte, error) {
+	env := typedEnvelope{Type: "nil"}
+	if v := indirectValue(t.v); v != nil {
+		t.v = v
+		var value interface{}
+		switch v := t.v.(type) {
+		case time.Time:
+			env.Type = "time"
+			value = v.Format(time.RFC3339Nano)
+		case time.Duration:
+			env.Type = "duration"
+			value = int64(v)
+		case json.Number:
+			env.Type = "number"
+			value = v
+		default:
+			rv := reflect.ValueOf(t.v)
+			switch rv.Kind() {
+			case reflect.Bool, reflect.String,
+				reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+				reflect.Float32, reflect.Float64:
+				env.Type = rv.Kind().String()
+			default:
+				env.Type = "json"
+			}
+			value = t.v
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encoding error: failed to encode %s value", env.Type)
+		}
+		env.Value = raw
+	}
+	return json.Marshal(env)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// encodesItself reports whether values of type t implement their own JSON or
+// text encoding.
+func encodesItself(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)
+}
+
+// indirectValue returns the value pointed to by v, following any number of
+// pointers, or nil if a pointer is nil. Pointers that encode themselves when
+// the value they point to does not, such as *big.Int, are not followed.
+func indirectValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		if encodesItself(rv.Type()) && !encodesItself(rv.Type().Elem()) {
+			break
+		}
+		rv = rv.Elem()
+		v = rv.Interface()
+	}
+	return v
+}
+
+// UnmarshalJSON decodes the value into the type recorded in the envelope.
+func (t *typedValue) UnmarshalJSON(data []byte) error {
+	var env typedEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return errors.Wrap(err, "encoding error: invalid value envelope")
+	}
+
+	var target interface{}
+	switch env.Type {
+	case "nil":
+		t.v = nil
+		return nil
+	case "time":
+		var s string
+		if err := json.Unmarshal(env.Value, &s); err != nil {
+			return errors.Wrap(err, "encoding error: invalid time value")
+		}
+		tv, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return errors.Wrap(err, "encoding error: invalid time value")
+		}
+		t.v = tv
+		return nil
+	case "duration":
+		var d int64
+		if err := json.Unmarshal(env.Value, &d); err != nil {
+			return errors.Wrap(err, "encoding error: invalid duration value")
+		}
+		t.v = time.Duration(d)
+		return nil
+	case "number":
+		var n json.Number
+		if err := json.Unmarshal(env.Value, &n); err != nil {
+			return errors.Wrap(err, "encoding error: invalid number value")
+		}
+		t.v = n
+		return nil
+	case "json":
+		var v interface{}
+		if err := json.Unmarshal(env.Value, &v); err != nil {
+			return errors.Wrap(err, "encoding error: invalid json value")
+		}
+		t.v = v
+		return nil
+	case "bool":
+		target = new(bool)
+	case "string":
+		target = new(string)
+	case "int":
+		target = new(int)
+	case "int8":
+		target = new(int8)
+	case "int16":
+		target = new(int16)
+	case "int32":
+		target = new(int32)
+	case "int64":
+		target = new(int64)
+	case "uint":
+		target = new(uint)
+	case "uint8":
+		target = new(uint8)
+	case "uint16":
+		target = new(uint16)
+	case "uint32":
+		target = new(uint32)
+	case "uint64":
+		target = new(uint64)
+	case "float32":
+		target = new(float32)
+	case "float64":
+		target = new(float64)
+	default:
+		return errors.Errorf("encoding error: unsupported value type %s", env.Type)
+	}
+	if err := json.Unmarshal(env.Value, target); err != nil {
+		return errors.Wrapf(err, "encoding error: invalid %s value", env.Type)
+	}
+	t.v = reflect.ValueOf(target).Elem().Interface()
+	return nil
+}
+
+// valueTree wraps the original or new value of a Diff to preserve the path
+// components and types of the values within it when encoded as JSON.
+type valueTree struct {
+	v interface{}
+}
+
+// MarshalJSON encodes the value as a tree of envelopes.
+func (t valueTree) MarshalJSON() ([]byte, error) {
+	v := indirectValue(t.v)
+	if v == nil || encodesItself(reflect.TypeOf(v)) {
+		return json.Marshal(typedValue{v})
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Struct:
+		fields := make(map[string]valueTree)
+		for i := 0; i < rv.NumField(); i++ {
+			if name, ok := fieldPathName(rv.Type().Field(i)); ok {
+				fields[name] = valueTree{rv.Field(i).Interface()}
+			}
+		}
+		return marshalEnvelope("object", fields)
+	case reflect.Map:
+		if rv.IsNil() {
+			return json.Marshal(typedValue{nil})
+		}
+		if rv.Type().Key().Kind() == reflect.String {
+			fields := make(map[string]valueTree)
+			for _, k := range rv.MapKeys() {
+				fields[k.String()] = valueTree{rv.MapIndex(k).Interface()}
+			}
+			return marshalEnvelope("object", fields)
+		}
+		var entries [][2]interface{}
+		for _, k := range rv.MapKeys() {
+			entries = append(entries, [2]interface{}{typedValue{treeKey(k)}, valueTree{rv.MapIndex(k).Interface()}})
+		}
+		return marshalEnvelope("map", entries)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return json.Marshal(typedValue{nil})
+		}
+		if rv.Kind() == reflect.Slice && hasIdentifiedElements(rv) {
+			fields := make(map[string]valueTree)
+			for i := 0; i < rv.Len(); i++ {
+				fields[elementIdentifier(rv.Index(i))] = valueTree{rv.Index(i).Interface()}
+			}
+			return marshalEnvelope("object", fields)
+		}
+		elems := make([]valueTree, rv.Len())
+		for i := range elems {
+			elems[i] = valueTree{rv.Index(i).Interface()}
+		}
+		return marshalEnvelope("array", elems)
+	}
+	return json.Marshal(typedValue{v})
+}
+
+// treeKey returns the key k of a map as encoded in a "map" envelope. Keys that
+// would not decode to a comparable value are encoded as their path component.
+func treeKey(k reflect.Value) interface{} {
+	switch k.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return k.Interface()
+	}
+	if t, ok := k.Interface().(time.Time); ok {
+		return t
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+// marshalEnvelope encodes value in an envelope of the type given.
+func marshalEnvelope(typ string, value interface{}) ([]byte, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding error: failed to encode %s value", typ)
+	}
+	return json.Marshal(typedEnvelope{Type: typ, Value: raw})
+}
+
+// UnmarshalJSON decodes a tree of envelopes into generic maps and slices
+// holding values of the types recorded in the envelopes.
+func (t *valueTree) UnmarshalJSON(data []byte) error {
+	var env typedEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return errors.Wrap(err, "encoding error: invalid value envelope")
+	}
+
+	switch env.Type {
+	case "object":
+		var fields map[string]valueTree
+		if err := json.Unmarshal(env.Value, &fields); err != nil {
+			return errors.Wrap(err, "encoding error: invalid object value")
+		}
+		m := make(map[string]interface{}, len(fields))
+		for k, f := range fields {
+			m[k] = f.v
+		}
+		t.v = m
+	case "map":
+		var entries [][2]json.RawMessage
+		if err := json.Unmarshal(env.Value, &entries); err != nil {
+			return errors.Wrap(err, "encoding error: invalid map value")
+		}
+		m := make(map[interface{}]interface{}, len(entries))
+		for _, e := range entries {
+			var k typedValue
+			var v valueTree
+			if err := json.Unmarshal(e[0], &k); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(e[1], &v); err != nil {
+				return err
+			}
+			m[k.v] = v.v
+		}
+		t.v = m
+	case "array":
+		var elems []valueTree
+		if err := json.Unmarshal(env.Value, &elems); err != nil {
+			return errors.Wrap(err, "encoding error: invalid array value")
+		}
+		a := make([]interface{}, len(elems))
+		for i, e := range elems {
+			a[i] = e.v
+		}
+		t.v = a
+	default:
+		var tv typedValue
+		if err := tv.UnmarshalJSON(data); err != nil {
+			return err
+		}
+		t.v = tv.v
+	}
+	return nil
+}
+
+// changeJSON is the JSON representation of a Change. The indices are only
+// encoded for moves.
+type changeJSON struct {
+	Type      ChangeType `json:"type"`
+	Path      []string   `json:"path"`
+	From      typedValue `json:"from"`
+	To        typedValue `json:"to"`
+	FromIndex *int       `json:"fromIndex,omitempty"`
+	ToIndex   *int       `json:"toIndex,omitempty"`
+}
+
+// MarshalJSON encodes the Change, c, using typed value envelopes for From and
+// To.
+func (c Change) MarshalJSON() ([]byte, error) {
+	cj := changeJSON{
+		Type: c.Type,
+		Path: c.Path,
+		From: typedValue{c.From},
+		To:   typedValue{c.To},
+	}
+	if c.Type == ChangeMove {
+		cj.FromIndex, cj.ToIndex = &c.FromIndex, &c.ToIndex
+	}
+	return json.Marshal(cj)
+}
+
+// UnmarshalJSON decodes a Change encoded by MarshalJSON restoring the types of
+// the From and To values.
+func (c *Change) UnmarshalJSON(data []byte) error {
+	var cj changeJSON
+	if err := json.Unmarshal(data, &cj); err != nil {
+		return err
+	}
+	*c = Change{
+		Type: cj.Type,
+		Path: cj.Path,
+		From: cj.From.v,
+		To:   cj.To.v,
+	}
+	if cj.FromIndex != nil {
+		c.FromIndex = *cj.FromIndex
+	}
+	if cj.ToIndex != nil {
+		c.ToIndex = *cj.ToIndex
+	}
+	return nil
+}
+
+// diffJSON is the JSON representation of a Diff.
+type diffJSON struct {
+	Changed  bool      `json:"changed"`
+	Changes  Changes   `json:"changes"`
+	Original valueTree `json:"original"`
+	New      valueTree `json:"new"`
+}
+
+// MarshalJSON encodes the Diff, d. The lookup map is not encoded as it is
+// derived from the changes. The receiver is a value so that a Diff is encoded
+// the same way whether or not it is addressed by a pointer.
+func (d Diff) MarshalJSON() ([]byte, error) {
+	return json.Marshal(diffJSON{
+		Changed:  d.Changed,
+		Changes:  d.Changes,
+		Original: valueTree{d.Original},
+		New:      valueTree{d.New},
+	})
+}
+
+// UnmarshalJSON decodes a Diff encoded by MarshalJSON rebuilding the lookup map.
+// Statements may be evaluated against the decoded Diff without the original
+// types; the original and new values are decoded as generic maps and slices
+// keyed by path component holding values of their original types.
+func (d *Diff) UnmarshalJSON(data []byte) error {
+	var dj diffJSON
+	if err := json.Unmarshal(data, &dj); err != nil {
+		return errors.Wrap(err, "encoding error: failed to decode diff")
+	}
+	*d = *newDiff(dj.Original.v, dj.New.v, dj.Changes)
+	return nil
+}
@@ -0,0 +1,218 @@
+package diffq
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffJSON(t *testing.T) {
+	a, b := newPatchTypes()
+	b.I64 = 1 << 62
+	b.F32 = 1.5
+	d, err := Differential(a, b, WithMoves())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("unexpected error encoding diff: %v", err)
+	}
+	var decoded Diff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error decoding diff: %v", err)
+	}
+
+	if len(decoded.Changes) != len(d.Changes) || len(decoded.ChangeLogMap) != len(d.ChangeLogMap) || !decoded.Changed {
+		t.Fatalf("incorrect decoded changes, got: %d, want: %d", len(decoded.Changes), len(d.Changes))
+	}
+	for i, c := range d.Changes {
+		if reflect.ValueOf(c.From).Kind() == reflect.Ptr || reflect.ValueOf(c.To).Kind() == reflect.Ptr {
+			continue
+		}
+		if !reflect.DeepEqual(c, decoded.Changes[i]) {
+			t.Errorf("incorrect decoded change %d, got: %#v, want: %#v", i, decoded.Changes[i], c)
+		}
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(OuterType.T => t"2020-01-01T12:00:00-04:00"))`: true,
+		`AND(EVAL(OuterType.D =GT> d"90m"))`:                     true,
+		`AND(EVAL(OuterType.I64 => 4611686018427387904))`:        true,
+		`AND(EVAL(OuterType.NTP => nil))`:                        true,
+		`AND(EVAL(OuterType.S ["StringS"] => "StringSU"))`:       true,
+	}
+	for statement, want := range tests {
+		got, err := decoded.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+}
+
+func TestDiffJSONModifiers(t *testing.T) {
+	d, _ := Differential(
+		&OuterType{SS: []string{"A", "B"}, IS: []int{1}},
+		&OuterType{SS: []string{"C", "B"}, IS: []int{1, 2}},
+	)
+	data, _ := json.Marshal(d)
+	var decoded Diff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error decoding diff: %v", err)
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(SS.$first => "C"))`:      true,
+		`AND(EVAL(IS.$last => $created))`:  true,
+		`AND(EVAL(IS.$first => $created))`: false,
+	}
+	for statement, want := range tests {
+		got, err := decoded.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+}
+
+func TestDiffJSONValues(t *testing.T) {
+	type order struct {
+		Status string            `json:"status"`
+		Items  []string          `json:"items"`
+		Counts map[int]uint64    `json:"counts"`
+		Keyed  []KeyedType       `json:"keyed"`
+		Labels map[string]string `json:"labels"`
+	}
+	a := &order{Status: "open", Items: []string{"a"}, Counts: map[int]uint64{1: 1}, Keyed: []KeyedType{{ID: "x", Value: 1}}}
+	b := &order{Status: "open", Items: []string{"a", "b"}, Counts: map[int]uint64{1: 1<<64 - 1, 2: 1}, Keyed: []KeyedType{{ID: "x", Value: 2}}, Labels: map[string]string{"k": "v"}}
+	d, err := Differential(a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("unexpected error encoding diff: %v", err)
+	}
+	var decoded Diff
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unexpected error decoding diff: %v", err)
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(Items.$last => "b"))`:                            true,
+		`AND(EVAL(Items.$first => *))`:                             false,
+		`AND(EVAL(LEN(Items) => 2))`:                               true,
+		`AND(EVAL(COUNT(Items, $created) => 1))`:                   true,
+		`AND(EVAL(Items =CONTAINS> "b"))`:                          true,
+		`AND(EVAL(Counts =CONTAINS> 2))`:                           true,
+		`AND(EVAL(Counts.1 => 18446744073709551615))`:              true,
+		`AND(EVAL(LEN(Counts) [1] => 2))`:                          true,
+		`AND(EVAL(Keyed.x.value => 2))`:                            true,
+		`EACH(Keyed.*, EVAL(.value => 2))`:                         true,
+		`EACH(Counts.*, AND(EVAL(. => *), EVAL(. =GT> 1)))`:        true,
+		`AND(EVAL(LEN(Labels) => 1), EVAL(Labels =CONTAINS> "k"))`: true,
+	}
+	for statement, want := range tests {
+		for name, diff := range map[string]*Diff{"original": d, "decoded": &decoded} {
+			got, err := diff.EvaluateStatement(statement)
+			if err != nil {
+				t.Errorf("unexpected error evaluating %s against %s diff: %v", statement, name, err)
+			}
+			if got != want {
+				t.Errorf("incorrect result for %s against %s diff, got: %t, want: %t", statement, name, got, want)
+			}
+		}
+	}
+}
+
+func TestDiffValueJSON(t *testing.T) {
+	a, b := newPatchTypes()
+	d, err := Differential(a, b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want, err := json.Marshal(d)
+	if err != nil {
+		t.Fatalf("unexpected error encoding diff: %v", err)
+	}
+	got, err := json.Marshal(*d)
+	if err != nil {
+		t.Fatalf("unexpected error encoding diff value: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("incorrect diff value encoding, got: %s, want: %s", got, want)
+	}
+
+	var decoded Diff
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatalf("unexpected error decoding diff: %v", err)
+	}
+	statement := `AND(EVAL(OuterType.T => t"2020-01-01T12:00:00-04:00"))`
+	if ok, err := decoded.EvaluateStatement(statement); err != nil || !ok {
+		t.Errorf("incorrect result for %s, got: %t (%v), want: true", statement, ok, err)
+	}
+}
+
+func TestTypedValuePointerJSON(t *testing.T) {
+	type status string
+	tm := time.Date(2020, 1, 1, 12, 0, 0, 5, time.UTC)
+	i := 7
+	s := status("open")
+	ps := &s
+	var ntm *time.Time
+
+	tests := map[string]struct {
+		v    interface{}
+		want interface{}
+	}{
+		"*time.Time": {&tm, tm},
+		"*int":       {&i, i},
+		"status":     {s, "open"},
+		"**status":   {&ps, "open"},
+		"nil":        {ntm, nil},
+		"*big.Int":   {big.NewInt(5), float64(5)},
+	}
+	for name, tt := range tests {
+		data, err := json.Marshal(typedValue{tt.v})
+		if err != nil {
+			t.Errorf("unexpected error encoding %s: %v", name, err)
+		}
+		var tv typedValue
+		if err := json.Unmarshal(data, &tv); err != nil {
+			t.Errorf("unexpected error decoding %s: %v", data, err)
+		}
+		if !reflect.DeepEqual(tv.v, tt.want) {
+			t.Errorf("incorrect decoded value for %s, got: %#v, want: %#v", name, tv.v, tt.want)
+		}
+	}
+}
+
+func TestTypedValueJSON(t *testing.T) {
+	values := []interface{}{
+		nil, true, "s", int(1), int8(2), int16(3), int32(4), int64(5),
+		uint(6), uint8(7), uint16(8), uint32(9), uint64(1<<64 - 1),
+		float32(1.5), float64(2.5), time.Date(2020, 1, 1, 12, 0, 0, 5, time.UTC), 90 * time.Minute,
+	}
+	for _, v := range values {
+		data, err := json.Marshal(typedValue{v})
+		if err != nil {
+			t.Errorf("unexpected error encoding %v: %v", v, err)
+		}
+		var tv typedValue
+		if err := json.Unmarshal(data, &tv); err != nil {
+			t.Errorf("unexpected error decoding %s: %v", data, err)
+		}
+		if !reflect.DeepEqual(tv.v, v) {
+			t.Errorf("incorrect decoded value, got: %#v, want: %#v", tv.v, v)
+		}
+	}
+}
@@ -0,0 +1,762 @@
+package diffq
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NewDiffFromChanges initializes a Diff from a list of changes received from an
+// external source. The lookup map and Changed flag are populated from the
+// changes; Original and New are left nil. Statements that use the $first and
+// $last modifiers require New and are not expanded.
+func NewDiffFromChanges(changes Changes) *Diff {
+	return newDiff(nil, nil, changes)
+}
+
+// jsonPatchOperation represents a single RFC 6902 JSON Patch operation.
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// NewDiffFromJSONPatch initializes a Diff from an RFC 6902 JSON Patch document.
+// If document is provided the patch is applied to it: the previous values of
+// changed paths are recorded in Change.From, the "-" array index is resolved,
+// "test" operations are verified and Original and New hold the document before
+// and after the patch. Without a document previous values are unknown and
+// "test" operations are ignored.
+//
+// Operations are mapped to changes as follows: "add" creates a value (or
+// updates an existing object member when the document is known), "remove"
+// deletes a value, "replace" updates a value, "copy" creates a value and
+// "move" moves an element within an array or otherwise deletes the value at
+// "from" and creates it at "path".
+func NewDiffFromJSONPatch(patch, document []byte) (*Diff, error) {
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, errors.Wrap(err, "patch error: invalid json patch")
+	}
+
+	known := document != nil
+	var original, doc interface{}
+	if known {
+		if err := json.Unmarshal(document, &original); err != nil {
+			return nil, errors.Wrap(err, "patch error: invalid document")
+		}
+		// decode a second copy which is modified by the patch
+		json.Unmarshal(document, &doc)
+	}
+
+	var changes Changes
+	for i, op := range ops {
+		path, err := parseJSONPointer(op.Path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "patch error: operation %d", i)
+		}
+		var value interface{}
+		if op.Value != nil {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, errors.Wrapf(err, "patch error: operation %d has invalid value", i)
+			}
+		}
+
+		var opChanges Changes
+		switch op.Op {
+		case "add":
+			opChanges, doc, err = jsonPatchAdd(doc, known, path, value)
+		case "remove":
+			var old interface{}
+			if known {
+				old, _ = jsonPointerGet(doc, path)
+				doc, err = jsonRemove(doc, path)
+			}
+			opChanges = Changes{{Type: ChangeDelete, Path: path, From: old}}
+		case "replace":
+			var old interface{}
+			if known {
+				var ok bool
+				if old, ok = jsonPointerGet(doc, path); !ok {
+					err = errors.Errorf("path %s does not exist", op.Path)
+					break
+				}
+				doc, err = jsonReplace(doc, path, value)
+			}
+			opChanges = Changes{{Type: ChangeUpdate, Path: path, From: old, To: value}}
+		case "copy", "move":
+			from, perr := parseJSONPointer(op.From)
+			if perr != nil {
+				err = perr
+				break
+			}
+			if known {
+				var ok bool
+				if value, ok = jsonPointerGet(doc, from); !ok {
+					err = errors.Errorf("path %s does not exist", op.From)
+					break
+				}
+				value = jsonClone(value)
+			}
+			if op.Op == "copy" {
+				opChanges, doc, err = jsonPatchAdd(doc, known, path, value)
+				break
+			}
+			if known {
+				if doc, err = jsonRemove(doc, from); err != nil {
+					break
+				}
+			}
+			if move, ok := jsonArrayMove(from, path, value); ok {
+				if known {
+					doc, err = jsonAdd(doc, path, value)
+				}
+				opChanges = Changes{move}
+				break
+			}
+			var added Changes
+			added, doc, err = jsonPatchAdd(doc, known, path, value)
+			opChanges = append(Changes{{Type: ChangeDelete, Path: from, From: value}}, added...)
+		case "test":
+			if known {
+				if current, ok := jsonPointerGet(doc, path); !ok || !reflect.DeepEqual(current, value) {
+					err = errors.Errorf("test of %s failed", op.Path)
+				}
+			}
+		default:
+			err = errors.Errorf("unsupported operation %s", op.Op)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "patch error: operation %d", i)
+		}
+		changes = append(changes, opChanges...)
+	}
+
+	return newDiff(original, doc, changes), nil
+}
+
+// jsonPatchAdd returns the change for adding value at path and, if the document
+// is known, the document with the value added.
+func jsonPatchAdd(doc interface{}, known bool, path []string, value interface{}) (Changes, interface{}, error) {
+	c := Change{Type: ChangeCreate, Path: path, To: value}
+	if !known {
+		return Changes{c}, doc, nil
+	}
+	if len(path) > 0 {
+		if arr, ok := jsonPointerParent(doc, path).([]interface{}); ok && path[len(path)-1] == "-" {
+			c.Path = appendPath(path[:len(path)-1], strconv.Itoa(len(arr)))
+		} else if m, ok := jsonPointerParent(doc, path).(map[string]interface{}); ok {
+			if old, exists := m[path[len(path)-1]]; exists {
+				c.Type, c.From = ChangeUpdate, old
+			}
+		}
+	}
+	doc, err := jsonAdd(doc, path, value)
+	return Changes{c}, doc, err
+}
+
+// jsonArrayMove returns a move change of the element value if from and path
+// identify elements of the same array.
+func jsonArrayMove(from, path []string, value interface{}) (Change, bool) {
+	if len(from) == 0 || len(from) != len(path) || !pathOverlaps(from[:len(from)-1], path[:len(path)-1]) {
+		return Change{}, false
+	}
+	fi, errFrom := strconv.Atoi(from[len(from)-1])
+	ti, errTo := strconv.Atoi(path[len(path)-1])
+	if errFrom != nil || errTo != nil {
+		return Change{}, false
+	}
+	return Change{Type: ChangeMove, Path: path, From: value, To: value, FromIndex: fi, ToIndex: ti}, true
+}
+
+// NewDiffFromMergePatch initializes a Diff from an RFC 7386 JSON Merge Patch
+// document. Members set to null are deleted and other members are updated,
+// recursing into nested objects. If document is provided the patch is applied
+// to it: previous values are recorded in Change.From, members not present in
+// the document are created and unchanged members are omitted. Original and New
+// hold the document before and after the patch.
+func NewDiffFromMergePatch(patch, document []byte) (*Diff, error) {
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, errors.Wrap(err, "patch error: invalid merge patch")
+	}
+
+	known := document != nil
+	var original interface{}
+	if known {
+		if err := json.Unmarshal(document, &original); err != nil {
+			return nil, errors.Wrap(err, "patch error: invalid document")
+		}
+	}
+
+	changes := mergePatchChanges([]string{}, original, known, p)
+	var result interface{}
+	if known {
+		var doc interface{}
+		json.Unmarshal(document, &doc)
+		result = mergePatchApply(doc, p)
+	}
+
+	return newDiff(original, result, changes), nil
+}
+
+// mergePatchChanges returns the changes made by applying the merge patch p to
+// the target at path.
+func mergePatchChanges(path []string, target interface{}, known bool, p interface{}) Changes {
+	pm, ok := p.(map[string]interface{})
+	if !ok {
+		if known && reflect.DeepEqual(target, p) {
+			return nil
+		}
+		return Changes{{Type: ChangeUpdate, Path: path, From: target, To: p}}
+	}
+
+	tm, isMap := target.(map[string]interface{})
+	if known && !isMap {
+		// a patch object replaces any value that is not an object
+		c := Change{Type: ChangeUpdate, Path: path, From: target, To: mergePatchApply(nil, p)}
+		if target == nil && len(path) > 0 {
+			c.Type = ChangeCreate
+		}
+		return Changes{c}
+	}
+
+	keys := make([]string, 0, len(pm))
+	for k := range pm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var changes Changes
+	for _, k := range keys {
+		pv := pm[k]
+		kpath := appendPath(path, k)
+		tv, exists := tm[k]
+		switch {
+		case pv == nil:
+			if known && !exists {
+				continue
+			}
+			changes = append(changes, Change{Type: ChangeDelete, Path: kpath, From: tv})
+		case known && !exists:
+			changes = append(changes, Change{Type: ChangeCreate, Path: kpath, To: mergePatchApply(nil, pv)})
+		default:
+			changes = append(changes, mergePatchChanges(kpath, tv, known, pv)...)
+		}
+	}
+	return changes
+}
+
+// mergePatchApply applies the merge patch p to target as defined by RFC 7386.
+func mergePatchApply(target, p interface{}) interface{} {
+	pm, ok := p.(map[string]interface{})
+	if !ok {
+		return p
+	}
+	tm, ok := target.(map[string]interface{})
+	if !ok {
+		tm = make(map[string]interface{})
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+		} else {
+			tm[k] = mergePatchApply(tm[k], v)
+		}
+	}
+	return tm
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its unescaped
+// reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.Errorf("invalid json pointer %s", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// jsonPointerGet returns the value at path within doc.
+func jsonPointerGet(doc interface{}, path []string) (interface{}, bool) {
+	for _, p := range path {
+		switch n := doc.(type) {
+		case map[string]interface{}:
+			v, ok := n[p]
+			if !ok {
+				return nil, false
+			}
+			doc = v
+		case []interface{}:
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, false
+			}
+			doc = n[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// jsonPointerParent returns the container holding the value at path within
+// doc.
+func jsonPointerParent(doc interface{}, path []string) interface{} {
+	parent, _ := jsonPointerGet(doc, path[:len(path)-1])
+	return parent
+}
+
+// jsonUpdate replaces the container holding the value at path within doc with
+// the result of fn returning the modified document.
+func jsonUpdate(doc interface{}, path []string, fn func(container interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	switch n := doc.(type) {
+	case map[string]interface{}:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, errors.Errorf("member %s does not exist", path[0])
+		}
+		nc, err := jsonUpdate(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = nc
+		return n, nil
+	case []interface{}:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i >= len(n) {
+			return nil, errors.Errorf("index %s out of range", path[0])
+		}
+		nc, err := jsonUpdate(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = nc
+		return n, nil
+	}
+	return nil, errors.Errorf("cannot traverse %s", path[0])
+}
+
+// jsonAdd adds value at path within doc as defined for the "add" operation.
+func jsonAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return jsonUpdate(doc, path, func(container interface{}, key string) (interface{}, error) {
+		switch n := container.(type) {
+		case map[string]interface{}:
+			n[key] = value
+			return n, nil
+		case []interface{}:
+			i := len(n)
+			if key != "-" {
+				var err error
+				if i, err = strconv.Atoi(key); err != nil || i < 0 || i > len(n) {
+					return nil, errors.Errorf("index %s out of range", key)
+				}
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		return nil, errors.Errorf("cannot add %s", key)
+	})
+}
+
+// jsonRemove removes the value at path within doc.
+func jsonRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	return jsonUpdate(doc, path, func(container interface{}, key string) (interface{}, error) {
+		switch n := container.(type) {
+		case map[string]interface{}:
+			if _, ok := n[key]; !ok {
+				return nil, errors.Errorf("member %s does not exist", key)
+			}
+			delete(n, key)
+			return n, nil
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(n) {
+				return nil, errors.Errorf("index %s out of range", key)
+			}
+			return append(n[:i], n[i+1:]...), nil
+		}
+		return nil, errors.Errorf("cannot remove %s", key)
+	})
+}
+
+// jsonReplace replaces the value at path within doc.
+func jsonReplace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	doc, err := jsonRemove(doc, path)
+	if err != nil {
+		return nil, err
+	}
+	return jsonAdd(doc, path, value)
+}
+
+// jsonClone returns a deep copy of the decoded JSON value v.
+func jsonClone(v interface{}) interface{} {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, e := range n {
+			m[k] = jsonClone(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(n))
+		for i, e := range n {
+			s[i] = jsonClone(e)
+		}
+		return s
+	}
+	return v
+}
+
+// JSONPatchOption configures the conversion of a Diff to a JSON Patch.
+type JSONPatchOption func(*jsonPatchConfig)
+
+// jsonPatchConfig holds the options used when converting a Diff to a JSON
+// Patch.
+type jsonPatchConfig struct {
+	jsonTags bool
+}
+
+// WithJSONTags names the JSON Pointer segments of struct fields using their
+// json struct tags, matching the encoding/json representation of the value.
+// Fields of embedded structs without a name are promoted to the enclosing
+// struct as they are by encoding/json.
+func WithJSONTags() JSONPatchOption {
+	return func(c *jsonPatchConfig) {
+		c.jsonTags = true
+	}
+}
+
+// JSONPatch converts the changes of the Diff, d, into an RFC 6902 JSON Patch
+// which transforms the original value into the new value. Created, updated and
+// deleted values become "add", "replace" and "remove" operations and moved
+// elements become "move" operations. Operations on slices are ordered so that
+// the indices of each operation are valid when applied in sequence. The
+// structure of the original value is used to identify slices; when it is not
+// available the changes are converted in order.
+func (d *Diff) JSONPatch(opts ...JSONPatchOption) ([]byte, error) {
+	cfg := &jsonPatchConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	var entries []patchEntry
+	for _, c := range d.Changes {
+		entries = append(entries, patchEntry{change: c, rel: c.Path})
+	}
+
+	e := &jsonPatchEmitter{cfg: cfg, ops: []jsonPatchOperation{}}
+	if err := e.emit([]string{}, reflect.ValueOf(d.Original), entries); err != nil {
+		return nil, errors.Wrap(err, "patch error: failed to convert changes")
+	}
+	return json.Marshal(e.ops)
+}
+
+// jsonPatchEmitter accumulates the JSON Patch operations for a set of changes.
+type jsonPatchEmitter struct {
+	cfg *jsonPatchConfig
+	ops []jsonPatchOperation
+}
+
+// op appends an operation of type op for path with the value v.
+func (e *jsonPatchEmitter) op(op string, path []string, v interface{}) error {
+	o := jsonPatchOperation{Op: op, Path: formatJSONPointer(path)}
+	if op == "add" || op == "replace" {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		o.Value = raw
+	}
+	e.ops = append(e.ops, o)
+	return nil
+}
+
+// move appends a move operation from the path from to the path to.
+func (e *jsonPatchEmitter) move(from, to []string) {
+	e.ops = append(e.ops, jsonPatchOperation{Op: "move", From: formatJSONPointer(from), Path: formatJSONPointer(to)})
+}
+
+// leaf appends the operation for a change to the value at path.
+func (e *jsonPatchEmitter) leaf(path []string, c Change) error {
+	switch c.Type {
+	case ChangeCreate:
+		return e.op("add", path, c.To)
+	case ChangeUpdate:
+		return e.op("replace", path, c.To)
+	case ChangeDelete:
+		return e.op("remove", path, nil)
+	case ChangeMove:
+		if len(path) == 0 {
+			return errors.New("move of root value")
+		}
+		e.move(appendPath(path[:len(path)-1], fmt.Sprint(c.FromIndex)), path)
+		return nil
+	}
+	return errors.Errorf("unsupported change type %s", c.Type)
+}
+
+// emit appends the operations for entries whose paths are relative to the
+// value v located at path.
+func (e *jsonPatchEmitter) emit(path []string, v reflect.Value, entries []patchEntry) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	var nested []patchEntry
+	for _, en := range entries {
+		if len(en.rel) == 0 {
+			if err := e.leaf(path, en.change); err != nil {
+				return err
+			}
+		} else {
+			nested = append(nested, en)
+		}
+	}
+	if len(nested) == 0 {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		keys, groups := groupEntries(nested)
+		for _, k := range keys {
+			field, segment := v.FieldByName(k), k
+			for i := 0; i < v.NumField(); i++ {
+				if name, ok := fieldPathName(v.Type().Field(i)); ok && name == k {
+					field, segment = v.Field(i), e.fieldSegment(v.Type().Field(i), k)
+					break
+				}
+			}
+			fpath := path
+			if segment != "" {
+				fpath = appendPath(path, segment)
+			}
+			if err := e.emit(fpath, field, groups[k]); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		keys, groups := groupEntries(nested)
+		for _, k := range keys {
+			var ev reflect.Value
+			if key, ok := mapKey(v, k); ok {
+				ev = v.MapIndex(key)
+			}
+			kpath := appendPath(path, k)
+			switch elementAction(groups[k], v.Type().Elem()) {
+			case ChangeCreate:
+				value, err := e.element(kpath, v.Type().Elem(), groups[k])
+				if err != nil {
+					return err
+				}
+				if err := e.op("add", kpath, value); err != nil {
+					return err
+				}
+			case ChangeDelete:
+				if err := e.op("remove", kpath, nil); err != nil {
+					return err
+				}
+			default:
+				if err := e.emit(kpath, ev, groups[k]); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if hasIdentifiedElements(v) {
+			return errors.Errorf("cannot convert changes to %s; elements are identified by value", formatJSONPointer(path))
+		}
+		return e.emitSlice(path, v, nested)
+	default:
+		// structure unknown; convert changes in order
+		for _, en := range nested {
+			if err := e.leaf(appendPath(path, en.rel...), en.change); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// emitSlice appends the operations for changes to the elements of the slice v.
+// Elements modified in place are patched first while their indices match the
+// original, followed by the removal of deleted elements in descending order.
+// The remaining elements are then arranged position by position, adding
+// created elements and moving reordered elements.
+func (e *jsonPatchEmitter) emitSlice(path []string, v reflect.Value, entries []patchEntry) error {
+	elemType := v.Type().Elem()
+	moveFrom := make(map[int]int)
+	var rest []patchEntry
+	for _, en := range entries {
+		if len(en.rel) == 1 && en.change.Type == ChangeMove {
+			to, err := strconv.Atoi(en.rel[0])
+			if err != nil {
+				return errors.Errorf("invalid index %s", en.rel[0])
+			}
+			moveFrom[to] = en.change.FromIndex
+		} else {
+			rest = append(rest, en)
+		}
+	}
+
+	created := make(map[int]interface{})
+	modified := make(map[int]bool)
+	removed := make(map[int]bool)
+	var removals []int
+
+	keys, groups := groupEntries(rest)
+	for _, k := range keys {
+		idx, err := strconv.Atoi(k)
+		if err != nil || idx < 0 {
+			return errors.Errorf("invalid index %s", k)
+		}
+		switch elementAction(groups[k], elemType) {
+		case ChangeCreate:
+			value, err := e.element(appendPath(path, k), elemType, groups[k])
+			if err != nil {
+				return err
+			}
+			created[idx] = value
+		case ChangeDelete:
+			removed[idx] = true
+			removals = append(removals, idx)
+		default:
+			var ev reflect.Value
+			if idx < v.Len() {
+				ev = v.Index(idx)
+			}
+			if err := e.emit(appendPath(path, k), ev, groups[k]); err != nil {
+				return err
+			}
+			modified[idx] = true
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(removals)))
+	for _, idx := range removals {
+		if err := e.op("remove", appendPath(path, strconv.Itoa(idx)), nil); err != nil {
+			return err
+		}
+	}
+
+	// current holds the original index of each element in its current position;
+	// created elements are recorded as -1
+	var current []int
+	moved := make(map[int]bool)
+	for _, from := range moveFrom {
+		moved[from] = true
+	}
+	for i := 0; i < v.Len(); i++ {
+		if !removed[i] {
+			current = append(current, i)
+		}
+	}
+	length := len(current) + len(created)
+	next := 0
+	for j := 0; j < length; j++ {
+		if value, ok := created[j]; ok {
+			if err := e.op("add", appendPath(path, strconv.Itoa(j)), value); err != nil {
+				return err
+			}
+			current = append(current[:j], append([]int{-1}, current[j:]...)...)
+			continue
+		}
+
+		want := -1
+		if from, ok := moveFrom[j]; ok {
+			want = from
+		} else if modified[j] {
+			want = j
+		} else {
+			for next < v.Len() && (removed[next] || moved[next] || modified[next]) {
+				next++
+			}
+			want = next
+			next++
+		}
+
+		at := -1
+		for p := j; p < len(current); p++ {
+			if current[p] == want {
+				at = p
+				break
+			}
+		}
+		if at < 0 {
+			return errors.Errorf("changes are inconsistent with %s", formatJSONPointer(path))
+		}
+		if at != j {
+			e.move(appendPath(path, strconv.Itoa(at)), appendPath(path, strconv.Itoa(j)))
+			current = append(current[:at], current[at+1:]...)
+			current = append(current[:j], append([]int{want}, current[j:]...)...)
+		}
+	}
+	return nil
+}
+
+// element reconstructs a created slice element or map entry of type t from its
+// changes.
+func (e *jsonPatchEmitter) element(path []string, t reflect.Type, entries []patchEntry) (interface{}, error) {
+	elem := reflect.New(t).Elem()
+	p := &patcher{}
+	p.apply(elem, entries)
+	if len(p.conflicts) > 0 {
+		return nil, errors.Errorf("invalid changes for %s", formatJSONPointer(path))
+	}
+	return elem.Interface(), nil
+}
+
+// fieldSegment returns the JSON Pointer segment for the struct field f named
+// name in the path. An empty segment indicates the field is promoted into the
+// enclosing struct.
+func (e *jsonPatchEmitter) fieldSegment(f reflect.StructField, name string) string {
+	if !e.cfg.jsonTags {
+		return name
+	}
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	if tag == "-" {
+		return name
+	}
+	if tag == "" {
+		if f.Anonymous {
+			return ""
+		}
+		return f.Name
+	}
+	return tag
+}
+
+// formatJSONPointer joins path into an RFC 6901 JSON Pointer escaping each
+// reference token.
+func formatJSONPointer(path []string) string {
+	var b strings.Builder
+	for _, p := range path {
+		b.WriteString("/")
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(p))
+	}
+	return b.String()
+}
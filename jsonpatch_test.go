@@ -0,0 +1,181 @@
+package diffq
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewDiffFromChanges(t *testing.T) {
+	d := NewDiffFromChanges(Changes{
+		{Type: ChangeUpdate, Path: []string{"Status"}, From: "Draft", To: "Done"},
+		{Type: ChangeCreate, Path: []string{"Tags", "0"}, To: "urgent"},
+	})
+	if !d.Changed || len(d.ChangeLogMap) != 2 {
+		t.Fatalf("incorrect diff from changes, got: %+v", d)
+	}
+	if ok, _ := d.EvaluateStatement(`AND(EVAL(Status ["Draft"] => "Done"), EVAL(Tags.* => $created))`); !ok {
+		t.Errorf("incorrect result evaluating diff from changes, got: %t, want: %t", ok, true)
+	}
+	if NewDiffFromChanges(nil).Changed {
+		t.Errorf("empty diff marked as changed")
+	}
+}
+
+func TestNewDiffFromJSONPatch(t *testing.T) {
+	document := []byte(`{"status": "Draft", "count": 1, "tags": ["a", "b", "c"], "owner": {"name": "x"}}`)
+	patch := []byte(`[
+		{"op": "test", "path": "/status", "value": "Draft"},
+		{"op": "replace", "path": "/status", "value": "Done"},
+		{"op": "add", "path": "/tags/-", "value": "d"},
+		{"op": "move", "from": "/tags/0", "path": "/tags/2"},
+		{"op": "remove", "path": "/owner/name"},
+		{"op": "copy", "from": "/count", "path": "/a~1b"}
+	]`)
+
+	d, err := NewDiffFromJSONPatch(patch, document)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var want interface{}
+	json.Unmarshal([]byte(`{"status": "Done", "count": 1, "tags": ["b", "c", "a", "d"], "owner": {}, "a/b": 1}`), &want)
+	if !reflect.DeepEqual(d.New, want) {
+		t.Errorf("incorrect patched document, got: %v, want: %v", d.New, want)
+	}
+
+	var paths []string
+	for _, c := range d.Changes {
+		paths = append(paths, string(c.Type)+" "+strings.Join(c.Path, "."))
+	}
+	wantPaths := []string{"update status", "create tags.3", "move tags.2", "delete owner.name", "create a/b"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("incorrect changes, got: %v, want: %v", paths, wantPaths)
+	}
+
+	tests := map[string]bool{
+		`AND(EVAL(status ["Draft"] => "Done"))`: true,
+		`AND(EVAL(tags.$last => $created))`:     true,
+		`AND(EVAL(tags.* => $moved))`:           true,
+		`AND(EVAL(owner.name ["x"] => nil))`:    true,
+	}
+	for statement, want := range tests {
+		got, err := d.EvaluateStatement(statement)
+		if err != nil {
+			t.Errorf("unexpected error evaluating %s: %v", statement, err)
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", statement, got, want)
+		}
+	}
+
+	if _, err := NewDiffFromJSONPatch([]byte(`[{"op": "test", "path": "/status", "value": "Done"}]`), document); err == nil {
+		t.Errorf("expected error for failed test operation")
+	}
+
+	d, err = NewDiffFromJSONPatch(patch, nil)
+	if err != nil {
+		t.Fatalf("unexpected error without document: %v", err)
+	}
+	if len(d.Changes) != 5 || d.Changes[0].From != nil || d.Changes[1].Path[1] != "-" {
+		t.Errorf("incorrect changes without document, got: %v", d.Changes)
+	}
+}
+
+func TestNewDiffFromMergePatch(t *testing.T) {
+	document := []byte(`{"status": "Draft", "owner": {"name": "x", "team": "y"}, "tags": ["a"]}`)
+	patch := []byte(`{"status": "Done", "owner": {"team": null, "email": "e"}, "tags": ["a"], "spec": {"n": 1, "z": null}}`)
+
+	d, err := NewDiffFromMergePatch(patch, document)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var want interface{}
+	json.Unmarshal([]byte(`{"status": "Done", "owner": {"name": "x", "email": "e"}, "tags": ["a"], "spec": {"n": 1}}`), &want)
+	if !reflect.DeepEqual(d.New, want) {
+		t.Errorf("incorrect patched document, got: %v, want: %v", d.New, want)
+	}
+
+	var paths []string
+	for _, c := range d.Changes {
+		paths = append(paths, string(c.Type)+" "+strings.Join(c.Path, "."))
+	}
+	wantPaths := []string{"create owner.email", "delete owner.team", "create spec", "update status"}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("incorrect changes, got: %v, want: %v", paths, wantPaths)
+	}
+
+	d, err = NewDiffFromMergePatch(patch, nil)
+	if err != nil {
+		t.Fatalf("unexpected error without document: %v", err)
+	}
+	if ok, _ := d.EvaluateStatement(`AND(EVAL(spec.n => 1), EVAL(owner.team => $deleted))`); !ok {
+		t.Errorf("incorrect result evaluating merge patch without document, got: %t, want: %t", ok, true)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	a, b := newPatchTypes()
+	a.Keyed, b.Keyed = nil, nil
+	d, err := Differential(a, b, WithMoves())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	patch, err := d.JSONPatch(WithJSONTags())
+	if err != nil {
+		t.Fatalf("unexpected error converting diff: %v", err)
+	}
+
+	// applying the patch to the encoded original must produce the encoded new
+	// value
+	original, _ := json.Marshal(a)
+	patched, err := NewDiffFromJSONPatch(patch, original)
+	if err != nil {
+		t.Fatalf("unexpected error applying patch %s: %v", patch, err)
+	}
+	var want interface{}
+	encoded, _ := json.Marshal(b)
+	json.Unmarshal(encoded, &want)
+	if !reflect.DeepEqual(patched.New, want) {
+		t.Errorf("incorrect result applying patch %s, got: %v, want: %v", patch, patched.New, want)
+	}
+}
+
+func TestJSONPatchPointers(t *testing.T) {
+	type Tagged struct {
+		Name  string            `json:"name"`
+		Attrs map[string]string `json:"attrs"`
+	}
+	d, _ := Differential(
+		&Tagged{Name: "a", Attrs: map[string]string{"a/b": "1", "c~d": "2"}},
+		&Tagged{Name: "b", Attrs: map[string]string{"a/b": "3"}},
+	)
+
+	got := map[string]string{}
+	for _, opts := range [][]JSONPatchOption{nil, {WithJSONTags()}} {
+		patch, err := d.JSONPatch(opts...)
+		if err != nil {
+			t.Fatalf("unexpected error converting diff: %v", err)
+		}
+		var ops []jsonPatchOperation
+		json.Unmarshal(patch, &ops)
+		for _, op := range ops {
+			got[op.Op+" "+op.Path] = string(op.Value)
+		}
+	}
+
+	want := map[string]string{
+		`replace /Name`:       `"b"`,
+		`replace /Attrs/a~1b`: `"3"`,
+		`remove /Attrs/c~0d`:  ``,
+		`replace /name`:       `"b"`,
+		`replace /attrs/a~1b`: `"3"`,
+		`remove /attrs/c~0d`:  ``,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect operations, got: %v, want: %v", got, want)
+	}
+}
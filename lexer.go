@@ -1,5 +1,15 @@
 package diffq
 
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
 // lexer represents the lexical analyzer that parses/tokenizes the diffq
 // language.
 type lexer struct {
@@ -10,8 +20,9 @@ type lexer struct {
 	// readPosition is the current position in the input (after the current
 	// char)
 	readPosition int
-	// ch is the current character to parse
-	ch byte
+	// ch is the current character to parse; utf8.RuneError for an invalid
+	// encoding
+	ch rune
 }
 
 // newLexer initializes a new lexer with the provided input.
@@ -27,21 +38,25 @@ func newLexer(input string) *lexer {
 // token derived from the input is returned with the identified type and the
 // literal value.
 func (l *lexer) nextToken() *token {
-	tok := &token{}
-
 	// whitespace is insignificant in the diffq language other than the
 	// separation of tokens.
 	l.skipWhitespace()
 
+	position := l.position
+	tok := l.readToken()
+	tok.tpos = position
+	return tok
+}
+
+// readToken reads the token starting at the current character.
+func (l *lexer) readToken() *token {
+	tok := &token{}
+
 	switch l.ch {
 	// comments
 	case '/':
 		if l.peekChar() == '*' {
-			l.readChar()
-			tok.tliteral = l.readComment()
-			tok.ttype = cCOMMENT
-			l.readChar()
-			return tok
+			return l.readLiteral(cCOMMENT, l.readComment)
 		}
 		tok = newToken(cILLEGAL, l.ch)
 	// asterisk
@@ -63,9 +78,21 @@ func (l *lexer) nextToken() *token {
 	case ']':
 		tok = newToken(cRBRACKET, l.ch)
 	// string / quote
-	case '"':
-		tok.ttype = cSTRING
-		tok.tliteral = l.readString()
+	case '"', '`':
+		raw := l.ch == '`'
+		tok = l.readLiteral(cSTRING, l.readString)
+		tok.traw = raw && tok.ttype == cSTRING
+		return tok
+	// paths relative to the scope of EACH; .field
+	case '.':
+		tok.tliteral = l.readIdentifier()
+		tok.ttype = cIDENT
+		return tok
+	// query placeholders; :name
+	case ':':
+		tok.tliteral = l.readIdentifier()
+		tok.ttype = cIDENT
+		return tok
 	// special keywords; $created, $deleted
 	case '$':
 		tok.tliteral = l.readIdentifier()
@@ -85,23 +112,40 @@ func (l *lexer) nextToken() *token {
 		if isLetter(l.ch) {
 			if l.ch == 'd' && l.peekChar() == '"' {
 				l.readChar()
-				tok.tliteral = l.readString()
-				tok.ttype = cDURATION
-				l.readChar()
-				return tok
+				return l.readLiteral(cDURATION, l.readString)
 			} else if l.ch == 't' && l.peekChar() == '"' {
 				l.readChar()
-				tok.tliteral = l.readString()
-				tok.ttype = cTIME
-				l.readChar()
+				return l.readLiteral(cTIME, l.readTime)
+			} else if l.startsTimeExpression() {
+				return l.readLiteral(cTIMEEXPR, l.readTimeExpression)
+			} else if l.startsAggregate() {
+				return l.readLiteral(cAGGREGATE, l.readAggregate)
+			} else if mods, ok := l.readStringModifiers(); ok {
+				raw := l.ch == '`'
+				tok = l.readLiteral(cSTRING, l.readString)
+				if tok.ttype == cSTRING {
+					tok.traw, tok.tmods = raw, mods
+				}
 				return tok
 			}
 			tok.tliteral = l.readIdentifier()
 			tok.ttype = lookupIdent(tok.tliteral)
 			return tok
 		} else if isDigit(l.ch) || isNegativeSign(l.ch) {
-			tok.tliteral, tok.ttype = l.readNumber()
+			position := l.position
+			tok.tliteral = l.readNumber()
+			ttype, _, err := parseNumber(tok.tliteral)
+			if err != nil {
+				tok.ttype = cILLEGAL
+				tok.terr = errors.Errorf("%s at offset %d", err, position)
+				return tok
+			}
+			tok.ttype = ttype
 			return tok
+		} else if l.ch == utf8.RuneError && l.readPosition-l.position == 1 {
+			tok = newToken(cILLEGAL, l.ch)
+			tok.tliteral = l.input[l.position:l.readPosition]
+			tok.terr = errors.Errorf("invalid UTF-8 encoding at offset %d", l.position)
 		} else {
 			tok = newToken(cILLEGAL, l.ch)
 		}
@@ -119,23 +163,38 @@ func (l *lexer) skipWhitespace() {
 	}
 }
 
-// readChar advances the current position of the lexer in the input.
+// readChar advances the current position of the lexer in the input decoding
+// the next UTF-8 encoded character.
 func (l *lexer) readChar() {
+	l.position = l.readPosition
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
-	} else {
-		l.ch = l.input[l.readPosition]
+		l.readPosition++
+		return
 	}
-	l.position = l.readPosition
-	l.readPosition++
+	ch, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = ch
+	l.readPosition += width
+}
+
+// atEOF reports whether the lexer has consumed the input.
+func (l *lexer) atEOF() bool {
+	return l.position >= len(l.input)
+}
+
+// seek moves the lexer to the byte offset pos in the input.
+func (l *lexer) seek(pos int) {
+	l.readPosition = pos
+	l.readChar()
 }
 
 // peekChar looks ahead to the next character in the input.
-func (l *lexer) peekChar() byte {
+func (l *lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	}
-	return l.input[l.readPosition]
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 // readOperator advances the input until the end of the operator. The start of
@@ -157,89 +216,240 @@ func (l *lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-// readNumber advances the input until the end of the number.
-func (l *lexer) readNumber() (string, tokenType) {
+// readNumber advances the input until the end of the number. The number is
+// checked separately, see parseNumber.
+func (l *lexer) readNumber() string {
 	position := l.position
 	if l.ch == '-' {
 		l.readChar()
 	}
-	seenDecimal := false
-	for isDigit(l.ch) || (isDecimal(l.ch) && !seenDecimal) {
-		if isDecimal(l.ch) {
-			seenDecimal = true
+	hex := l.ch == '0' && (l.peekChar() == 'x' || l.peekChar() == 'X')
+	// a sign may follow the exponent marker; 'e' is a digit of a hex number
+	exponent := false
+	for isDigit(l.ch) || isLetter(l.ch) || l.ch == '_' || isDecimal(l.ch) || (exponent && (l.ch == '+' || l.ch == '-')) {
+		exponent = l.ch == 'p' || l.ch == 'P' || (!hex && (l.ch == 'e' || l.ch == 'E'))
+		l.readChar()
+	}
+	return l.input[position:l.position]
+}
+
+// readLiteral returns the token of type ttype read by read. A token that cannot
+// be read is returned as an ILLEGAL token holding the text consumed along with
+// the error.
+func (l *lexer) readLiteral(ttype tokenType, read func() (string, error)) *token {
+	position := l.position
+	literal, err := read()
+	if err != nil {
+		return &token{ttype: cILLEGAL, tliteral: l.input[position:l.position], terr: err}
+	}
+	return &token{ttype: ttype, tliteral: literal}
+}
+
+// readString advances the input past the end of the string returning its
+// value. A string is delimited by '"' and may hold the escape sequences of a Go
+// string literal, e.g. \" or \u00e9, or is delimited by '`' and holds its
+// content verbatim.
+func (l *lexer) readString() (string, error) {
+	start, quote := l.position, l.ch
+	var b strings.Builder
+	l.readChar()
+	for l.ch != quote {
+		switch {
+		case l.atEOF():
+			return "", errors.Errorf("unterminated string at offset %d", start)
+		case l.ch == utf8.RuneError && l.readPosition-l.position == 1:
+			return "", errors.Errorf("invalid UTF-8 encoding at offset %d", l.position)
+		case l.ch == '\\' && quote == '"':
+			value, multibyte, tail, err := strconv.UnquoteChar(l.input[l.position:], '"')
+			if err != nil {
+				return "", errors.Errorf("invalid escape sequence at offset %d", l.position)
+			}
+			if value < utf8.RuneSelf || !multibyte {
+				b.WriteByte(byte(value))
+			} else {
+				b.WriteRune(value)
+			}
+			l.seek(len(l.input) - len(tail))
+			continue
+		default:
+			b.WriteString(l.input[l.position:l.readPosition])
 		}
 		l.readChar()
 	}
-	if seenDecimal {
-		return l.input[position:l.position], cFLOAT
+	l.readChar()
+	return b.String(), nil
+}
+
+// readStringModifiers advances the input past the modifiers of a string
+// literal, e.g. the "is" of is"done", returning them in canonical order. The
+// input is not advanced and false is returned if no string literal follows.
+func (l *lexer) readStringModifiers() (string, bool) {
+	i := l.position
+	for i < len(l.input) && isLetter(rune(l.input[i])) {
+		i++
+	}
+	if i == len(l.input) || (l.input[i] != '"' && l.input[i] != '`') {
+		return "", false
+	}
+	mods, ok := parseStringModifiers(l.input[l.position:i])
+	if !ok {
+		return "", false
+	}
+	l.seek(i)
+	return mods, true
+}
+
+// readTime advances the input past the end of the time literal returning its
+// content once checked, see parseTime.
+func (l *lexer) readTime() (string, error) {
+	start := l.position
+	s, err := l.readString()
+	if err != nil {
+		return "", err
+	}
+	if _, err := parseTime(s, time.UTC); err != nil {
+		return "", errors.Errorf("%s at offset %d", err, start)
 	}
-	return l.input[position:l.position], cINT
+	return s, nil
 }
 
-// readString advances the input until the end of the string. The start and end
-// is indicated by a '"'.
-func (l *lexer) readString() string {
-	position := l.position + 1
+// startsTimeExpression reports whether a time expression, e.g. now() or
+// day(...), starts at the current character.
+func (l *lexer) startsTimeExpression() bool {
+	name, rest := splitTimeFunction(l.input[l.position:])
+	return isTimeFunction(name) && strings.HasPrefix(rest, "(")
+}
+
+// readTimeExpression advances the input past the end of the time expression
+// returning its canonical form. An offset, e.g. now() - d"24h", is read as part
+// of the expression.
+func (l *lexer) readTimeExpression() (string, error) {
+	start := l.position
+	for isLetter(l.ch) {
+		l.readChar()
+	}
+	depth := 0
 	for {
+		switch {
+		case l.atEOF():
+			return "", errors.Errorf("unterminated time expression at offset %d", start)
+		case l.ch == '"':
+			if _, err := l.readString(); err != nil {
+				return "", err
+			}
+			continue
+		case l.ch == '(':
+			depth++
+		case l.ch == ')':
+			depth--
+		}
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
+		if depth == 0 {
 			break
 		}
 	}
-	return l.input[position:l.position]
-}
 
-// readComment advances the input until the end of the comment. The start and
-// end of the comment are indicated by "/*" and "*/" respectively.
-func (l *lexer) readComment() string {
-	position := l.position + 1
-	for {
+	// an offset following a relative time
+	end := l.position
+	l.skipWhitespace()
+	if l.ch == '+' || l.ch == '-' {
 		l.readChar()
-		if l.ch == '*' && l.peekChar() == '/' {
+		l.skipWhitespace()
+		if l.ch == 'd' && l.peekChar() == '"' {
 			l.readChar()
-			break
+			if _, err := l.readString(); err != nil {
+				return "", err
+			}
+			end = l.position
 		}
 	}
-	return l.input[position : l.position-1]
+	l.seek(end)
+
+	e, err := parseTimeExpr(l.input[start:end])
+	if err != nil {
+		return "", errors.Errorf("%s at offset %d", err, start)
+	}
+	return e.String(), nil
+}
+
+// startsAggregate reports whether a collection expression, e.g. LEN(...) or
+// COUNT(...), starts at the current character.
+func (l *lexer) startsAggregate() bool {
+	name, rest := splitTimeFunction(l.input[l.position:])
+	return isAggregateFunction(name) && strings.HasPrefix(rest, "(")
+}
+
+// readAggregate advances the input past the end of the collection expression
+// returning its canonical form.
+func (l *lexer) readAggregate() (string, error) {
+	start := l.position
+	for l.ch != ')' {
+		if l.atEOF() {
+			return "", errors.Errorf("unterminated collection expression at offset %d", start)
+		}
+		l.readChar()
+	}
+	l.readChar()
+
+	a, err := parseAggregate(l.input[start:l.position])
+	if err != nil {
+		return "", errors.Errorf("%s at offset %d", err, start)
+	}
+	return a.String(), nil
+}
+
+// readComment advances the input past the end of the comment returning its
+// content. The start and end of the comment are indicated by "/*" and "*/"
+// respectively.
+func (l *lexer) readComment() (string, error) {
+	start := l.position
+	end := strings.Index(l.input[start+2:], "*/")
+	if end < 0 {
+		l.seek(len(l.input))
+		return "", errors.Errorf("unterminated comment at offset %d", start)
+	}
+	end += start + 2
+	l.seek(end + 2)
+	return l.input[start+2 : end], nil
 }
 
 // newToken creates a new token with the type and literal value specified.
-func newToken(tokenType tokenType, ch byte) *token {
+func newToken(tokenType tokenType, ch rune) *token {
 	return &token{ttype: tokenType, tliteral: string(ch)}
 }
 
-func isConcatenator(ch byte) bool {
+func isConcatenator(ch rune) bool {
 	return ch == '_' || ch == '.'
 }
 
-func isSpecial(ch byte) bool {
-	return ch == '$' || ch == '-' || ch == '*'
+func isSpecial(ch rune) bool {
+	return ch == '$' || ch == '-' || ch == '*' || ch == ':'
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func isNegativeSign(ch byte) bool {
+func isNegativeSign(ch rune) bool {
 	return ch == '-'
 }
 
-func isDecimal(ch byte) bool {
+func isDecimal(ch rune) bool {
 	return ch == '.'
 }
 
-func isEqualSign(ch byte) bool {
+func isEqualSign(ch rune) bool {
 	return ch == '='
 }
 
-func isAngleBracket(ch byte) bool {
+func isAngleBracket(ch rune) bool {
 	return ch == '>' || ch == '<'
 }
 
-func isExclamationPoint(ch byte) bool {
+func isExclamationPoint(ch rune) bool {
 	return ch == '!'
 }
@@ -1,6 +1,7 @@
 package diffq
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -216,3 +217,130 @@ func TestLexerTokenization(t *testing.T) {
 		}
 	}
 }
+
+func TestLexerStrings(t *testing.T) {
+	tests := map[string]string{
+		`"plain"`:              "plain",
+		`"say \"hi\""`:         `say "hi"`,
+		`"a\\b"`:               `a\b`,
+		`"line\nbreak\ttab"`:   "line\nbreak\ttab",
+		`"café"`:               "café",
+		`"café ☕"`:             "café ☕",
+		"`raw \\n \"quoted\"`": `raw \n "quoted"`,
+		"`multi\nline`":        "multi\nline",
+		`"\x41\101\U0001F600"`: "AA😀",
+	}
+	for input, want := range tests {
+		tok := newLexer(input).nextToken()
+		if tok.ttype != cSTRING || tok.tliteral != want {
+			t.Errorf("incorrect result for %s, got: %s %q, want: %q", input, tok.ttype, tok.tliteral, want)
+		}
+	}
+
+	errs := map[string]string{
+		`EVAL(S => "open`:       "unterminated string at offset 10",
+		"EVAL(S => `open":       "unterminated string at offset 10",
+		`EVAL(S => d"2h)`:       "unterminated string at offset 11",
+		`EVAL(S => "\q")`:       "invalid escape sequence at offset 11",
+		`EVAL(S => "\u00")`:     "invalid escape sequence at offset 11",
+		"EVAL(S => \"a\xffb\")": "invalid UTF-8 encoding at offset 12",
+		"EVAL(S\xff => 1)":      "invalid UTF-8 encoding at offset 6",
+		`AND(TRUE) /* open`:     "unterminated comment at offset 10",
+		`/*/`:                   "unterminated comment at offset 0",
+	}
+	for input, want := range errs {
+		var illegal *token
+		lex := newLexer(input)
+		for tok := lex.nextToken(); tok.ttype != cEOF; tok = lex.nextToken() {
+			if tok.ttype == cILLEGAL {
+				illegal = tok
+				break
+			}
+		}
+		if illegal == nil || illegal.terr == nil || illegal.terr.Error() != want {
+			t.Errorf("incorrect error for %q, got: %v, want: %s", input, illegal, want)
+		}
+		if err := validate(input); err == nil || err.Error() != "validation error: "+want {
+			t.Errorf("incorrect validation error for %q, got: %v, want: %s", input, err, want)
+		}
+	}
+}
+
+func TestLexerUnicodeIdentifiers(t *testing.T) {
+	tokens := []*token{}
+	lex := newLexer(`EVAL(Größe.naïve => "ü")`)
+	for tok := lex.nextToken(); tok.ttype != cEOF; tok = lex.nextToken() {
+		tokens = append(tokens, tok)
+	}
+	want := []token{
+		{ttype: cEVAL, tliteral: "EVAL", tpos: 0},
+		{ttype: cLPAREN, tliteral: "(", tpos: 4},
+		{ttype: cIDENT, tliteral: "Größe.naïve", tpos: 5},
+		{ttype: cGOESTO, tliteral: "=>", tpos: 20},
+		{ttype: cSTRING, tliteral: "ü", tpos: 23},
+		{ttype: cRPAREN, tliteral: ")", tpos: 27},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("incorrect token count, got: %d, want: %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		if *tok != want[i] {
+			t.Errorf("incorrect token %d, got: %v@%d, want: %v@%d", i, tok, tok.tpos, &want[i], want[i].tpos)
+		}
+	}
+}
+
+func TestLexerStringModifiers(t *testing.T) {
+	tests := map[string]token{
+		`i"Done"`:    {ttype: cSTRING, tliteral: "Done", tmods: "i"},
+		`si"Done"`:   {ttype: cSTRING, tliteral: "Done", tmods: "is"},
+		`nis"Done"`:  {ttype: cSTRING, tliteral: "Done", tmods: "isn"},
+		"i`C:\\dir`": {ttype: cSTRING, tliteral: `C:\dir`, tmods: "i", traw: true},
+		`ii"Done"`:   {ttype: cIDENT, tliteral: "ii"},
+		`is "Done"`:  {ttype: cIDENT, tliteral: "is"},
+		`x"Done"`:    {ttype: cIDENT, tliteral: "x"},
+	}
+	for input, want := range tests {
+		tok := newLexer(input).nextToken()
+		if *tok != want {
+			t.Errorf("incorrect result for %s, got: %v %q %t, want: %v %q %t", input, tok, tok.tmods, tok.traw, &want, want.tmods, want.traw)
+		}
+	}
+
+	tok := newLexer(`is"open`).nextToken()
+	if tok.ttype != cILLEGAL || tok.terr == nil || tok.terr.Error() != "unterminated string at offset 2" {
+		t.Errorf("incorrect result for unterminated string, got: %v %v", tok, tok.terr)
+	}
+}
+
+func TestLexerNumbers(t *testing.T) {
+	tests := map[string]tokenType{
+		`100`:                  cINT,
+		`-1_000`:               cINT,
+		`0xFF`:                 cINT,
+		`1e-6`:                 cFLOAT,
+		`1.5E+3`:               cFLOAT,
+		`0x1.8p1`:              cFLOAT,
+		`99999999999999999999`: cINT,
+		`1.2.3`:                cILLEGAL,
+	}
+	for input, want := range tests {
+		tok := newLexer(input).nextToken()
+		if tok.ttype != want || (want != cILLEGAL && tok.tliteral != input) {
+			t.Errorf("incorrect result for %s, got: %s %s, want: %s", input, tok.ttype, tok.tliteral, want)
+		}
+	}
+
+	tokens := []tokenType{}
+	lex := newLexer(`EVAL(A => 1e-6)`)
+	for tok := lex.nextToken(); tok.ttype != cEOF; tok = lex.nextToken() {
+		tokens = append(tokens, tok.ttype)
+	}
+	if want := []tokenType{cEVAL, cLPAREN, cIDENT, cGOESTO, cFLOAT, cRPAREN}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("incorrect tokens, got: %v, want: %v", tokens, want)
+	}
+
+	if err := validate(`EVAL(A => 1__0)`); err == nil || err.Error() != "validation error: invalid number literal 1__0 at offset 10" {
+		t.Errorf("incorrect validation error, got: %v", err)
+	}
+}
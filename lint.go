@@ -0,0 +1,664 @@
+package diffq
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Rules reported by Lint. A diagnostic is suppressed by a comment of the form
+// /* diffq:ignore rule ... */ attached to the operation it is reported for or to
+// any enclosing operation. A suppression comment without rules suppresses every
+// rule.
+const (
+	// LintSyntax reports a statement that fails validation.
+	LintSyntax = "syntax"
+	// LintContradiction reports EVAL expressions within an AND that cannot all
+	// hold for the same path, e.g. EVAL(A => 1) and EVAL(A => 2).
+	LintContradiction = "contradiction"
+	// LintTautology reports EVAL expressions within an OR that together always
+	// hold, e.g. EVAL(A => *) and EVAL(A =!> *).
+	LintTautology = "tautology"
+	// LintDuplicate reports an operand of AND or OR identical to an earlier
+	// operand.
+	LintDuplicate = "duplicate"
+	// LintStringOrdering reports a comparison operator used with a string
+	// literal which compares lexicographically.
+	LintStringOrdering = "string-ordering"
+	// LintNonCollection reports $created, $deleted or $moved used with a path
+	// that cannot identify an element of a collection. Reported only when a type
+	// is provided with WithLintType.
+	LintNonCollection = "non-collection"
+	// LintUnknownPath reports a path that does not exist in the type provided
+	// with WithLintType.
+	LintUnknownPath = "unknown-path"
+	// LintUnreachable reports an operand that cannot affect the result of the
+	// AND or OR containing it because another operand is always false or always
+	// true respectively.
+	LintUnreachable = "unreachable"
+)
+
+// Severity indicates the importance of a Diagnostic.
+type Severity string
+
+const (
+	// SeverityError indicates a statement that cannot be evaluated.
+	SeverityError Severity = "error"
+	// SeverityWarning indicates a statement that can be evaluated but likely
+	// does not behave as intended.
+	SeverityWarning Severity = "warning"
+	// SeverityHint indicates a statement that may not behave as intended
+	// depending on the type of the values it is evaluated against.
+	SeverityHint Severity = "hint"
+)
+
+// Diagnostic describes a problem found in a statement by Lint.
+type Diagnostic struct {
+	// Rule identifies the check that produced the diagnostic.
+	Rule string
+	// Severity indicates the importance of the diagnostic.
+	Severity Severity
+	// Message describes the problem.
+	Message string
+	// Offset and End are the byte offsets of the start and end of the portion
+	// of the statement the diagnostic applies to.
+	Offset, End int
+}
+
+// LintOption configures the checks performed by Lint.
+type LintOption func(*lintConfig)
+
+// lintConfig holds the options used by Lint.
+type lintConfig struct {
+	shape *shape
+}
+
+// WithLintType checks the paths used by a statement against the type of v, the
+// type of the values the statement is evaluated against. v may be a value or a
+// reflect.Type. Fields of type interface{} are not checked.
+func WithLintType(v interface{}) LintOption {
+	return WithLintSchema(NewSchema(v))
+}
+
+// WithLintSchema checks the paths used by a statement against the Schema, s, of
+// the values the statement is evaluated against.
+func WithLintSchema(s *Schema) LintOption {
+	return func(c *lintConfig) {
+		c.shape = s.root
+	}
+}
+
+// Lint checks statement for mistakes that are valid syntax but unlikely to be
+// intended such as contradictory or duplicate conditions. A statement that fails
+// validation produces a single diagnostic with the rule LintSyntax. Diagnostics
+// are ordered by their offset in the statement.
+func Lint(statement string, opts ...LintOption) []Diagnostic {
+	c := &lintConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	nodes, closing, err := parseStatement(statement)
+	if err != nil {
+		return []Diagnostic{{
+			Rule:     LintSyntax,
+			Severity: SeverityError,
+			Message:  err.Error(),
+			Offset:   0,
+			End:      len(statement),
+		}}
+	}
+
+	l := &linter{shape: c.shape}
+	ignored := suppressions(nil, closing)
+	for _, n := range nodes {
+		l.node(n, ignored)
+	}
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		return l.diagnostics[i].Offset < l.diagnostics[j].Offset
+	})
+	return l.diagnostics
+}
+
+// lintValue is the statically known result of an operation.
+type lintValue int
+
+const (
+	lintUnknown lintValue = iota
+	lintTrue
+	lintFalse
+)
+
+// linter holds the state of a call to Lint.
+type linter struct {
+	shape       *shape
+	diagnostics []Diagnostic
+	// scopes holds the scopes of the enclosing EACH expressions with relative
+	// paths resolved.
+	scopes []string
+}
+
+// suppressionPrefix starts a comment suppressing diagnostics.
+const suppressionPrefix = "diffq:ignore"
+
+// suppressions returns the rules suppressed by parent together with those
+// suppressed by comments. The empty rule suppresses every rule.
+func suppressions(parent map[string]bool, comments ...[]*token) map[string]bool {
+	result := parent
+	for _, group := range comments {
+		for _, c := range group {
+			if c.ttype != cCOMMENT {
+				continue
+			}
+			text := strings.TrimSpace(c.tliteral)
+			if !strings.HasPrefix(text, suppressionPrefix) {
+				continue
+			}
+			rules := strings.FieldsFunc(text[len(suppressionPrefix):], func(r rune) bool {
+				return r == ',' || unicode.IsSpace(r)
+			})
+			if len(rules) == 0 {
+				rules = []string{""}
+			}
+			copied := make(map[string]bool, len(result)+len(rules))
+			for r := range result {
+				copied[r] = true
+			}
+			for _, r := range rules {
+				copied[r] = true
+			}
+			result = copied
+		}
+	}
+	return result
+}
+
+// nodeSuppressions returns the rules suppressed for the node n.
+func nodeSuppressions(parent map[string]bool, n *formatNode) map[string]bool {
+	return suppressions(parent, n.leading, n.trailing, n.closing, n.args)
+}
+
+// report records a diagnostic unless the rule is suppressed.
+func (l *linter) report(ignored map[string]bool, rule string, severity Severity, offset, end int, format string, args ...interface{}) {
+	if ignored[rule] || ignored[""] {
+		return
+	}
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		Rule:     rule,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+		Offset:   offset,
+		End:      end,
+	})
+}
+
+// node checks the node n and its children returning the statically known
+// result of n.
+func (l *linter) node(n *formatNode, parent map[string]bool) lintValue {
+	ignored := nodeSuppressions(parent, n)
+
+	switch n.tok.ttype {
+	case cTRUE:
+		return lintTrue
+	case cFALSE:
+		return lintFalse
+	case cEVAL:
+		l.eval(n, ignored)
+		return lintUnknown
+	case cEACH:
+		if len(n.args) == 1 {
+			l.scopes = append(l.scopes, l.absolutePath(n.args[0].tliteral))
+			defer func() { l.scopes = l.scopes[:len(l.scopes)-1] }()
+		}
+		for _, c := range n.children {
+			l.node(c, ignored)
+		}
+		return lintUnknown
+	case cAND, cOR:
+	default:
+		for _, c := range n.children {
+			l.node(c, ignored)
+		}
+		return lintUnknown
+	}
+
+	values := make([]lintValue, len(n.children))
+	for i, c := range n.children {
+		values[i] = l.node(c, ignored)
+	}
+	l.duplicates(n, ignored)
+
+	// an AND is decided by a false operand and an OR by a true operand
+	decisive, other := lintFalse, lintTrue
+	if n.tok.ttype == cOR {
+		decisive, other = lintTrue, lintFalse
+	}
+
+	result := other
+	decided := false
+	for _, v := range values {
+		if v == decisive {
+			decided = true
+		}
+		if v != other {
+			result = lintUnknown
+		}
+	}
+	if decided {
+		result = decisive
+		for i, c := range n.children {
+			if values[i] == decisive {
+				continue
+			}
+			l.report(nodeSuppressions(ignored, c), LintUnreachable, SeverityWarning, c.tok.tpos, c.end,
+				"operand cannot affect the result as %s is always %t", n.tok.ttype, decisive == lintTrue)
+		}
+	}
+
+	if n.tok.ttype == cAND && l.contradiction(n, ignored) {
+		return lintFalse
+	}
+	if n.tok.ttype == cOR && l.tautology(n, ignored) {
+		return lintTrue
+	}
+	return result
+}
+
+// duplicates reports operands of n identical to an earlier operand.
+func (l *linter) duplicates(n *formatNode, ignored map[string]bool) {
+	seen := make(map[string]bool)
+	for _, c := range n.children {
+		key := lintKey(c)
+		if seen[key] {
+			l.report(nodeSuppressions(ignored, c), LintDuplicate, SeverityWarning, c.tok.tpos, c.end,
+				"duplicate operand of %s: %s", n.tok.ttype, key)
+		}
+		seen[key] = true
+	}
+}
+
+// lintKey returns the canonical form of n without comments.
+func lintKey(n *formatNode) string {
+	if n.tok.ttype == cEVAL || n.tok.ttype == cREF {
+		var args []*token
+		for _, a := range n.args {
+			if a.ttype != cCOMMENT {
+				args = append(args, a)
+			}
+		}
+		return string(n.tok.ttype) + "(" + formatEvalArgs(args) + ")"
+	}
+	if !isOperation(n.tok.ttype) {
+		return formatToken(n.tok)
+	}
+	var children []string
+	if len(n.args) > 0 {
+		children = append(children, formatEvalArgs(n.args))
+	}
+	for _, c := range n.children {
+		children = append(children, lintKey(c))
+	}
+	return string(n.tok.ttype) + "(" + strings.Join(children, ", ") + ")"
+}
+
+// lintEval holds the components of an EVAL expression.
+type lintEval struct {
+	node                                *formatNode
+	identifier, previous, operator, lit *token
+}
+
+// parseLintEval returns the components of the EVAL n.
+func parseLintEval(n *formatNode) lintEval {
+	var toks []*token
+	for _, a := range n.args {
+		switch a.ttype {
+		case cCOMMENT, cLBRACKET, cRBRACKET:
+			continue
+		}
+		toks = append(toks, a)
+	}
+	e := lintEval{node: n}
+	switch len(toks) {
+	case 3:
+		e.identifier, e.operator, e.lit = toks[0], toks[1], toks[2]
+	case 4:
+		e.identifier, e.previous, e.operator, e.lit = toks[0], toks[1], toks[2], toks[3]
+	}
+	return e
+}
+
+// isOrdering returns true if the token type t is a comparison operator.
+func isOrdering(t tokenType) bool {
+	return t == cGOESGT || t == cGOESGTE || t == cGOESLT || t == cGOESLTE
+}
+
+// eval checks the EVAL n.
+func (l *linter) eval(n *formatNode, ignored map[string]bool) {
+	e := parseLintEval(n)
+	if e.identifier == nil {
+		return
+	}
+
+	if isOrdering(e.operator.ttype) && e.lit.ttype == cSTRING {
+		l.report(ignored, LintStringOrdering, SeverityWarning, n.tok.tpos, n.end,
+			"%s with the string literal %s compares lexicographically", e.operator.ttype, formatToken(e.lit))
+	}
+
+	if l.shape == nil {
+		return
+	}
+	identifier := e.identifier.tliteral
+	var a *aggregate
+	if e.identifier.ttype == cAGGREGATE {
+		var err error
+		if a, err = parseAggregate(identifier); err != nil {
+			return
+		}
+		identifier = a.path
+	}
+	if isRelativePath(identifier) {
+		if len(l.scopes) == 0 {
+			return
+		}
+		identifier = l.absolutePath(identifier)
+	}
+	path := strings.Split(identifier, ".")
+	start, end := e.identifier.tpos, e.identifier.tpos+len(e.identifier.tliteral)
+	r := l.shape.resolve(path)
+	if r.invalid >= 0 {
+		l.report(ignored, LintUnknownPath, SeverityWarning, start, end,
+			"unknown path %s: %s does not exist", identifier, strings.Join(path[:r.invalid+1], "."))
+		return
+	}
+	if !r.known {
+		return
+	}
+	if a != nil {
+		if r.shape != nil && r.shape.kind != shapeSlice && r.shape.kind != shapeMap && r.shape.kind != shapeAny {
+			l.report(ignored, LintNonCollection, SeverityWarning, start, end,
+				"%s never matches as %s does not identify a map or slice", a, identifier)
+		}
+		return
+	}
+	switch e.lit.ttype {
+	case cCREATED, cDELETED:
+		if !r.inElement && !r.shape.containsCollection(false) {
+			l.report(ignored, LintNonCollection, SeverityWarning, start, end,
+				"%s never matches %s as it does not identify an element of a map or slice", e.lit.tliteral, e.identifier.tliteral)
+		}
+	case cMOVED:
+		if !r.inSliceElement && !r.shape.containsCollection(true) {
+			l.report(ignored, LintNonCollection, SeverityWarning, start, end,
+				"%s never matches %s as it does not identify an element of a slice", e.lit.tliteral, e.identifier.tliteral)
+		}
+	}
+}
+
+// absolutePath resolves the path against the scope of the innermost enclosing
+// EACH expression if it is relative.
+func (l *linter) absolutePath(path string) string {
+	if isRelativePath(path) && len(l.scopes) > 0 {
+		return bindRelativePath(path, l.scopes[len(l.scopes)-1])
+	}
+	return path
+}
+
+// exactEvals groups the EVAL operands of n by identifier. When exact is true
+// identifiers containing wildcards, or identifying values that are not scalars
+// according to the configured type, are excluded as they may match several
+// changes.
+func (l *linter) exactEvals(n *formatNode, exact bool) ([]string, map[string][]lintEval) {
+	var order []string
+	groups := make(map[string][]lintEval)
+	for _, c := range n.children {
+		if c.tok.ttype != cEVAL {
+			continue
+		}
+		e := parseLintEval(c)
+		if e.identifier == nil {
+			continue
+		}
+		id := e.identifier.tliteral
+		if exact {
+			path := strings.Split(id, ".")
+			if wildcard(path) {
+				continue
+			}
+			if l.shape != nil {
+				if r := l.shape.resolve(path); r.known && r.shape != nil && r.shape.kind != shapeScalar {
+					continue
+				}
+			}
+		}
+		if _, ok := groups[id]; !ok {
+			order = append(order, id)
+		}
+		groups[id] = append(groups[id], e)
+	}
+	return order, groups
+}
+
+// wildcard returns true if any component of path is a wildcard.
+func wildcard(path []string) bool {
+	for _, p := range path {
+		if p == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// contradiction reports EVAL operands of the AND n that cannot hold together
+// returning true if any are found. As paths match the changes of the values
+// nested within them the operands only contradict when the path is known to
+// identify a scalar value; otherwise a hint is reported and false returned.
+func (l *linter) contradiction(n *formatNode, ignored map[string]bool) bool {
+	found := false
+	order, groups := l.exactEvals(n, true)
+	for _, id := range order {
+		evals := groups[id]
+		scalar := l.isScalar(id)
+		for j := 1; j < len(evals); j++ {
+			b := evals[j].node
+			suppressed := nodeSuppressions(ignored, b)
+			message := ""
+			for i := 0; i < j && message == ""; i++ {
+				if contradicts(evals[i], evals[j]) {
+					// a suppression on either operand applies
+					a := evals[i].node
+					suppressed = suppressions(suppressed, a.leading, a.trailing, a.args)
+					message = fmt.Sprintf("AND is never true: %s contradicts %s", lintKey(b), lintKey(a))
+				}
+			}
+			if message == "" && emptyRange(evals[:j+1]) {
+				message = fmt.Sprintf("AND is never true: no value of %s satisfies every comparison", id)
+			}
+			if message != "" {
+				if scalar {
+					l.report(suppressed, LintContradiction, SeverityWarning, b.tok.tpos, b.end, "%s", message)
+					found = true
+				} else {
+					l.report(suppressed, LintContradiction, SeverityHint, b.tok.tpos, b.end,
+						"%s unless %s identifies a struct, map or slice", message, id)
+				}
+				break
+			}
+		}
+	}
+	return found
+}
+
+// isScalar reports whether the path of an EVAL expression is known, from the
+// configured type, to identify a scalar value.
+func (l *linter) isScalar(path string) bool {
+	if l.shape == nil {
+		return false
+	}
+	if isRelativePath(path) {
+		if len(l.scopes) == 0 {
+			return false
+		}
+		path = l.absolutePath(path)
+	}
+	r := l.shape.resolve(strings.Split(path, "."))
+	return r.known && r.shape != nil && r.shape.kind == shapeScalar
+}
+
+// contradicts returns true if the EVAL expressions a and b, identifying the same
+// scalar value, cannot both hold.
+func contradicts(a, b lintEval) bool {
+	// the previous value must match for both
+	if a.previous != nil && b.previous != nil {
+		if cmp, ok := compareLiterals(a.previous, b.previous); ok && cmp != 0 {
+			return true
+		}
+	}
+
+	// =!> * requires that the value did not change
+	unchangedA := a.operator.ttype == cNOTGOESTO && a.lit.ttype == cASTERISK
+	unchangedB := b.operator.ttype == cNOTGOESTO && b.lit.ttype == cASTERISK
+	if unchangedA != unchangedB {
+		other := a
+		if unchangedA {
+			other = b
+		}
+		return other.operator.ttype != cNOTGOESTO
+	}
+
+	if a.operator.ttype == cGOESTO && b.operator.ttype == cGOESTO {
+		cmp, ok := compareLiterals(a.lit, b.lit)
+		return ok && cmp != 0
+	}
+	if (a.operator.ttype == cGOESTO && b.operator.ttype == cNOTGOESTO) ||
+		(a.operator.ttype == cNOTGOESTO && b.operator.ttype == cGOESTO) {
+		cmp, ok := compareLiterals(a.lit, b.lit)
+		return ok && cmp == 0
+	}
+	return false
+}
+
+// emptyRange returns true if the ordered literal constraints of evals on the
+// same scalar value cannot all hold, e.g. =GT> 5 and =LT> 3.
+func emptyRange(evals []lintEval) bool {
+	var lower, upper *token
+	var lowerStrict, upperStrict bool
+	for _, e := range evals {
+		op := e.operator.ttype
+		if op != cGOESTO && !isOrdering(op) {
+			continue
+		}
+		if op == cGOESTO || op == cGOESGT || op == cGOESGTE {
+			strict := op == cGOESGT
+			if lower == nil {
+				lower, lowerStrict = e.lit, strict
+			} else if cmp, ok := compareLiterals(e.lit, lower); !ok {
+				continue
+			} else if cmp > 0 || (cmp == 0 && strict) {
+				lower, lowerStrict = e.lit, strict
+			}
+		}
+		if op == cGOESTO || op == cGOESLT || op == cGOESLTE {
+			strict := op == cGOESLT
+			if upper == nil {
+				upper, upperStrict = e.lit, strict
+			} else if cmp, ok := compareLiterals(e.lit, upper); !ok {
+				continue
+			} else if cmp < 0 || (cmp == 0 && strict) {
+				upper, upperStrict = e.lit, strict
+			}
+		}
+	}
+	if lower == nil || upper == nil {
+		return false
+	}
+	cmp, ok := compareLiterals(lower, upper)
+	if !ok {
+		return false
+	}
+	return cmp > 0 || (cmp == 0 && (lowerStrict || upperStrict))
+}
+
+// tautology reports EVAL operands of the OR n that together always hold
+// returning true if any are found.
+func (l *linter) tautology(n *formatNode, ignored map[string]bool) bool {
+	found := false
+	order, groups := l.exactEvals(n, false)
+	for _, id := range order {
+		var changed, unchanged *formatNode
+		for _, e := range groups[id] {
+			if e.previous != nil || e.lit.ttype != cASTERISK {
+				continue
+			}
+			if e.operator.ttype == cGOESTO && changed == nil {
+				changed = e.node
+			} else if e.operator.ttype == cNOTGOESTO && unchanged == nil {
+				unchanged = e.node
+			}
+		}
+		if changed == nil || unchanged == nil {
+			continue
+		}
+		b := changed
+		if unchanged.tok.tpos > b.tok.tpos {
+			b = unchanged
+		}
+		l.report(nodeSuppressions(ignored, b), LintTautology, SeverityWarning, b.tok.tpos, b.end,
+			"OR is always true: %s and %s together match every change", lintKey(changed), lintKey(unchanged))
+		found = true
+	}
+	return found
+}
+
+// compareLiterals compares the literal tokens a and b returning -1, 0 or 1 and
+// true if the literals are of comparable types.
+func compareLiterals(a, b *token) (int, bool) {
+	ka, va, ok := literalKey(a)
+	if !ok {
+		return 0, false
+	}
+	kb, vb, ok := literalKey(b)
+	if !ok || ka != kb {
+		return 0, false
+	}
+	switch x := va.(type) {
+	case *big.Rat:
+		return x.Cmp(vb.(*big.Rat)), true
+	case int64:
+		y := vb.(int64)
+		if x < y {
+			return -1, true
+		} else if x > y {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		return strings.Compare(x, vb.(string)), true
+	}
+	return 0, false
+}
+
+// literalKey returns the kind and comparable value of the literal tok.
+func literalKey(tok *token) (string, interface{}, bool) {
+	switch tok.ttype {
+	case cINT, cFLOAT:
+		_, r, err := parseNumber(tok.tliteral)
+		return "number", r, err == nil
+	case cSTRING:
+		return "string:" + tok.tmods, normalizeString(tok.tliteral, tok.tmods), true
+	case cTRUE, cFALSE:
+		return "bool", string(tok.ttype), true
+	case cDURATION:
+		d, err := time.ParseDuration(tok.tliteral)
+		return "duration", int64(d), err == nil
+	case cTIME:
+		t, err := parseTime(tok.tliteral, time.UTC)
+		if err != nil {
+			return "", nil, false
+		}
+		return "time", t.UnixNano(), true
+	}
+	return "", nil, false
+}
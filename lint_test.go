@@ -0,0 +1,114 @@
+package diffq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := map[string][]string{
+		`AND(EVAL(S => "Done"), EVAL(I =GT> 1))`:                                       nil,
+		`AND(EVAL(I => 1), EVAL(I => 2))`:                                              {LintContradiction},
+		`AND(EVAL(I => 1), EVAL(I => 1.0))`:                                            nil,
+		`AND(EVAL(I => 1), EVAL(I => "2"))`:                                            nil,
+		`AND(EVAL(SS.* => "A"), EVAL(SS.* => "B"))`:                                    nil,
+		`AND(EVAL(I => 1), EVAL(I =!> 1))`:                                             {LintContradiction},
+		`AND(EVAL(I => *), EVAL(I =!> *))`:                                             {LintContradiction},
+		`AND(EVAL(I =GT> 5), EVAL(I =LT> 3))`:                                          {LintContradiction},
+		`AND(EVAL(I =GTE> 3), EVAL(I =LTE> 3))`:                                        nil,
+		`AND(EVAL(I =GT> 3), EVAL(I =LTE> 3))`:                                         {LintContradiction},
+		`AND(EVAL(D =GT> d"2h"), EVAL(D =LT> d"1h"))`:                                  {LintContradiction},
+		`AND(EVAL(S ["A"] => *), EVAL(S ["B"] => *))`:                                  {LintContradiction},
+		`OR(EVAL(I => *), EVAL(I =!> *))`:                                              {LintTautology},
+		`OR(EVAL(I => 1), EVAL(S => 2), EVAL(I => 1))`:                                 {LintDuplicate},
+		`AND(EVAL(I => 1), EVAL(I  =>  1 /* again */))`:                                {LintDuplicate},
+		`EVAL(S =GT> "b")`:                                                             {LintStringOrdering},
+		`OR(EVAL(S => "Done"), AND(EVAL(I => 1), EVAL(I => 2)))`:                       {LintContradiction},
+		`AND(EVAL(S => "Done"), AND(EVAL(I => 1), EVAL(I => 2)))`:                      {LintContradiction},
+		`AND(EVAL(NT => "a"), EVAL(NT => "b"))`:                                        {LintContradiction},
+		`OR(EVAL(S => "Done"), OR(EVAL(I => *), EVAL(I =!> *)))`:                       {LintUnreachable, LintTautology},
+		`AND(EVAL(S => "Done"), FALSE)`:                                                {LintUnreachable},
+		`AND(EVAL(I => 1), /* diffq:ignore contradiction */ EVAL(I => 2))`:             nil,
+		"AND(\n\tEVAL(I => 1),\n\t/* diffq:ignore contradiction */\n\tEVAL(I => 2)\n)": nil,
+		`/* diffq:ignore */ OR(EVAL(I => 1), EVAL(I => 1))`:                            nil,
+		`OR(EVAL(I => 1), EVAL(I => 1) /* diffq:ignore unreachable */)`:                {LintDuplicate},
+		`AND(EVAL(I => 1)`:                                                             {LintSyntax},
+		`AND(EVAL(S => i"done"), EVAL(S => i"DONE"))`:                                  nil,
+		`AND(EVAL(S => i"done"), EVAL(S => i"open"))`:                                  {LintContradiction},
+		`AND(EVAL(S => i"done"), EVAL(S => "open"))`:                                   nil,
+		`AND(EVAL(S => is"a"), EVAL(S =!> si" A "))`:                                   {LintContradiction},
+		`OR(REF(a), REF(b), REF(a))`:                                                   {LintDuplicate},
+		`EACH(NTS.*, AND(EVAL(.NS => "a"), EVAL(.NS => "b")))`:                         {LintContradiction},
+		`OR(EACH(NTS.*, EVAL(.NS => "a")), EACH(SS.*, EVAL(.NS => "a")))`:              nil,
+	}
+	for statement, want := range tests {
+		var got []string
+		for _, d := range Lint(statement) {
+			got = append(got, d.Rule)
+			if d.Offset < 0 || d.End > len(statement) || d.Offset > d.End {
+				t.Errorf("incorrect range for %s, got: %d-%d", statement, d.Offset, d.End)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect diagnostics for %s, got: %v, want: %v", statement, got, want)
+		}
+	}
+}
+
+func TestLintType(t *testing.T) {
+	tests := map[string][]string{
+		`EVAL(SS.* => $created)`:                                  nil,
+		`EVAL(SS => $created)`:                                    nil,
+		`EVAL(NT.NS => $created)`:                                 {LintNonCollection},
+		`EVAL(NTS.*.NSS => $deleted)`:                             nil,
+		`EVAL(M.one => $deleted)`:                                 nil,
+		`EVAL(M.one => $moved)`:                                   {LintNonCollection},
+		`EVAL(S => $created)`:                                     {LintNonCollection},
+		`EVAL(S => $updated)`:                                     nil,
+		`EVAL(NT.Missing => 1)`:                                   {LintUnknownPath},
+		`EVAL(S.Length => 1)`:                                     {LintUnknownPath},
+		`AND(EVAL(NT => 1), EVAL(NT => 2))`:                       nil,
+		`AND(EVAL(NT.NI => 1), EVAL(NT.NI => 2))`:                 {LintContradiction},
+		`AND(EVAL(NT => "a"), EVAL(NT => "b"))`:                   nil,
+		`AND(EVAL(S => "Done"), AND(EVAL(I => 1), EVAL(I => 2)))`: {LintUnreachable, LintContradiction},
+		`EVAL(LEN(SS) =GT> 3)`:                                    nil,
+		`EVAL(COUNT(NTS.*.NSS, $deleted) => 1)`:                   nil,
+		`EVAL(LEN(S) => 1)`:                                       {LintNonCollection},
+		`EVAL(COUNT(NT, *) => 1)`:                                 {LintNonCollection},
+		`EVAL(COUNT(NT.Missing, $deleted) => 1)`:                  {LintUnknownPath},
+		`AND(EVAL(LEN(SS) => 1), EVAL(LEN(SS) => 2))`:             {LintContradiction},
+		`EACH(NTS.*, EVAL(.NS => "a"))`:                           nil,
+		`EACH(NTS.*, EVAL(.Missing => 1))`:                        {LintUnknownPath},
+		`EACH(NTS.*, EACH(.NSS.*, EVAL(. => $created)))`:          nil,
+		`EACH(NT, EVAL(LEN(.NS) => 1))`:                           {LintNonCollection},
+	}
+	for statement, want := range tests {
+		var got []string
+		for _, d := range Lint(statement, WithLintType(&OuterType{})) {
+			got = append(got, d.Rule)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect diagnostics for %s, got: %v, want: %v", statement, got, want)
+		}
+	}
+
+	// paths match the changes nested within them so contradictions are hints
+	// unless the path is known to identify a scalar
+	severities := map[string]Severity{
+		`AND(EVAL(NT => "a"), EVAL(NT => "b"))`: SeverityHint,
+		`AND(EVAL(I => 1), EVAL(I => 2))`:       SeverityHint,
+	}
+	for statement, want := range severities {
+		if d := Lint(statement); len(d) != 1 || d[0].Severity != want {
+			t.Errorf("incorrect diagnostics for %s, got: %+v, want severity: %s", statement, d, want)
+		}
+	}
+	if d := Lint(`AND(EVAL(I => 1), EVAL(I => 2))`, WithLintType(&OuterType{})); len(d) != 1 || d[0].Severity != SeverityWarning {
+		t.Errorf("incorrect diagnostics for scalar contradiction, got: %+v", d)
+	}
+
+	d := Lint(`AND(EVAL(I => 1), EVAL(NT.Missing => 2))`, WithLintType(reflect.TypeOf(OuterType{})))
+	if len(d) != 1 || d[0].Offset != 23 || d[0].End != 33 {
+		t.Errorf("incorrect diagnostic range, got: %+v", d)
+	}
+}
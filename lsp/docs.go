@@ -0,0 +1,150 @@
+package lsp
+
+import "strings"
+
+// entry documents a keyword, operator or literal of the language.
+type entry struct {
+	label string
+	kind  int
+	// detail is a one line summary and doc the Markdown documentation.
+	detail string
+	doc    string
+}
+
+// entries documents the keywords, operators and literals of the language in the
+// order they are offered for completion.
+var entries = []entry{
+	{"AND", completionKeyword, "AND(statement, ...)",
+		"Holds when every operand holds. An empty `AND()` holds."},
+	{"OR", completionKeyword, "OR(statement, ...)",
+		"Holds when at least one operand holds. An empty `OR()` does not hold."},
+	{"EVAL", completionKeyword, "EVAL([previous] path operator value)",
+		"Compares the changes whose path matches the identifier to the value. " +
+			"A previous value in square brackets must match the value before the change.\n\n" +
+			"```\nEVAL(Status => \"Shipped\")\nEVAL([\"Pending\"] Status => \"Shipped\")\n```"},
+	{"ANY", completionKeyword, "ANY(EVAL(...))",
+		"Holds when at least one change matched by the EVAL satisfies it. Does not hold when no change matches."},
+	{"ALL", completionKeyword, "ALL(EVAL(...))",
+		"Holds when every change matched by the EVAL satisfies it. Holds when no change matches."},
+	{"NONE", completionKeyword, "NONE(EVAL(...))",
+		"Holds when no change matched by the EVAL satisfies it. Holds when no change matches."},
+	{"EACH", completionKeyword, "EACH(path, statement)",
+		"Holds when the statement holds for at least one element identified by the path. " +
+			"Paths starting with `.` in the statement are relative to the element.\n\n" +
+			"```\nEACH(Orders.*, AND(EVAL(.Status => \"Shipped\"), EVAL(.Carrier => *)))\n```"},
+	{"ANY_STEP", completionKeyword, "ANY_STEP(statement)",
+		"Holds when the statement holds for at least one step of a history."},
+	{"ALL_STEPS", completionKeyword, "ALL_STEPS(statement)",
+		"Holds when the statement holds for every step of a history."},
+	{"EVENTUALLY", completionKeyword, "EVENTUALLY(statement)",
+		"Holds when the statement holds for the change from the first snapshot of a history to any later snapshot."},
+	{"TRUE", completionValue, "boolean literal",
+		"The boolean `true`. As a statement it always holds."},
+	{"FALSE", completionValue, "boolean literal",
+		"The boolean `false`. As a statement it never holds."},
+	{"=>", completionOperator, "goes to",
+		"Holds when a matching change goes to the value."},
+	{"=!>", completionOperator, "does not go to",
+		"Holds when no change matches or a matching change does not go to the value. " +
+			"`=!> *` holds only when no change matches."},
+	{"=GT>", completionOperator, "goes greater than",
+		"Holds when a matching change goes to a value greater than the value."},
+	{"=GTE>", completionOperator, "goes greater than or equal",
+		"Holds when a matching change goes to a value greater than or equal to the value."},
+	{"=LT>", completionOperator, "goes less than",
+		"Holds when a matching change goes to a value less than the value."},
+	{"=LTE>", completionOperator, "goes less than or equal",
+		"Holds when a matching change goes to a value less than or equal to the value."},
+	{"=STARTSWITH>", completionOperator, "goes to a string starting with",
+		"Holds when a matching change goes to a string beginning with the string literal."},
+	{"=ENDSWITH>", completionOperator, "goes to a string ending with",
+		"Holds when a matching change goes to a string ending with the string literal."},
+	{"=CONTAINS>", completionOperator, "goes to a string or collection containing",
+		"Holds when a matching change goes to a string containing the string literal or, for a map or slice, " +
+			"when an element changed and the new collection holds the value. The elements of a map are its keys."},
+	{"*", completionValue, "any value",
+		"As a value, matches a change to any value. In a path, matches any field, key or index."},
+	{"nil", completionValue, "nil literal",
+		"Matches a change to nil."},
+	{"$created", completionValue, "action literal",
+		"Matches a change that creates the value, such as an element added to a slice or map."},
+	{"$deleted", completionValue, "action literal",
+		"Matches a change that deletes the value, such as an element removed from a slice or map."},
+	{"$updated", completionValue, "action literal",
+		"Matches a change that modifies the value in place."},
+	{"$moved", completionValue, "action literal",
+		"Matches an element of a slice whose position changed relative to the other elements."},
+	{"$conflict", completionValue, "action literal",
+		"Matches a conflicting change of a three-way diff."},
+	{"$first", completionField, "path modifier",
+		"Identifies the first element of a slice."},
+	{"$last", completionField, "path modifier",
+		"Identifies the last element of a slice."},
+	{"now", completionFunction, "now()",
+		"The current time of the clock of the evaluation. An offset may follow, such as `now() - d\"24h\"`."},
+	{"startOfDay", completionFunction, "startOfDay()",
+		"Midnight of the current day in the location of the clock. An offset may follow, such as `startOfDay() + d\"9h\"`."},
+	{"year", completionFunction, "year(time)", granularityDoc("year")},
+	{"month", completionFunction, "month(time)", granularityDoc("month")},
+	{"day", completionFunction, "day(time)", granularityDoc("day")},
+	{"hour", completionFunction, "hour(time)", granularityDoc("hour")},
+	{"minute", completionFunction, "minute(time)", granularityDoc("minute")},
+	{"second", completionFunction, "second(time)", granularityDoc("second")},
+	{"LEN", completionFunction, "LEN(path)",
+		"The length of the map or slice at path, compared when the length changed, such as `EVAL(LEN(Items) =GT> 10)`."},
+	{"COUNT", completionFunction, "COUNT(path, action)",
+		"The number of elements of the map or slice at path with a change of the action, or any change for `*`, " +
+			"such as `EVAL(COUNT(Items, $deleted) =GT> 3)`."},
+	{"REF", completionKeyword, "REF(name)",
+		"Holds when the rule or fragment named name holds. References are resolved when the rules are loaded."},
+	{"RULE", completionKeyword, "RULE name = statement",
+		"Declares a named rule in a rule file. Comments on the preceding lines document the rule."},
+	{"DEFINE", completionKeyword, "DEFINE name = statement",
+		"Declares a fragment in a rule file that other rules reference with `REF(name)` but that is not evaluated itself."},
+}
+
+// Documentation of literals that are not keywords.
+const (
+	stringDoc   = "**string literal**\n\nA double quoted string, such as `\"Shipped\"`, holding escape sequences such as `\\\"` and `\\n`, or a raw string between backticks. The modifiers `i` (ignore case), `s` (ignore surrounding whitespace) and `n` (Unicode normalization) may prefix a string, such as `is\"done\"`."
+	durationDoc = "**duration literal**\n\nA duration written as `d\"24h\"` in the format accepted by `time.ParseDuration`."
+	timeDoc     = "**time literal**\n\nA time written as `t\"2020-01-01T12:00:00Z\"` in RFC 3339 format, a date such as `t\"2020-01-01\"` or a Unix time such as `t\"@1700000000\"`. Times without an offset are in the location of the clock."
+	numberDoc   = "**number literal**\n\nAn integer such as `100`, `1_000_000` or `0xFF` or a float such as `-3.1415` or `1e6`. Integers are not limited in size."
+)
+
+// granularityDoc returns the documentation of the time granularity function of
+// unit.
+func granularityDoc(unit string) string {
+	return "Compares the value and the time truncated to the " + unit + " in the location of the time, " +
+		"so `EVAL(DueAt => " + unit + "(now()))` holds when DueAt goes to a time within the current " + unit + "."
+}
+
+// Keywords returns the keywords, operators and literals of the language in the
+// order they are offered for completion. Keywords and functions taking
+// arguments are followed by an opening parenthesis, e.g. "AND(".
+func Keywords() []string {
+	words := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if strings.HasPrefix(e.detail, e.label+"(") {
+			words = append(words, e.label+"(")
+		} else {
+			words = append(words, e.label)
+		}
+	}
+	return words
+}
+
+// lookupEntry returns the documentation of the keyword, operator or literal
+// word. Keywords are matched regardless of case.
+func lookupEntry(word string) (entry, bool) {
+	for _, e := range entries {
+		if strings.EqualFold(e.label, word) {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// markdown returns the hover documentation of the entry e.
+func (e entry) markdown() string {
+	return "**" + e.label + "** — " + e.detail + "\n\n" + e.doc
+}
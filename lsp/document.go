@@ -0,0 +1,143 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/cbergoon/diffq"
+)
+
+// document is a rule file open in the client.
+type document struct {
+	uri  string
+	text string
+	// decls holds the declarations of the document and err the error
+	// encountered parsing them.
+	decls []diffq.RuleDeclaration
+	err   error
+}
+
+// newDocument returns a document holding text.
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri}
+	d.setText(text)
+	return d
+}
+
+// setText replaces the text of the document d.
+func (d *document) setText(text string) {
+	d.text = text
+	d.decls, d.err = diffq.ParseRuleFile(text)
+}
+
+// offset returns the byte offset of the position p in the document d.
+func (d *document) offset(p Position) int {
+	return positionOffset(d.text, p)
+}
+
+// position returns the position of the byte offset in the document d.
+func (d *document) position(offset int) Position {
+	return offsetPosition(d.text, offset)
+}
+
+// span returns the range between the byte offsets start and end.
+func (d *document) span(start, end int) Range {
+	return Range{Start: d.position(start), End: d.position(end)}
+}
+
+// rule returns the declaration of the rule named name.
+func (d *document) rule(name string) (diffq.RuleDeclaration, bool) {
+	for _, decl := range d.decls {
+		if decl.Name != "" && decl.Name == name {
+			return decl, true
+		}
+	}
+	return diffq.RuleDeclaration{}, false
+}
+
+// statementAt returns the declaration whose statement contains the byte
+// offset.
+func (d *document) statementAt(offset int) (diffq.RuleDeclaration, bool) {
+	for _, decl := range d.decls {
+		if decl.Offset <= offset && offset <= decl.End {
+			return decl, true
+		}
+	}
+	return diffq.RuleDeclaration{}, false
+}
+
+// positionOffset converts the position p, measured in UTF-16 code units, to a
+// byte offset in text. Positions beyond the end of a line or the text are
+// clamped.
+func positionOffset(text string, p Position) int {
+	offset := 0
+	for line := 0; line < p.Line; line++ {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i < 0 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+	units := 0
+	for offset < len(text) && text[offset] != '\n' && units < p.Character {
+		r, size := utf8.DecodeRuneInString(text[offset:])
+		units += len(utf16.Encode([]rune{r}))
+		offset += size
+	}
+	return offset
+}
+
+// offsetPosition converts the byte offset in text to a position measured in
+// UTF-16 code units.
+func offsetPosition(text string, offset int) Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	p := Position{Line: strings.Count(text[:start], "\n")}
+	for _, r := range text[start:offset] {
+		p.Character += len(utf16.Encode([]rune{r}))
+	}
+	return p
+}
+
+// isWordChar reports whether c may be part of an identifier, keyword or
+// operator.
+func isWordChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte("_.$*-=!<>", c) >= 0
+}
+
+// wordAt returns the word surrounding the byte offset in text along with its
+// start and end offsets.
+func wordAt(text string, offset int) (string, int, int) {
+	start, end := offset, offset
+	for start > 0 && isWordChar(text[start-1]) {
+		start--
+	}
+	for end < len(text) && isWordChar(text[end]) {
+		end++
+	}
+	return text[start:end], start, end
+}
+
+// uriPath returns the file system path of a file URI.
+func uriPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(u.Path), true
+}
+
+// pathURI returns the file URI of the file system path.
+func pathURI(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+}
@@ -0,0 +1,678 @@
+// Package lsp implements a Language Server Protocol server for diffq rule
+// files. The server publishes the diagnostics produced by diffq.Lint, documents
+// operators and literals on hover, completes keywords, operators and the paths
+// of a configured diffq.Schema, resolves named rules and formats documents with
+// diffq.FormatRuleFile.
+//
+// Messages are exchanged as JSON-RPC 2.0 framed with Content-Length headers as
+// described by the Language Server Protocol specification. Documents are
+// synchronized in full.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cbergoon/diffq"
+	"github.com/pkg/errors"
+)
+
+// codeRequestFailed is the error code of a request that is valid but could not
+// be completed.
+const codeRequestFailed = -32803
+
+// ruleFileExt is the extension of the rule files searched for definitions in
+// the workspace.
+const ruleFileExt = ".dq"
+
+// Options configures a Server.
+type Options struct {
+	// Schema describes the values rules are evaluated against. When set, paths
+	// are completed, described and checked against it. Otherwise a JSON Schema
+	// may be configured by the client with the schema initialization option.
+	Schema *diffq.Schema
+}
+
+// Server is a Language Server Protocol server for diffq rule files. A Server
+// serves a single client.
+type Server struct {
+	schema *diffq.Schema
+	// root is the workspace directory searched for rule definitions.
+	root string
+	// docs holds the open documents by URI.
+	docs     map[string]*document
+	w        io.Writer
+	shutdown bool
+}
+
+// NewServer returns a Server configured with opts.
+func NewServer(opts Options) *Server {
+	return &Server{
+		schema: opts.Schema,
+		docs:   make(map[string]*document),
+	}
+}
+
+// Serve reads messages from r and writes responses and notifications to w
+// until the client sends the exit notification. An error is returned when the
+// client exits without a shutdown request or the connection fails.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	br := bufio.NewReader(r)
+	for {
+		m, err := readMessage(br)
+		if err == io.EOF {
+			if s.shutdown {
+				return nil
+			}
+			return errors.New("lsp error: connection closed before exit")
+		}
+		if rerr, ok := err.(*responseError); ok {
+			if err := s.write(errorResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: rerr}); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if m.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("lsp error: exit without shutdown")
+			}
+			return nil
+		}
+		if m.ID == nil {
+			if err := s.notification(m.Method, m.Params); err != nil {
+				return err
+			}
+			continue
+		}
+
+		result, rerr := s.request(m.Method, m.Params)
+		if rerr != nil {
+			err = s.write(errorResponse{JSONRPC: "2.0", ID: *m.ID, Error: rerr})
+		} else {
+			err = s.write(response{JSONRPC: "2.0", ID: *m.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write writes the message v to the client.
+func (s *Server) write(v interface{}) error {
+	return writeMessage(s.w, v)
+}
+
+// request handles the request method and returns its result.
+func (s *Server) request(method string, params json.RawMessage) (interface{}, *responseError) {
+	if s.shutdown {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+	switch method {
+	case "initialize":
+		return s.initialize(params)
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/hover":
+		return s.hover(params)
+	case "textDocument/completion":
+		return s.completion(params)
+	case "textDocument/definition":
+		return s.definition(params)
+	case "textDocument/formatting":
+		return s.formatting(params)
+	case "textDocument/documentSymbol":
+		return s.documentSymbol(params)
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: fmt.Sprintf("method %s not found", method)}
+}
+
+// notification handles the notification method. Unknown notifications and
+// notifications with invalid parameters are ignored.
+func (s *Server) notification(method string, params json.RawMessage) error {
+	switch method {
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if decode(params, &p) != nil {
+			return nil
+		}
+		doc := newDocument(p.TextDocument.URI, p.TextDocument.Text)
+		s.docs[doc.uri] = doc
+		return s.publishDiagnostics(doc)
+	case "textDocument/didChange":
+		var p didChangeParams
+		if decode(params, &p) != nil {
+			return nil
+		}
+		doc, ok := s.docs[p.TextDocument.URI]
+		if !ok {
+			return nil
+		}
+		text := doc.text
+		for _, c := range p.ContentChanges {
+			if c.Range == nil {
+				text = c.Text
+				continue
+			}
+			start, end := positionOffset(text, c.Range.Start), positionOffset(text, c.Range.End)
+			text = text[:start] + c.Text + text[end:]
+		}
+		doc.setText(text)
+		return s.publishDiagnostics(doc)
+	case "textDocument/didClose":
+		var p documentParams
+		if decode(params, &p) != nil {
+			return nil
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return s.write(notification{
+			JSONRPC: "2.0",
+			Method:  "textDocument/publishDiagnostics",
+			Params:  publishDiagnosticsParams{URI: p.TextDocument.URI, Diagnostics: []Diagnostic{}},
+		})
+	}
+	return nil
+}
+
+// decode decodes the parameters of a message into v.
+func decode(params json.RawMessage, v interface{}) *responseError {
+	if len(params) == 0 {
+		return &responseError{Code: codeInvalidParams, Message: "missing parameters"}
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+// document returns the open document identified by uri.
+func (s *Server) document(uri string) (*document, *responseError) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("document %s is not open", uri)}
+	}
+	return doc, nil
+}
+
+// initialize handles the initialize request. The schema initialization option
+// names a JSON Schema file, relative to the workspace, used when the Server is
+// not configured with a Schema.
+func (s *Server) initialize(params json.RawMessage) (interface{}, *responseError) {
+	var p initializeParams
+	if len(params) > 0 {
+		if rerr := decode(params, &p); rerr != nil {
+			return nil, rerr
+		}
+	}
+	if root, ok := uriPath(p.RootURI); ok {
+		s.root = root
+	}
+	if name := p.InitializationOptions.Schema; name != "" && s.schema == nil {
+		if !filepath.IsAbs(name) && s.root != "" {
+			name = filepath.Join(s.root, name)
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		schema, err := diffq.ParseJSONSchema(data)
+		if err != nil {
+			return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+		}
+		s.schema = schema
+	}
+
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": 1,
+			"hoverProvider":    true,
+			"completionProvider": map[string]interface{}{
+				"triggerCharacters": []string{".", "$", "=", "("},
+			},
+			"definitionProvider":         true,
+			"documentFormattingProvider": true,
+			"documentSymbolProvider":     true,
+		},
+		"serverInfo": map[string]string{"name": "diffq"},
+	}, nil
+}
+
+// publishDiagnostics sends the diagnostics of doc to the client.
+func (s *Server) publishDiagnostics(doc *document) error {
+	return s.write(notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: doc.uri, Diagnostics: s.diagnostics(doc)},
+	})
+}
+
+// diagnostics returns the problems of the rule file doc. An error in the
+// structure of the file is reported alone; otherwise each statement is linted.
+func (s *Server) diagnostics(doc *document) []Diagnostic {
+	diags := []Diagnostic{}
+	if doc.err != nil {
+		offset, message := 0, doc.err.Error()
+		if rerr, ok := doc.err.(*diffq.RuleFileError); ok {
+			offset, message = rerr.Offset, rerr.Message
+		}
+		end := strings.IndexByte(doc.text[offset:], '\n')
+		if end < 0 {
+			end = len(doc.text) - offset
+		}
+		return append(diags, Diagnostic{
+			Range:    doc.span(offset, offset+end),
+			Severity: severityError,
+			Code:     diffq.LintSyntax,
+			Source:   "diffq",
+			Message:  message,
+		})
+	}
+
+	var opts []diffq.LintOption
+	if s.schema != nil {
+		opts = append(opts, diffq.WithLintSchema(s.schema))
+	}
+	var fragments map[string]string
+	for _, decl := range doc.decls {
+		if decl.Statement == "" {
+			continue
+		}
+		if len(diffq.References(decl.Statement)) > 0 {
+			if fragments == nil {
+				fragments = s.fragments(doc)
+			}
+			_, err := diffq.ResolveReferences(decl.Statement, fragments)
+			if rerr, ok := err.(*diffq.ReferenceError); ok {
+				_, start, end := wordAt(doc.text, decl.Offset+rerr.Offset)
+				diags = append(diags, Diagnostic{
+					Range:    doc.span(start, end),
+					Severity: severityError,
+					Code:     "reference",
+					Source:   "diffq",
+					Message:  strings.TrimPrefix(rerr.Error(), "validation error: "),
+				})
+			}
+		}
+		for _, d := range diffq.Lint(decl.Statement, opts...) {
+			severity := severityWarning
+			switch d.Severity {
+			case diffq.SeverityError:
+				severity = severityError
+			case diffq.SeverityHint:
+				severity = severityHint
+			}
+			message := d.Message
+			if decl.Name != "" {
+				message = fmt.Sprintf("rule %s: %s", decl.Name, message)
+			}
+			diags = append(diags, Diagnostic{
+				Range:    doc.span(decl.Offset+d.Offset, decl.Offset+d.End),
+				Severity: severity,
+				Code:     d.Rule,
+				Source:   "diffq",
+				Message:  message,
+			})
+		}
+	}
+	return diags
+}
+
+// fragments returns the statements of the rules declared in doc, the other
+// open documents and the rule files of the workspace by name.
+func (s *Server) fragments(doc *document) map[string]string {
+	fragments := make(map[string]string)
+	s.documents(doc, func(d *document) bool {
+		for _, decl := range d.decls {
+			if _, ok := fragments[decl.Name]; !ok && decl.Name != "" {
+				fragments[decl.Name] = decl.Statement
+			}
+		}
+		return true
+	})
+	return fragments
+}
+
+// hover handles the textDocument/hover request. Keywords, operators and
+// literals are documented along with named rules and, given a Schema, paths.
+func (s *Server) hover(params json.RawMessage) (interface{}, *responseError) {
+	var p textDocumentPositionParams
+	if rerr := decode(params, &p); rerr != nil {
+		return nil, rerr
+	}
+	doc, rerr := s.document(p.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	offset := doc.offset(p.Position)
+
+	markdown := func(value string, start, end int) *Hover {
+		r := doc.span(start, end)
+		return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}
+	}
+
+	if start, end, prefix, ok := literalAt(doc.text, offset); ok {
+		switch prefix {
+		case 'd':
+			return markdown(durationDoc, start, end), nil
+		case 't':
+			return markdown(timeDoc, start, end), nil
+		}
+		return markdown(stringDoc, start, end), nil
+	}
+
+	word, start, end := wordAt(doc.text, offset)
+	if word == "" {
+		return nil, nil
+	}
+	if decl, _, ok := s.rule(doc, word); ok {
+		keyword := "RULE"
+		if decl.Define {
+			keyword = "DEFINE"
+		}
+		value := "**" + keyword + " " + decl.Name + "**"
+		if decl.Doc != "" {
+			value += "\n\n" + decl.Doc
+		}
+		value += "\n\n```\n" + decl.Statement + "\n```"
+		return markdown(value, start, end), nil
+	}
+	if e, ok := lookupEntry(word); ok {
+		return markdown(e.markdown(), start, end), nil
+	}
+	if isNumber(word) {
+		return markdown(numberDoc, start, end), nil
+	}
+	if s.schema != nil {
+		if description, ok := s.schema.Describe(word); ok {
+			return markdown("**"+word+"** — "+description, start, end), nil
+		}
+	}
+	return nil, nil
+}
+
+// isNumber reports whether word is a number literal.
+func isNumber(word string) bool {
+	if _, ok := new(big.Int).SetString(word, 0); ok {
+		return true
+	}
+	_, err := strconv.ParseFloat(word, 64)
+	return err == nil
+}
+
+// literalAt returns the offsets of the quoted literal containing offset in text
+// along with the character preceding its opening quote.
+func literalAt(text string, offset int) (int, int, byte, bool) {
+	start := strings.LastIndexByte(text[:offset], '\n') + 1
+	end := strings.IndexByte(text[offset:], '\n')
+	if end < 0 {
+		end = len(text)
+	} else {
+		end += offset
+	}
+	// a quote directly following the cursor starts a prefixed literal
+	if offset < len(text) && offset+1 < len(text) && (text[offset] == 'd' || text[offset] == 't') && text[offset+1] == '"' &&
+		(offset == 0 || !isWordChar(text[offset-1])) {
+		offset++
+	}
+	open := -1
+	for i := start; i < end; i++ {
+		if text[i] == '\\' && open >= 0 {
+			// skip the escaped character
+			i++
+			continue
+		}
+		if text[i] != '"' {
+			continue
+		}
+		if open < 0 {
+			open = i
+			continue
+		}
+		if open <= offset && offset <= i {
+			var prefix byte
+			if open > 0 {
+				prefix = text[open-1]
+			}
+			if prefix == 'd' || prefix == 't' {
+				return open - 1, i + 1, prefix, true
+			}
+			return open, i + 1, 0, true
+		}
+		open = -1
+	}
+	return 0, 0, 0, false
+}
+
+// completion handles the textDocument/completion request. Operators are offered
+// after an equals sign and the components of a path, given a Schema, after a
+// period; otherwise keywords, literals and the root components are offered.
+func (s *Server) completion(params json.RawMessage) (interface{}, *responseError) {
+	var p textDocumentPositionParams
+	if rerr := decode(params, &p); rerr != nil {
+		return nil, rerr
+	}
+	doc, rerr := s.document(p.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	offset := doc.offset(p.Position)
+	start := offset
+	for start > 0 && isWordChar(doc.text[start-1]) {
+		start--
+	}
+	prefix := doc.text[start:offset]
+
+	items := []CompletionItem{}
+	add := func(label string, kind int, detail string, documentation *MarkupContent, from int) {
+		items = append(items, CompletionItem{
+			Label:         label,
+			Kind:          kind,
+			Detail:        detail,
+			Documentation: documentation,
+			TextEdit:      &TextEdit{Range: doc.span(from, offset), NewText: label},
+		})
+	}
+
+	if before := strings.TrimRight(doc.text[:start], " \t"); strings.HasSuffix(strings.ToUpper(before), "REF(") {
+		seen := make(map[string]bool)
+		s.documents(doc, func(d *document) bool {
+			for _, decl := range d.decls {
+				if decl.Name == "" || seen[decl.Name] || !strings.HasPrefix(decl.Name, prefix) {
+					continue
+				}
+				seen[decl.Name] = true
+				add(decl.Name, completionFunction, decl.Doc, nil, start)
+			}
+			return true
+		})
+		return items, nil
+	}
+	if dot := strings.LastIndexByte(prefix, '.'); dot >= 0 && !strings.HasPrefix(prefix, "=") {
+		if s.schema == nil {
+			return items, nil
+		}
+		parent, partial := prefix[:dot], prefix[dot+1:]
+		for _, child := range s.schema.Children(parent) {
+			if !strings.HasPrefix(child, partial) {
+				continue
+			}
+			detail, _ := s.schema.Describe(parent + "." + child)
+			add(child, completionField, detail, nil, start+dot+1)
+		}
+		return items, nil
+	}
+
+	for _, e := range entries {
+		if strings.HasPrefix(prefix, "=") && e.kind != completionOperator {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToUpper(e.label), strings.ToUpper(prefix)) {
+			continue
+		}
+		add(e.label, e.kind, e.detail, &MarkupContent{Kind: "markdown", Value: e.doc}, start)
+	}
+	if s.schema != nil && !strings.HasPrefix(prefix, "=") {
+		for _, child := range s.schema.Children("") {
+			if !strings.HasPrefix(child, prefix) {
+				continue
+			}
+			detail, _ := s.schema.Describe(child)
+			add(child, completionField, detail, nil, start)
+		}
+	}
+	return items, nil
+}
+
+// definition handles the textDocument/definition request by locating the
+// declaration of the rule named by the word at the position.
+func (s *Server) definition(params json.RawMessage) (interface{}, *responseError) {
+	var p textDocumentPositionParams
+	if rerr := decode(params, &p); rerr != nil {
+		return nil, rerr
+	}
+	doc, rerr := s.document(p.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	word, _, _ := wordAt(doc.text, doc.offset(p.Position))
+	decl, in, ok := s.rule(doc, word)
+	if !ok {
+		return nil, nil
+	}
+	return []Location{{
+		URI:   in.uri,
+		Range: in.span(decl.NameOffset, decl.NameOffset+len(decl.Name)),
+	}}, nil
+}
+
+// rule returns the declaration of the rule named name along with the document
+// declaring it. The document doc is searched first, then the other open
+// documents and finally the rule files of the workspace.
+func (s *Server) rule(doc *document, name string) (diffq.RuleDeclaration, *document, bool) {
+	var found *document
+	var decl diffq.RuleDeclaration
+	if name == "" {
+		return decl, nil, false
+	}
+	s.documents(doc, func(d *document) bool {
+		if r, ok := d.rule(name); ok {
+			found, decl = d, r
+		}
+		return found == nil
+	})
+	return decl, found, found != nil
+}
+
+// documents calls fn with doc, the other open documents and the rule files of
+// the workspace that are not open, in that order, until fn returns false.
+func (s *Server) documents(doc *document, fn func(*document) bool) {
+	if !fn(doc) {
+		return
+	}
+	var uris []string
+	for uri := range s.docs {
+		if uri != doc.uri {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Strings(uris)
+	for _, uri := range uris {
+		if !fn(s.docs[uri]) {
+			return
+		}
+	}
+	if s.root == "" {
+		return
+	}
+
+	done := false
+	filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || done {
+			return nil
+		}
+		if info.IsDir() {
+			if path != s.root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) != ruleFileExt {
+			return nil
+		}
+		uri := pathURI(path)
+		if _, open := s.docs[uri]; open {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		done = !fn(newDocument(uri, string(data)))
+		return nil
+	})
+}
+
+// formatting handles the textDocument/formatting request by replacing the
+// document with its canonical form.
+func (s *Server) formatting(params json.RawMessage) (interface{}, *responseError) {
+	var p documentParams
+	if rerr := decode(params, &p); rerr != nil {
+		return nil, rerr
+	}
+	doc, rerr := s.document(p.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	if strings.TrimSpace(doc.text) == "" {
+		return []TextEdit{}, nil
+	}
+	formatted, err := diffq.FormatRuleFile(doc.text)
+	if err != nil {
+		return nil, &responseError{Code: codeRequestFailed, Message: err.Error()}
+	}
+	if formatted == doc.text {
+		return []TextEdit{}, nil
+	}
+	return []TextEdit{{Range: doc.span(0, len(doc.text)), NewText: formatted}}, nil
+}
+
+// documentSymbol handles the textDocument/documentSymbol request by listing the
+// named rules of the document.
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, *responseError) {
+	var p documentParams
+	if rerr := decode(params, &p); rerr != nil {
+		return nil, rerr
+	}
+	doc, rerr := s.document(p.TextDocument.URI)
+	if rerr != nil {
+		return nil, rerr
+	}
+	symbols := []DocumentSymbol{}
+	for _, decl := range doc.decls {
+		if decl.Name == "" {
+			continue
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           decl.Name,
+			Detail:         decl.Doc,
+			Kind:           symbolFunction,
+			Range:          doc.span(decl.Start, decl.End),
+			SelectionRange: doc.span(decl.NameOffset, decl.NameOffset+len(decl.Name)),
+		})
+	}
+	return symbols, nil
+}
@@ -0,0 +1,419 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cbergoon/diffq"
+)
+
+type order struct {
+	Status  string
+	Carrier string
+	Items   []item
+}
+
+type item struct {
+	SKU      string
+	Quantity int
+}
+
+// client scripts the messages of an LSP client and collects the replies of a
+// Server.
+type client struct {
+	t   *testing.T
+	in  bytes.Buffer
+	ids int
+}
+
+// request queues the request method and returns its ID.
+func (c *client) request(method string, params interface{}) int {
+	c.ids++
+	c.write(map[string]interface{}{"jsonrpc": "2.0", "id": c.ids, "method": method, "params": params})
+	return c.ids
+}
+
+// notify queues the notification method.
+func (c *client) notify(method string, params interface{}) {
+	c.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (c *client) write(v interface{}) {
+	if err := writeMessage(&c.in, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// run serves the queued messages, followed by shutdown and exit, and returns
+// the responses by ID and the notifications in order.
+func (c *client) run(s *Server) (map[int]*message, []*message) {
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+
+	var out bytes.Buffer
+	if err := s.Serve(&c.in, &out); err != nil {
+		c.t.Fatalf("unexpected error serving: %v", err)
+	}
+	responses := make(map[int]*message)
+	var notifications []*message
+	r := bufio.NewReader(&out)
+	for {
+		m, err := readMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if m.ID == nil {
+			notifications = append(notifications, m)
+			continue
+		}
+		var id int
+		if err := json.Unmarshal(*m.ID, &id); err != nil {
+			c.t.Fatal(err)
+		}
+		responses[id] = m
+	}
+	return responses, notifications
+}
+
+// position returns the position of the first occurrence of sub in text offset
+// by delta bytes.
+func position(text, sub string, delta int) Position {
+	return offsetPosition(text, strings.Index(text, sub)+delta)
+}
+
+func at(uri string, p Position) map[string]interface{} {
+	return map[string]interface{}{"textDocument": map[string]string{"uri": uri}, "position": p}
+}
+
+func result(t *testing.T, m *message, v interface{}) {
+	t.Helper()
+	if m == nil {
+		t.Fatal("missing response")
+	}
+	if m.Error != nil {
+		t.Fatalf("unexpected error: %v", m.Error)
+	}
+	if err := json.Unmarshal(m.Result, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const rulesURI = "file:///rules.dq"
+
+const rules = `/* Orders that shipped without a carrier. */
+RULE shipped_without_carrier = AND(
+    EVAL(Status => "Shipped"),
+    EVAL(Carrier =!> *)
+)
+
+RULE contradiction = AND(EVAL(Status => "A"), EVAL(Status => "B"))
+
+RULE unknown = EVAL(Stauts => d"1h") /* see shipped_without_carrier */
+`
+
+func TestServerDiagnostics(t *testing.T) {
+	c := &client{t: t}
+	c.request("initialize", map[string]interface{}{})
+	c.notify("initialized", map[string]interface{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": rulesURI, "languageId": "diffq", "version": 1, "text": rules},
+	})
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": rulesURI, "version": 2},
+		"contentChanges": []map[string]string{{"text": "RULE broken = AND(EVAL(Status => 1)"}},
+	})
+	c.notify("textDocument/didClose", map[string]interface{}{"textDocument": map[string]string{"uri": rulesURI}})
+	_, notifications := c.run(NewServer(Options{Schema: diffq.NewSchema(order{})}))
+
+	if len(notifications) != 3 {
+		t.Fatalf("incorrect number of notifications, got: %d, want: %d", len(notifications), 3)
+	}
+	want := []map[string]Position{
+		{
+			diffq.LintContradiction: position(rules, `EVAL(Status => "B")`, 0),
+			diffq.LintUnknownPath:   position(rules, "Stauts", 0),
+		},
+		{
+			diffq.LintSyntax: {Line: 0, Character: 14},
+		},
+		{},
+	}
+	for i, n := range notifications {
+		var p publishDiagnosticsParams
+		if err := json.Unmarshal(n.Params, &p); err != nil {
+			t.Fatal(err)
+		}
+		if n.Method != "textDocument/publishDiagnostics" || p.URI != rulesURI {
+			t.Errorf("incorrect notification %d, got: %s %s", i, n.Method, p.URI)
+		}
+		got := make(map[string]Position)
+		for _, d := range p.Diagnostics {
+			got[d.Code] = d.Range.Start
+		}
+		if len(got) != len(want[i]) {
+			t.Errorf("incorrect diagnostics for notification %d, got: %v, want: %v", i, got, want[i])
+		}
+		for code, pos := range want[i] {
+			if got[code] != pos {
+				t.Errorf("incorrect %s diagnostic for notification %d, got: %v, want: %v", code, i, got[code], pos)
+			}
+		}
+	}
+}
+
+func TestServerReferenceDiagnostics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diffq-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "defs.dq"), []byte("DEFINE shared = EVAL(Status => *)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "DEFINE a = REF(b)\nDEFINE b = REF(a)\nRULE r = AND(REF(shared), REF(missing), REF(a))\n"
+	c := &client{t: t}
+	c.request("initialize", map[string]interface{}{"rootUri": pathURI(dir)})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": rulesURI, "text": text},
+	})
+	completion := c.request("textDocument/completion", at(rulesURI, position(text, "REF(shared", 4)))
+	responses, notifications := c.run(NewServer(Options{}))
+
+	var p publishDiagnosticsParams
+	if err := json.Unmarshal(notifications[0].Params, &p); err != nil {
+		t.Fatal(err)
+	}
+	want := map[Position]string{
+		position(text, "b)", 0):       "reference cycle b -> a -> b",
+		position(text, "a)\nRULE", 0): "reference cycle a -> b -> a",
+		position(text, "missing", 0):  "undefined reference missing",
+	}
+	got := make(map[Position]string)
+	for _, d := range p.Diagnostics {
+		got[d.Range.Start] = d.Message
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect diagnostics, got: %v, want: %v", got, want)
+	}
+
+	var items []CompletionItem
+	result(t, responses[completion], &items)
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Label)
+	}
+	if want := []string{"a", "b", "r", "shared"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("incorrect completion of references, got: %v, want: %v", names, want)
+	}
+}
+
+func TestServerHover(t *testing.T) {
+	c := &client{t: t}
+	c.request("initialize", map[string]interface{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": rulesURI, "text": rules},
+	})
+	cases := map[Position]string{
+		position(rules, "AND(", 1):                 "**AND**",
+		position(rules, "=!>", 1):                  "does not go to",
+		position(rules, `"Shipped"`, 3):            "string literal",
+		position(rules, `d"1h"`, 0):                "duration literal",
+		position(rules, `d"1h"`, 3):                "duration literal",
+		position(rules, "Carrier", 2):              "**Carrier** — string",
+		position(rules, "RULE unknown", 2):         "Declares a named rule",
+		position(rules, "see shipped", 6):          "Orders that shipped without a carrier.",
+		position(rules, "shipped_without_carr", 0): "EVAL(Carrier =!> *)",
+	}
+	ids := make(map[int]Position)
+	for p := range cases {
+		ids[c.request("textDocument/hover", at(rulesURI, p))] = p
+	}
+	blank := c.request("textDocument/hover", at(rulesURI, Position{Line: 4, Character: 1}))
+	responses, _ := c.run(NewServer(Options{Schema: diffq.NewSchema(order{})}))
+
+	for id, p := range ids {
+		var h *Hover
+		result(t, responses[id], &h)
+		if h == nil || !strings.Contains(h.Contents.Value, cases[p]) {
+			t.Errorf("incorrect hover for %v, got: %v, want: %s", p, h, cases[p])
+		}
+	}
+	if string(responses[blank].Result) != "null" {
+		t.Errorf("incorrect hover for blank position, got: %s", responses[blank].Result)
+	}
+}
+
+func TestServerCompletion(t *testing.T) {
+	text := "RULE r = AND(EVAL(Items.*.Qu), EVAL(Items =G), EV"
+	cases := map[Position][]string{
+		position(text, "Qu", 2):     {"Quantity"},
+		position(text, "Items.", 6): {"$first", "$last", "*"},
+		position(text, "=G", 2):     {"=GT>", "=GTE>"},
+		position(text, "EV", 2):     {"EVAL", "EVENTUALLY"},
+		position(text, "(Items", 2): {"Items"},
+	}
+	c := &client{t: t}
+	c.request("initialize", map[string]interface{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": rulesURI, "text": text},
+	})
+	ids := make(map[int]Position)
+	for p := range cases {
+		ids[c.request("textDocument/completion", at(rulesURI, p))] = p
+	}
+	responses, _ := c.run(NewServer(Options{Schema: diffq.NewSchema(order{})}))
+
+	for id, p := range ids {
+		var items []CompletionItem
+		result(t, responses[id], &items)
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Label)
+		}
+		if strings.Join(got, " ") != strings.Join(cases[p], " ") {
+			t.Errorf("incorrect completion for %v, got: %v, want: %v", p, got, cases[p])
+		}
+	}
+}
+
+func TestServerCompletionSchemaOption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diffq-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	schema := `{"type": "object", "properties": {"Status": {"type": "string", "description": "order status"}}}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "schema.json"), []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "EVAL(Stat"
+	c := &client{t: t}
+	c.request("initialize", map[string]interface{}{
+		"rootUri":               pathURI(dir),
+		"initializationOptions": map[string]string{"schema": "schema.json"},
+	})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": rulesURI, "text": text},
+	})
+	id := c.request("textDocument/completion", at(rulesURI, Position{Line: 0, Character: 9}))
+	responses, _ := c.run(NewServer(Options{}))
+
+	var items []CompletionItem
+	result(t, responses[id], &items)
+	if len(items) != 1 || items[0].Label != "Status" || items[0].Detail != "string: order status" {
+		t.Errorf("incorrect completion, got: %+v", items)
+	}
+	if items[0].TextEdit.Range.Start.Character != 5 {
+		t.Errorf("incorrect completion edit, got: %+v", items[0].TextEdit)
+	}
+}
+
+func TestServerDefinition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diffq-lsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	other := "\n\nRULE elsewhere = EVAL(Status => *)\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.dq"), []byte(other), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "RULE local = TRUE\n/* local elsewhere missing */"
+	c := &client{t: t}
+	c.request("initialize", map[string]interface{}{"rootUri": pathURI(dir)})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": rulesURI, "text": text},
+	})
+	local := c.request("textDocument/definition", at(rulesURI, position(text, "local elsewhere", 2)))
+	elsewhere := c.request("textDocument/definition", at(rulesURI, position(text, "elsewhere missing", 2)))
+	missing := c.request("textDocument/definition", at(rulesURI, position(text, "missing", 2)))
+	responses, _ := c.run(NewServer(Options{}))
+
+	cases := map[int]Location{
+		local:     {URI: rulesURI, Range: Range{Start: Position{0, 5}, End: Position{0, 10}}},
+		elsewhere: {URI: pathURI(filepath.Join(dir, "other.dq")), Range: Range{Start: Position{2, 5}, End: Position{2, 14}}},
+	}
+	for id, want := range cases {
+		var got []Location
+		result(t, responses[id], &got)
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("incorrect definition, got: %v, want: %v", got, want)
+		}
+	}
+	if string(responses[missing].Result) != "null" {
+		t.Errorf("incorrect definition of missing rule, got: %s", responses[missing].Result)
+	}
+}
+
+func TestServerFormatting(t *testing.T) {
+	text := "/* doc */\nRULE a=AND(EVAL(A => 1),EVAL(B => 2))\nRULE b = or(eval(C => 3))"
+	c := &client{t: t}
+	c.request("initialize", map[string]interface{}{})
+	c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": rulesURI, "text": text},
+	})
+	format := c.request("textDocument/formatting", map[string]interface{}{"textDocument": map[string]string{"uri": rulesURI}})
+	symbols := c.request("textDocument/documentSymbol", map[string]interface{}{"textDocument": map[string]string{"uri": rulesURI}})
+	unknown := c.request("textDocument/unknown", map[string]interface{}{})
+	responses, _ := c.run(NewServer(Options{}))
+
+	var edits []TextEdit
+	result(t, responses[format], &edits)
+	want := "/* doc */\nRULE a = AND(\n    EVAL(A => 1),\n    EVAL(B => 2)\n)\nRULE b = OR(\n    EVAL(C => 3)\n)\n"
+	if len(edits) != 1 || edits[0].NewText != want || edits[0].Range.End != (Position{2, 25}) {
+		t.Errorf("incorrect formatting, got: %+v, want: %q", edits, want)
+	}
+
+	var got []DocumentSymbol
+	result(t, responses[symbols], &got)
+	if len(got) != 2 || got[0].Name != "a" || got[0].Detail != "doc" || got[1].Name != "b" {
+		t.Errorf("incorrect symbols, got: %+v", got)
+	}
+
+	if responses[unknown].Error == nil || responses[unknown].Error.Code != codeMethodNotFound {
+		t.Errorf("incorrect response for unknown method, got: %+v", responses[unknown])
+	}
+}
+
+func TestServerExitWithoutShutdown(t *testing.T) {
+	c := &client{t: t}
+	c.notify("exit", nil)
+	if err := NewServer(Options{}).Serve(&c.in, ioutil.Discard); err == nil {
+		t.Error("expected error for exit without shutdown")
+	}
+}
+
+func TestPositionOffset(t *testing.T) {
+	text := "ab\né😀x\n"
+	cases := map[int]Position{
+		0:  {0, 0},
+		2:  {0, 2},
+		3:  {1, 0},
+		5:  {1, 1},
+		9:  {1, 3},
+		10: {1, 4},
+		11: {2, 0},
+	}
+	for offset, p := range cases {
+		if got := offsetPosition(text, offset); got != p {
+			t.Errorf("incorrect position for %d, got: %v, want: %v", offset, got, p)
+		}
+		if got := positionOffset(text, p); got != offset {
+			t.Errorf("incorrect offset for %v, got: %d, want: %d", p, got, offset)
+		}
+	}
+}
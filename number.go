@@ -0,0 +1,139 @@
+package diffq
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// parseNumber returns the type and value of the number literal s written in
+// the syntax of a Go integer or floating-point literal, e.g. 1_000, 0xFF, 0o17,
+// 0b101, 1.5e-3 or 0x1p-2. Integers are not limited in size; floats must be
+// within the range of a float64.
+func parseNumber(s string) (tokenType, *big.Rat, error) {
+	if i, ok := new(big.Int).SetString(s, 0); ok {
+		return cINT, new(big.Rat).SetInt(i), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return "", nil, errors.Errorf("invalid number literal %s", s)
+	}
+	if math.IsInf(f, 0) || (f == 0 && nonZeroMantissa(s)) {
+		return "", nil, errors.Errorf("number literal %s out of range", s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return "", nil, errors.Errorf("invalid number literal %s", s)
+	}
+	return cFLOAT, r, nil
+}
+
+// nonZeroMantissa reports whether the mantissa of the float literal s holds a
+// non-zero digit.
+func nonZeroMantissa(s string) bool {
+	s = strings.TrimLeft(s, "+-")
+	digits := "123456789"
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s, digits = s[2:], "123456789abcdefABCDEF"
+		if i := strings.IndexAny(s, "pP"); i >= 0 {
+			s = s[:i]
+		}
+	} else if i := strings.IndexAny(s, "eE"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.ContainsAny(s, digits)
+}
+
+// compareNumber compares the value v to the INT or FLOAT literal tok returning
+// -1, 0 or 1 and true, or false if v is not a number or is NaN. Integers, big
+// numbers, json.Number values and numeric strings are compared exactly; a
+// float32 or float64 value
+// is compared to the literal rounded to the precision of the value, as though
+// the literal were converted to its type.
+func compareNumber(v interface{}, tok *token) (int, bool) {
+	if tok.ttype != cINT && tok.ttype != cFLOAT {
+		return 0, false
+	}
+	_, lit, err := parseNumber(tok.tliteral)
+	if err != nil {
+		return 0, false
+	}
+
+	switch n := v.(type) {
+	case json.Number:
+		r, ok := new(big.Rat).SetString(string(n))
+		if !ok {
+			return 0, false
+		}
+		return r.Cmp(lit), true
+	case *big.Int:
+		if n == nil {
+			return 0, false
+		}
+		return new(big.Rat).SetInt(n).Cmp(lit), true
+	case big.Int:
+		return new(big.Rat).SetInt(&n).Cmp(lit), true
+	case *big.Rat:
+		if n == nil {
+			return 0, false
+		}
+		return n.Cmp(lit), true
+	case big.Rat:
+		return n.Cmp(lit), true
+	case *big.Float:
+		if n == nil {
+			return 0, false
+		}
+		return compareBigFloat(n, lit), true
+	case big.Float:
+		return compareBigFloat(&n, lit), true
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return new(big.Rat).SetInt64(rv.Int()).Cmp(lit), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(rv.Uint())).Cmp(lit), true
+	case reflect.Float32:
+		f, _ := lit.Float32()
+		return compareFloat(float64(float32(rv.Float())), float64(f))
+	case reflect.Float64:
+		f, _ := lit.Float64()
+		return compareFloat(rv.Float(), f)
+	case reflect.String:
+		r, ok := new(big.Rat).SetString(strings.TrimSpace(rv.String()))
+		if !ok {
+			return 0, false
+		}
+		return r.Cmp(lit), true
+	}
+	return 0, false
+}
+
+// compareFloat compares a to b returning false if either is NaN.
+func compareFloat(a, b float64) (int, bool) {
+	switch {
+	case math.IsNaN(a) || math.IsNaN(b):
+		return 0, false
+	case a < b:
+		return -1, true
+	case a > b:
+		return 1, true
+	}
+	return 0, true
+}
+
+// compareBigFloat compares f to r.
+func compareBigFloat(f *big.Float, r *big.Rat) int {
+	if f.IsInf() {
+		return f.Sign()
+	}
+	x, _ := f.Rat(nil)
+	return x.Cmp(r)
+}
@@ -0,0 +1,119 @@
+package diffq
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := map[string]struct {
+		ttype tokenType
+		value string
+	}{
+		`100`:                   {cINT, "100"},
+		`-123`:                  {cINT, "-123"},
+		`1_000_000`:             {cINT, "1000000"},
+		`0xFF`:                  {cINT, "255"},
+		`0XfF`:                  {cINT, "255"},
+		`0o17`:                  {cINT, "15"},
+		`0755`:                  {cINT, "493"},
+		`0b1010`:                {cINT, "10"},
+		`-0x10`:                 {cINT, "-16"},
+		`18446744073709551615`:  {cINT, "18446744073709551615"},
+		`123456789012345678901`: {cINT, "123456789012345678901"},
+		`1.5`:                   {cFLOAT, "3/2"},
+		`-3.1415`:               {cFLOAT, "-6283/2000"},
+		`1e6`:                   {cFLOAT, "1000000"},
+		`1.5e-3`:                {cFLOAT, "3/2000"},
+		`2E+2`:                  {cFLOAT, "200"},
+		`1_000.25`:              {cFLOAT, "4001/4"},
+		`0x1p-2`:                {cFLOAT, "1/4"},
+		`0.1`:                   {cFLOAT, "1/10"},
+	}
+	for literal, want := range tests {
+		ttype, value, err := parseNumber(literal)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", literal, err)
+			continue
+		}
+		if ttype != want.ttype || value.RatString() != want.value {
+			t.Errorf("incorrect result for %s, got: %s %s, want: %s %s", literal, ttype, value.RatString(), want.ttype, want.value)
+		}
+	}
+
+	errs := map[string]string{
+		`1__0`:   "invalid number literal 1__0",
+		`_1`:     "invalid number literal _1",
+		`1.2.3`:  "invalid number literal 1.2.3",
+		`0x`:     "invalid number literal 0x",
+		`0b102`:  "invalid number literal 0b102",
+		`12abc`:  "invalid number literal 12abc",
+		`-`:      "invalid number literal -",
+		`1e400`:  "number literal 1e400 out of range",
+		`1e-400`: "number literal 1e-400 out of range",
+	}
+	for literal, want := range errs {
+		if _, _, err := parseNumber(literal); err == nil || err.Error() != want {
+			t.Errorf("incorrect error for %s, got: %v, want: %s", literal, err, want)
+		}
+	}
+	if _, _, err := parseNumber(`0e-400`); err != nil {
+		t.Errorf("unexpected error for 0e-400: %v", err)
+	}
+}
+
+func TestCompareNumber(t *testing.T) {
+	type Count uint16
+	tests := []struct {
+		value   interface{}
+		literal string
+		want    int
+		ok      bool
+	}{
+		{int(5), "5", 0, true},
+		{int8(-3), "-0x3", 0, true},
+		{Count(7), "1_0", -1, true},
+		{uint64(math.MaxUint64), "18446744073709551615", 0, true},
+		{uint64(math.MaxUint64), "18446744073709551614", 1, true},
+		{uint64(math.MaxUint64), "-1", 1, true},
+		{uint64(1 << 63), "9223372036854775807", 1, true},
+		{int64(math.MinInt64), "-9223372036854775808", 0, true},
+		{int(2), "2.5", -1, true},
+		{int(3), "2.5", 1, true},
+		{int(1000000), "1e6", 0, true},
+		{float64(0.1), "0.1", 0, true},
+		{float64(2.5), "2", 1, true},
+		{float64(1e6), "1_000_000", 0, true},
+		{float32(2.718), "2.718", 0, true},
+		{float32(0.1), "0.1", 0, true},
+		{math.Inf(1), "1e300", 1, true},
+		{math.NaN(), "0", 0, false},
+		{big.NewInt(0).Lsh(big.NewInt(1), 100), "1267650600228229401496703205376", 0, true},
+		{big.NewInt(0).Lsh(big.NewInt(1), 100), "1e30", 1, true},
+		{big.NewRat(1, 10), "0.1", 0, true},
+		{big.NewRat(1, 3), "0.3333333333333333", 1, true},
+		{new(big.Float).SetInf(true), "-1e300", -1, true},
+		{json.Number("18446744073709551615"), "18446744073709551614", 1, true},
+		{json.Number("123456789012345678901234567890"), "123456789012345678901234567890", 0, true},
+		{json.Number("2.5e-1"), "0.25", 0, true},
+		{json.Number("x"), "0", 0, false},
+		{big.NewFloat(0.5), "0x1p-1", 0, true},
+		{"42", "42", 0, true},
+		{"4.2e1", "42", 0, true},
+		{"forty-two", "42", 0, false},
+		{nil, "0", 0, false},
+		{true, "1", 0, false},
+	}
+	for _, test := range tests {
+		ttype, _, err := parseNumber(test.literal)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", test.literal, err)
+		}
+		got, ok := compareNumber(test.value, &token{ttype: ttype, tliteral: test.literal})
+		if got != test.want || ok != test.ok {
+			t.Errorf("incorrect result for %v (%T) and %s, got: %d %t, want: %d %t", test.value, test.value, test.literal, got, ok, test.want, test.ok)
+		}
+	}
+}
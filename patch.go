@@ -0,0 +1,569 @@
+package diffq
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Conflict describes a change that could not be applied because the target did
+// not hold the value the change was calculated from.
+type Conflict struct {
+	// Change is the change that could not be applied.
+	Change Change
+	// Current holds the value found in the target at the path of the change if
+	// one exists.
+	Current interface{}
+	// Reason describes why the change could not be applied.
+	Reason string
+}
+
+// ConflictError is returned when applying changes to a target that does not
+// match the state the changes were calculated from. Changes that do not
+// conflict are still applied.
+type ConflictError struct {
+	// Conflicts holds each of the changes that could not be applied.
+	Conflicts []Conflict
+}
+
+// Error returns a summary of the conflicts encountered.
+func (e *ConflictError) Error() string {
+	var paths []string
+	for _, c := range e.Conflicts {
+		paths = append(paths, fmt.Sprintf("%s (%s)", strings.Join(c.Change.Path, "."), c.Reason))
+	}
+	return fmt.Sprintf("apply error: %d conflicting change(s): %s", len(e.Conflicts), strings.Join(paths, ", "))
+}
+
+// Apply patches the value pointed to by target with the changes in the Diff, d.
+// Target is expected to hold a copy of the original value; see Changes.Apply.
+func (d *Diff) Apply(target interface{}) error {
+	return d.Changes.Apply(target)
+}
+
+// Apply patches the value pointed to by target with the changes, cs, producing
+// the new value the changes were calculated against. Nested structs, pointers,
+// slices, arrays and maps are traversed using the same path components as
+// Differential. Slices, maps and pointed to values are copied before they are
+// modified so values shared with target, such as those of the original, are
+// left untouched.
+//
+// A change conflicts when the target does not hold the value in Change.From or
+// when its path cannot be resolved. Conflicting changes are skipped and
+// reported by returning a *ConflictError once all other changes are applied.
+func (cs Changes) Apply(target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("apply error: target must be a non-nil pointer")
+	}
+
+	p := &patcher{}
+	var entries []patchEntry
+	for _, c := range cs {
+		entries = append(entries, patchEntry{change: c, rel: c.Path})
+	}
+	p.apply(rv.Elem(), entries)
+
+	if len(p.conflicts) > 0 {
+		return &ConflictError{Conflicts: p.conflicts}
+	}
+	return nil
+}
+
+// patchEntry pairs a change with the portion of its path remaining relative to
+// the value currently being patched.
+type patchEntry struct {
+	change Change
+	rel    []string
+}
+
+// patcher applies changes to a value and accumulates the conflicts found.
+type patcher struct {
+	conflicts []Conflict
+}
+
+// conflict records the change in e as conflicting with the value v.
+func (p *patcher) conflict(e patchEntry, v reflect.Value, reason string) {
+	c := Conflict{Change: e.change, Reason: reason}
+	if v.IsValid() && v.CanInterface() {
+		c.Current = v.Interface()
+	}
+	p.conflicts = append(p.conflicts, c)
+}
+
+// conflictAll records each of the changes in entries as conflicting.
+func (p *patcher) conflictAll(entries []patchEntry, v reflect.Value, reason string) {
+	for _, e := range entries {
+		p.conflict(e, v, reason)
+	}
+}
+
+// apply patches the settable value v with entries whose paths are relative to v.
+func (p *patcher) apply(v reflect.Value, entries []patchEntry) {
+	var nested []patchEntry
+	for _, e := range entries {
+		if len(e.rel) == 0 {
+			p.applyLeaf(v, e)
+		} else {
+			nested = append(nested, e)
+		}
+	}
+	if len(nested) == 0 {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if !v.IsNil() {
+			elem.Elem().Set(v.Elem())
+		}
+		p.apply(elem.Elem(), nested)
+		v.Set(elem)
+	case reflect.Interface:
+		if v.IsNil() {
+			p.conflictAll(nested, v, "cannot traverse nil value")
+			return
+		}
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		p.apply(elem, nested)
+		v.Set(elem)
+	case reflect.Struct:
+		keys, groups := groupEntries(nested)
+		for _, k := range keys {
+			field, ok := fieldByPathName(v, k)
+			if !ok {
+				p.conflictAll(groups[k], v, "no field "+k)
+				continue
+			}
+			p.apply(field, groups[k])
+		}
+	case reflect.Map:
+		p.applyMap(v, nested)
+	case reflect.Slice, reflect.Array:
+		p.applySlice(v, nested)
+	default:
+		p.conflictAll(nested, v, "cannot traverse "+v.Kind().String())
+	}
+}
+
+// applyLeaf applies the change in e to v itself.
+func (p *patcher) applyLeaf(v reflect.Value, e patchEntry) {
+	switch e.change.Type {
+	case ChangeCreate:
+		if !v.IsZero() {
+			p.conflict(e, v, "value already exists")
+			return
+		}
+	case ChangeUpdate, ChangeDelete:
+		if !valueEquals(v, e.change.From) {
+			p.conflict(e, v, "current value does not match")
+			return
+		}
+	default:
+		p.conflict(e, v, "unsupported change type "+string(e.change.Type))
+		return
+	}
+
+	if e.change.Type == ChangeDelete {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	nv, ok := valueOfType(e.change.To, v.Type())
+	if !ok {
+		p.conflict(e, v, fmt.Sprintf("cannot assign %T", e.change.To))
+		return
+	}
+	v.Set(nv)
+}
+
+// applyMap patches the entries of the map v. Each key is either created,
+// deleted or modified in place.
+func (p *patcher) applyMap(v reflect.Value, entries []patchEntry) {
+	m := reflect.MakeMapWithSize(v.Type(), v.Len())
+	for _, k := range v.MapKeys() {
+		m.SetMapIndex(k, v.MapIndex(k))
+	}
+
+	keys, groups := groupEntries(entries)
+	for _, k := range keys {
+		group := groups[k]
+		key, ok := mapKey(m, k)
+		if !ok {
+			p.conflictAll(group, v, "invalid key "+k)
+			continue
+		}
+		cur := m.MapIndex(key)
+		elem := reflect.New(v.Type().Elem()).Elem()
+
+		switch elementAction(group, v.Type().Elem()) {
+		case ChangeCreate:
+			if cur.IsValid() {
+				p.conflictAll(group, cur, "key already exists")
+				continue
+			}
+			p.apply(elem, group)
+			m.SetMapIndex(key, elem)
+		case ChangeDelete:
+			if !cur.IsValid() {
+				p.conflictAll(group, cur, "key does not exist")
+				continue
+			}
+			elem.Set(cur)
+			if p.applyChecked(elem, group) {
+				m.SetMapIndex(key, reflect.Value{})
+			}
+		case ChangeUpdate:
+			if !cur.IsValid() {
+				p.conflictAll(group, cur, "key does not exist")
+				continue
+			}
+			elem.Set(cur)
+			p.apply(elem, group)
+			m.SetMapIndex(key, elem)
+		default:
+			p.conflictAll(group, cur, "cannot move map entries")
+		}
+	}
+
+	if v.IsNil() && m.Len() == 0 {
+		return
+	}
+	v.Set(m)
+}
+
+// applySlice patches the elements of the slice or array v. Following the
+// underlying diff library, deleted elements are identified by their original
+// index while created, modified and moved elements are identified by their new
+// index. Elements without changes retain their relative order and fill the
+// remaining positions.
+func (p *patcher) applySlice(v reflect.Value, entries []patchEntry) {
+	if v.Kind() == reflect.Slice && hasIdentifiedElements(v) {
+		p.applyIdentifiedSlice(v, entries)
+		return
+	}
+
+	var moves, rest []patchEntry
+	for _, e := range entries {
+		if len(e.rel) == 1 && e.change.Type == ChangeMove {
+			moves = append(moves, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+
+	n := v.Len()
+	elemType := v.Type().Elem()
+	used := make(map[int]bool)
+	placed := make(map[int]reflect.Value)
+	placedBy := make(map[int][]patchEntry)
+	removed, inserted := 0, 0
+
+	keys, groups := groupEntries(rest)
+	for _, k := range keys {
+		group := groups[k]
+		idx, err := strconv.Atoi(k)
+		if err != nil || idx < 0 {
+			p.conflictAll(group, v, "invalid index "+k)
+			continue
+		}
+		elem := reflect.New(elemType).Elem()
+
+		switch elementAction(group, elemType) {
+		case ChangeCreate:
+			p.apply(elem, group)
+			placed[idx], placedBy[idx] = elem, group
+			inserted++
+		case ChangeDelete:
+			if idx >= n || used[idx] {
+				p.conflictAll(group, reflect.Value{}, "index out of range")
+				continue
+			}
+			elem.Set(v.Index(idx))
+			if p.applyChecked(elem, group) {
+				used[idx] = true
+				removed++
+			}
+		default:
+			if idx >= n || used[idx] {
+				p.conflictAll(group, reflect.Value{}, "index out of range")
+				continue
+			}
+			elem.Set(v.Index(idx))
+			p.apply(elem, group)
+			used[idx] = true
+			placed[idx], placedBy[idx] = elem, group
+		}
+	}
+
+	for _, e := range moves {
+		from := e.change.FromIndex
+		to, err := strconv.Atoi(e.rel[0])
+		if err != nil || from < 0 || from >= n || used[from] {
+			p.conflict(e, reflect.Value{}, "invalid move")
+			continue
+		}
+		used[from] = true
+		placed[to], placedBy[to] = v.Index(from), []patchEntry{e}
+	}
+
+	if v.Kind() == reflect.Array {
+		if removed > 0 || inserted > 0 {
+			p.conflictAll(rest, v, "cannot resize array")
+			return
+		}
+		for idx, elem := range placed {
+			v.Index(idx).Set(elem)
+		}
+		return
+	}
+
+	length := n - removed + inserted
+	result := reflect.MakeSlice(v.Type(), length, length)
+	next := 0
+	for j := 0; j < length; j++ {
+		if elem, ok := placed[j]; ok {
+			result.Index(j).Set(elem)
+			continue
+		}
+		for next < n && used[next] {
+			next++
+		}
+		if next >= n {
+			p.conflictAll(entries, v, "changes are inconsistent with slice")
+			return
+		}
+		result.Index(j).Set(v.Index(next))
+		next++
+	}
+	for j, group := range placedBy {
+		if j >= length {
+			p.conflictAll(group, v, "index out of range")
+		}
+	}
+
+	if v.IsNil() && length == 0 {
+		return
+	}
+	v.Set(result)
+}
+
+// applyIdentifiedSlice patches the elements of a slice whose elements are
+// identified by a field tagged as an identifier rather than by position.
+func (p *patcher) applyIdentifiedSlice(v reflect.Value, entries []patchEntry) {
+	result := reflect.MakeSlice(v.Type(), 0, v.Len())
+	index := make(map[string]int)
+	for i := 0; i < v.Len(); i++ {
+		result = reflect.Append(result, v.Index(i))
+		index[elementIdentifier(v.Index(i))] = i
+	}
+
+	var removed []int
+	keys, groups := groupEntries(entries)
+	for _, k := range keys {
+		group := groups[k]
+		i, exists := index[k]
+		elem := reflect.New(v.Type().Elem()).Elem()
+
+		switch elementAction(group, v.Type().Elem()) {
+		case ChangeCreate:
+			if exists {
+				p.conflictAll(group, result.Index(i), "element already exists")
+				continue
+			}
+			p.apply(elem, group)
+			result = reflect.Append(result, elem)
+		case ChangeDelete:
+			if !exists {
+				p.conflictAll(group, reflect.Value{}, "element does not exist")
+				continue
+			}
+			elem.Set(result.Index(i))
+			if p.applyChecked(elem, group) {
+				removed = append(removed, i)
+			}
+		case ChangeUpdate:
+			if !exists {
+				p.conflictAll(group, reflect.Value{}, "element does not exist")
+				continue
+			}
+			elem.Set(result.Index(i))
+			p.apply(elem, group)
+			result.Index(i).Set(elem)
+		default:
+			p.conflictAll(group, v, "cannot move identified elements")
+		}
+	}
+
+	if len(removed) > 0 {
+		drop := make(map[int]bool)
+		for _, i := range removed {
+			drop[i] = true
+		}
+		kept := reflect.MakeSlice(v.Type(), 0, result.Len()-len(removed))
+		for i := 0; i < result.Len(); i++ {
+			if !drop[i] {
+				kept = reflect.Append(kept, result.Index(i))
+			}
+		}
+		result = kept
+	}
+	v.Set(result)
+}
+
+// applyChecked applies entries to v and returns true if none of the entries
+// conflicted.
+func (p *patcher) applyChecked(v reflect.Value, entries []patchEntry) bool {
+	before := len(p.conflicts)
+	p.apply(v, entries)
+	return len(p.conflicts) == before
+}
+
+// groupEntries groups entries by the first component of their relative path
+// and strips it. The keys are returned in order of first appearance.
+func groupEntries(entries []patchEntry) ([]string, map[string][]patchEntry) {
+	var keys []string
+	groups := make(map[string][]patchEntry)
+	for _, e := range entries {
+		k := e.rel[0]
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], patchEntry{change: e.change, rel: e.rel[1:]})
+	}
+	return keys, groups
+}
+
+// elementAction determines whether the changes grouped under a single slice
+// element or map entry create, delete, move or modify the element. The
+// underlying diff library represents a created or deleted struct as a change
+// per non-zero field, so a group consisting solely of creates or deletes where
+// at least one targets a field of a struct element is treated as creating or
+// deleting the element as a whole.
+func elementAction(group []patchEntry, elemType reflect.Type) ChangeType {
+	for _, e := range group {
+		if len(e.rel) == 0 {
+			return e.change.Type
+		}
+	}
+
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return ChangeUpdate
+	}
+
+	action := group[0].change.Type
+	direct := false
+	for _, e := range group {
+		if e.change.Type != action {
+			return ChangeUpdate
+		}
+		if len(e.rel) == 1 {
+			direct = true
+		}
+	}
+	if direct && (action == ChangeCreate || action == ChangeDelete) {
+		return action
+	}
+	return ChangeUpdate
+}
+
+// fieldByPathName returns the field of the struct v identified by the path
+// component name.
+func fieldByPathName(v reflect.Value, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if n, ok := fieldPathName(v.Type().Field(i)); ok && n == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// elementIdentifier returns the path component for an element of a slice
+// whose elements are identified by a field tagged as an identifier.
+func elementIdentifier(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	for i := 0; i < v.NumField(); i++ {
+		parts := strings.Split(v.Type().Field(i).Tag.Get("diff"), ",")
+		for _, opt := range parts[1:] {
+			if opt == "identifier" {
+				return fmt.Sprint(v.Field(i).Interface())
+			}
+		}
+	}
+	return ""
+}
+
+// mapKey converts the path component k to a key of the map m.
+func mapKey(m reflect.Value, k string) (reflect.Value, bool) {
+	kt := m.Type().Key()
+	for _, mk := range m.MapKeys() {
+		if fmt.Sprint(mk.Interface()) == k {
+			return mk, true
+		}
+	}
+	var kv interface{}
+	var err error
+	switch kt.Kind() {
+	case reflect.String:
+		kv = k
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		kv, err = strconv.ParseInt(k, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		kv, err = strconv.ParseUint(k, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		kv, err = strconv.ParseFloat(k, 64)
+	case reflect.Bool:
+		kv, err = strconv.ParseBool(k)
+	default:
+		return reflect.Value{}, false
+	}
+	if err != nil {
+		return reflect.Value{}, false
+	}
+	return reflect.ValueOf(kv).Convert(kt), true
+}
+
+// valueOfType returns x as a value assignable to t. Numeric values are converted
+// between numeric types; nil results in the zero value of t.
+func valueOfType(x interface{}, t reflect.Type) (reflect.Value, bool) {
+	if x == nil {
+		return reflect.Zero(t), true
+	}
+	xv := reflect.ValueOf(x)
+	if xv.Type().AssignableTo(t) {
+		return xv, true
+	}
+	if (isNumericKind(xv.Kind()) && isNumericKind(t.Kind())) || (xv.Kind() == t.Kind() && xv.Type().ConvertibleTo(t)) {
+		return xv.Convert(t), true
+	}
+	return reflect.Value{}, false
+}
+
+// valueEquals reports whether the value v is deeply equal to x after
+// converting x to the type of v.
+func valueEquals(v reflect.Value, x interface{}) bool {
+	if x == nil {
+		return v.IsZero()
+	}
+	xv, ok := valueOfType(x, v.Type())
+	if !ok {
+		return false
+	}
+	return reflect.DeepEqual(v.Interface(), xv.Interface())
+}
+
+func isNumericKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
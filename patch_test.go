@@ -0,0 +1,119 @@
+package diffq
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type KeyedType struct {
+	ID    string `diff:"id,identifier"`
+	Value int    `diff:"value"`
+}
+
+type PatchType struct {
+	OuterType
+	Keyed []KeyedType
+	MN    map[string]*NestedType
+}
+
+func newPatchTypes() (*PatchType, *PatchType) {
+	newTime, _ := time.Parse(time.RFC3339, "2020-01-01T12:00:00-04:00")
+	a := &PatchType{
+		OuterType: OuterType{
+			S:   "StringS",
+			I:   1,
+			F64: 3.1415,
+			T:   newTime.Add(-time.Hour),
+			D:   time.Hour,
+			SS:  []string{"SS1", "SS2", "SS3", "SS4"},
+			IS:  []int{1, 2, 3},
+			NT:  NestedType{NS: "StringNS", NSS: []string{"NSS1"}},
+			NTP: &NestedType{NS: "StringNS", NI: 123},
+			NTS: []*NestedType{
+				{NS: "A", NI: 1, NSS: []string{"A1", "A2"}},
+				{NS: "B", NI: 2},
+				{NS: "C", NI: 3},
+			},
+			M: map[string]int{"one": 1, "two": 2},
+		},
+		Keyed: []KeyedType{{ID: "a", Value: 1}, {ID: "b", Value: 2}},
+		MN:    map[string]*NestedType{"x": {NS: "X"}},
+	}
+	b := &PatchType{
+		OuterType: OuterType{
+			S:   "StringSU",
+			I:   12,
+			F64: 100.5,
+			T:   newTime,
+			D:   2 * time.Hour,
+			SS:  []string{"SS4", "SS1", "SS3"},
+			IS:  []int{0, 1, 2, 3, 4},
+			NT:  NestedType{NS: "StringNSU", NSS: []string{"NSS1", "NSS2"}},
+			NTP: nil,
+			NTS: []*NestedType{
+				{NS: "A", NI: 1, NSS: []string{"A1u", "ans", "A2"}},
+				{NS: "C", NI: 3},
+				{NS: "D", NI: 4, NSS: []string{"D1"}},
+			},
+			M: map[string]int{"one": 2, "three": 3},
+		},
+		Keyed: []KeyedType{{ID: "a", Value: 10}, {ID: "c", Value: 3}},
+		MN:    map[string]*NestedType{"y": {NS: "Y", NI: 1}},
+	}
+	return a, b
+}
+
+func TestApply(t *testing.T) {
+	a, b := newPatchTypes()
+	d, err := Differential(a, b, WithMoves())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	original, _ := newPatchTypes()
+	target := *original
+	if err := d.Apply(&target); err != nil {
+		t.Fatalf("unexpected error applying diff: %v", err)
+	}
+	if !reflect.DeepEqual(&target, b) {
+		t.Errorf("incorrect result applying diff, got: %+v, want: %+v", target, *b)
+	}
+
+	// values shared with the target must not be modified
+	if !reflect.DeepEqual(original, a) {
+		t.Errorf("original modified applying diff, got: %+v, want: %+v", *original, *a)
+	}
+
+	ptarget, _ := newPatchTypes()
+	if err := d.Changes.Apply(&ptarget); err != nil {
+		t.Fatalf("unexpected error applying changes to pointer: %v", err)
+	}
+	if !reflect.DeepEqual(ptarget, b) {
+		t.Errorf("incorrect result applying changes to pointer, got: %+v, want: %+v", *ptarget, *b)
+	}
+}
+
+func TestApplyConflict(t *testing.T) {
+	a, b := newPatchTypes()
+	d, _ := Differential(a, b, WithMoves())
+
+	target, _ := newPatchTypes()
+	target.S = "Modified"
+	err := d.Apply(target)
+	ce, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("incorrect error applying diff, got: %v, want: *ConflictError", err)
+	}
+	if len(ce.Conflicts) != 1 || strings.Join(ce.Conflicts[0].Change.Path, ".") != "OuterType.S" || ce.Conflicts[0].Current != "Modified" {
+		t.Errorf("incorrect conflicts, got: %+v", ce.Conflicts)
+	}
+	if target.S != "Modified" || target.I != b.I {
+		t.Errorf("incorrect result applying diff with conflicts, got: %+v", *target)
+	}
+
+	if err := d.Apply(*target); err == nil {
+		t.Errorf("expected error applying diff to non-pointer")
+	}
+}
@@ -0,0 +1,366 @@
+package diffq
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// placeholderPattern matches the placeholders of a query: a name prefixed with
+// a colon, e.g. :target, or a number prefixed with a dollar sign, e.g. $1.
+var placeholderPattern = regexp.MustCompile(`^(:[A-Za-z_][A-Za-z0-9_]*|\$[0-9]+)$`)
+
+// segmentPattern matches the values that may be bound to a placeholder within a
+// path.
+var segmentPattern = regexp.MustCompile(`^[A-Za-z0-9_\-]+$`)
+
+// Query is a statement holding placeholders for values that are bound before
+// the statement is evaluated. A placeholder is written as :name or $1 and may be
+// used in place of a literal value or of a component of a path:
+//
+//	EVAL(Orders.:id.Status => :target)
+//
+// Values are bound as literals of their type, so a bound string cannot alter
+// the structure of the statement.
+type Query struct {
+	statement string
+	params    []string
+}
+
+// NewQuery returns the Query of statement and an error if the statement is
+// invalid or holds a malformed placeholder. The expression of each EVAL is
+// validated with its placeholders taken to be literals; the type of a bound
+// value is validated by Bind.
+func NewQuery(statement string) (*Query, error) {
+	if err := validate(statement); err != nil {
+		return nil, err
+	}
+	q := &Query{statement: statement}
+	seen := make(map[string]bool)
+	err := q.walk(func(tok *token, identifier bool) error {
+		for _, segment := range placeholderSegments(tok, identifier) {
+			if !placeholderPattern.MatchString(segment) {
+				return errors.Errorf("query error: invalid placeholder %s at offset %d", segment, tok.tpos)
+			}
+			name := segment[1:]
+			if !seen[name] {
+				seen[name] = true
+				q.params = append(q.params, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := validateStatement(q.placeholderStatement()); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// placeholderStatement returns the statement of the Query, q, with each
+// placeholder within a path replaced by a path component and any other
+// placeholder replaced by a string literal. The replacements are the same
+// length as the placeholders so offsets within the statement are unchanged.
+func (q *Query) placeholderStatement() string {
+	var b strings.Builder
+	last := 0
+	q.walk(func(tok *token, identifier bool) error {
+		if len(placeholderSegments(tok, identifier)) == 0 {
+			return nil
+		}
+		text := `"` + strings.Repeat("x", len(tok.tliteral)-2) + `"`
+		if identifier {
+			components := strings.Split(tok.tliteral, ".")
+			for i, c := range components {
+				if isPlaceholder(c) {
+					components[i] = strings.Repeat("x", len(c))
+				}
+			}
+			text = strings.Join(components, ".")
+		}
+		b.WriteString(q.statement[last:tok.tpos])
+		b.WriteString(text)
+		last = tok.tpos + len(tok.tliteral)
+		return nil
+	})
+	b.WriteString(q.statement[last:])
+	return b.String()
+}
+
+// walk calls fn with each identifier and literal of the Query, q, reporting
+// whether the token is a path: the identifier of an EVAL expression, the path
+// of a collection expression or the scope of an EACH expression. The path of a
+// collection expression is passed as an identifier token positioned within the
+// statement.
+func (q *Query) walk(fn func(tok *token, identifier bool) error) error {
+	l := newLexer(q.statement)
+	inEval, inPrevious, seenIdentifier, inScope := false, false, false, false
+	for tok := l.nextToken(); tok.ttype != cEOF; tok = l.nextToken() {
+		switch tok.ttype {
+		case cEACH:
+			inScope = true
+		case cEVAL:
+			inEval, seenIdentifier = true, false
+		case cRPAREN:
+			inEval = false
+		case cLBRACKET:
+			inPrevious = true
+		case cRBRACKET:
+			inPrevious = false
+		case cAGGREGATE:
+			if inEval && !inPrevious && !seenIdentifier {
+				seenIdentifier = true
+			}
+			if path := aggregatePath(tok); path != nil {
+				if err := fn(path, true); err != nil {
+					return err
+				}
+			}
+		case cIDENT:
+			// the previous value in square brackets is a literal
+			identifier := (inEval && !inPrevious && !seenIdentifier) || inScope
+			if inEval && identifier {
+				seenIdentifier = true
+			}
+			inScope = false
+			if err := fn(tok, identifier); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// aggregatePath returns the path of the collection expression tok, e.g. Items
+// of LEN(Items), as an identifier token positioned within the statement, or nil
+// if it has none.
+func aggregatePath(tok *token) *token {
+	open := strings.Index(tok.tliteral, "(")
+	if open < 0 {
+		return nil
+	}
+	l := newLexer(tok.tliteral[open:])
+	for t := l.nextToken(); t.ttype != cEOF; t = l.nextToken() {
+		if t.ttype == cIDENT {
+			return &token{ttype: cIDENT, tliteral: t.tliteral, tpos: tok.tpos + open + t.tpos}
+		}
+	}
+	return nil
+}
+
+// placeholderSegments returns the placeholders held by tok. Placeholders of an
+// identifier are components of its path; any other placeholder is the whole
+// token.
+func placeholderSegments(tok *token, identifier bool) []string {
+	if !identifier {
+		if isPlaceholder(tok.tliteral) {
+			return []string{tok.tliteral}
+		}
+		return nil
+	}
+	var segments []string
+	for _, c := range strings.Split(tok.tliteral, ".") {
+		if isPlaceholder(c) {
+			segments = append(segments, c)
+		}
+	}
+	return segments
+}
+
+// isPlaceholder reports whether s is written as a placeholder. The $first and
+// $last modifiers are not placeholders.
+func isPlaceholder(s string) bool {
+	if strings.HasPrefix(s, ":") {
+		return true
+	}
+	return len(s) > 1 && s[0] == '$' && isDigit(rune(s[1]))
+}
+
+// Params returns the names of the placeholders of the Query, q, without their
+// prefix in the order they first appear.
+func (q *Query) Params() []string {
+	return append([]string(nil), q.params...)
+}
+
+// String returns the statement of the Query, q.
+func (q *Query) String() string {
+	return q.statement
+}
+
+// Bind returns the Query with each placeholder replaced by its value in values.
+// Names are given without their prefix, e.g. "target" for :target and "1" for
+// $1. Values are written as literals according to their type: strings,
+// integers, *big.Int, floats, booleans, time.Time, time.Duration and nil. Values bound
+// within a path must be strings or integers consisting of letters, digits,
+// underscores and hyphens. An error is returned if a placeholder is not bound,
+// a value is not a placeholder of the Query or cannot be represented, or the
+// resulting statement is invalid.
+func (q *Query) Bind(values map[string]interface{}) (*Query, error) {
+	bound := make(map[string]interface{}, len(values))
+	for name, v := range values {
+		bound[strings.TrimLeft(name, ":$")] = v
+	}
+	known := make(map[string]bool, len(q.params))
+	for _, name := range q.params {
+		known[name] = true
+		if _, ok := bound[name]; !ok {
+			return nil, errors.Errorf("query error: missing value for %s", name)
+		}
+	}
+	for name := range bound {
+		if !known[name] {
+			return nil, errors.Errorf("query error: unknown placeholder %s", name)
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	err := q.walk(func(tok *token, identifier bool) error {
+		if len(placeholderSegments(tok, identifier)) == 0 {
+			return nil
+		}
+		var text string
+		var err error
+		if identifier {
+			text, err = bindPath(tok.tliteral, bound)
+		} else {
+			text, err = bindLiteral(tok.tliteral[1:], bound[tok.tliteral[1:]])
+		}
+		if err != nil {
+			return err
+		}
+		b.WriteString(q.statement[last:tok.tpos])
+		b.WriteString(text)
+		last = tok.tpos + len(tok.tliteral)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	b.WriteString(q.statement[last:])
+
+	statement := b.String()
+	if err := validateStatement(statement); err != nil {
+		return nil, errors.Wrap(err, "query error: bound statement is invalid")
+	}
+	return &Query{statement: statement}, nil
+}
+
+// Evaluate executes the Query, q, against the Diff, d, in the same manner as
+// EvaluateStatement. An error is returned if a placeholder is not bound.
+func (q *Query) Evaluate(d *Diff) (bool, error) {
+	if len(q.params) > 0 {
+		return false, errors.Errorf("query error: missing value for %s", q.params[0])
+	}
+	return d.EvaluateStatement(q.statement)
+}
+
+// bindPath returns the path with each placeholder component replaced by its
+// value.
+func bindPath(path string, values map[string]interface{}) (string, error) {
+	components := strings.Split(path, ".")
+	for i, c := range components {
+		if !isPlaceholder(c) {
+			continue
+		}
+		v := values[c[1:]]
+		var s string
+		switch rv := reflect.ValueOf(v); rv.Kind() {
+		case reflect.String:
+			s = rv.String()
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			s = strconv.FormatInt(rv.Int(), 10)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			s = strconv.FormatUint(rv.Uint(), 10)
+		default:
+			return "", errors.Errorf("query error: cannot bind %T to path component %s", v, c)
+		}
+		if !segmentPattern.MatchString(s) {
+			return "", errors.Errorf("query error: cannot bind %q to path component %s", s, c)
+		}
+		components[i] = s
+	}
+	return strings.Join(components, "."), nil
+}
+
+// bindLiteral returns the literal representing the value v bound to the
+// placeholder name.
+func bindLiteral(name string, v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "nil", nil
+	case time.Time:
+		return `t"` + t.Format(time.RFC3339Nano) + `"`, nil
+	case time.Duration:
+		return `d"` + t.String() + `"`, nil
+	case *big.Int:
+		if t == nil {
+			return "nil", nil
+		}
+		return t.String(), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return strconv.Quote(rv.String()), nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return cTRUE, nil
+		}
+		return cFALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", errors.Errorf("query error: cannot bind %v to %s", f, name)
+		}
+		s := strconv.FormatFloat(f, 'f', -1, 64)
+		if !strings.Contains(s, ".") {
+			s += ".0"
+		}
+		return s, nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return "nil", nil
+		}
+		return bindLiteral(name, rv.Elem().Interface())
+	}
+	return "", errors.Errorf("query error: cannot bind %T to %s", v, name)
+}
+
+// validateStatement validates statement along with the expression of each EVAL
+// it holds.
+func validateStatement(statement string) error {
+	if err := validate(statement); err != nil {
+		return err
+	}
+	l := newLexer(statement)
+	for tok := l.nextToken(); tok.ttype != cEOF; tok = l.nextToken() {
+		if tok.ttype != cEVAL {
+			continue
+		}
+		var args []*token
+		for arg := l.nextToken(); arg.ttype != cRPAREN && arg.ttype != cEOF; arg = l.nextToken() {
+			if arg.ttype != cLPAREN {
+				args = append(args, arg)
+			}
+		}
+		if err := validateEvalArgs(args); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid EVAL at offset %d", tok.tpos))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package diffq
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewQuery(t *testing.T) {
+	tests := map[string][]string{
+		`EVAL(S => "Done")`:                          nil,
+		`EVAL(S => :target)`:                         {"target"},
+		`AND(EVAL(NTS.:id.NS => $1), EVAL(I => $1))`: {"id", "1"},
+		`EVAL(S [:from] => :to)`:                     {"from", "to"},
+		`EVAL(SS.$last => :v) /* :comment */`:        {"v"},
+		`EACH(NTS.:id, EVAL(.NS => :s))`:             {"id", "s"},
+		`EACH(M.*, EACH(.:k.*, EVAL(. => *)))`:       {"k"},
+		`EVAL(LEN(:p) =GT> 1)`:                       {"p"},
+		`EVAL(COUNT(NTS.:id.*, $created) => $1)`:     {"id", "1"},
+		`EVAL(S =STARTSWITH> :prefix)`:               {"prefix"},
+		`EVAL(S [:from] =GT> :to)`:                   {"from", "to"},
+	}
+	for statement, want := range tests {
+		q, err := NewQuery(statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+			continue
+		}
+		if got := q.Params(); !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect result for %s, got: %v, want: %v", statement, got, want)
+		}
+	}
+
+	for _, statement := range []string{
+		`EVAL(S => :)`,
+		`EVAL(S => :a-b)`,
+		`EVAL(NTS.:1x.NS => *)`,
+		`AND(EVAL(S => :target)`,
+		`EVAL(S => i:s)`,
+		`EVAL(S =GT> *)`,
+		`EVAL(S :v)`,
+		`EVAL(S => :v => :w)`,
+	} {
+		if _, err := NewQuery(statement); err == nil {
+			t.Errorf("expected error for %s", statement)
+		}
+	}
+}
+
+func TestQueryBind(t *testing.T) {
+	tm := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	tests := []struct {
+		statement string
+		values    map[string]interface{}
+		want      string
+	}{
+		{`EVAL(S => :v)`, map[string]interface{}{"v": "Done"}, `EVAL(S => "Done")`},
+		{`EVAL(S => :v)`, map[string]interface{}{":v": `a) OR(TRUE`}, `EVAL(S => "a) OR(TRUE")`},
+		{`EVAL(S => :v)`, map[string]interface{}{"v": "say \"hi\"\n"}, `EVAL(S => "say \"hi\"\n")`},
+		{`EVAL(I => $1)`, map[string]interface{}{"$1": 42}, `EVAL(I => 42)`},
+		{`EVAL(I => $1)`, map[string]interface{}{"1": uint8(7)}, `EVAL(I => 7)`},
+		{`EVAL(F64 => :v)`, map[string]interface{}{"v": 3.5}, `EVAL(F64 => 3.5)`},
+		{`EVAL(F64 => :v)`, map[string]interface{}{"v": 3.0}, `EVAL(F64 => 3.0)`},
+		{`EVAL(B => :v)`, map[string]interface{}{"v": true}, `EVAL(B => TRUE)`},
+		{`EVAL(NTP => :v)`, map[string]interface{}{"v": nil}, `EVAL(NTP => nil)`},
+		{`EVAL(T => :v)`, map[string]interface{}{"v": tm}, `EVAL(T => t"2020-01-02T03:04:05.000000006Z")`},
+		{`EVAL(D => :v)`, map[string]interface{}{"v": time.Hour}, `EVAL(D => d"1h0m0s")`},
+		{`EVAL(NTS.:i.NS => *)`, map[string]interface{}{"i": 2}, `EVAL(NTS.2.NS => *)`},
+		{`EACH(NTS.:i, EVAL(.NS => :s))`, map[string]interface{}{"i": 1, "s": "x"}, `EACH(NTS.1, EVAL(.NS => "x"))`},
+		{`EVAL(M.:k => :k)`, map[string]interface{}{"k": "key"}, `EVAL(M.key => "key")`},
+		{`EVAL(S [:from] => :to)`, map[string]interface{}{"from": "a", "to": "b"}, `EVAL(S ["a"] => "b")`},
+		{`EVAL(:field => *)`, map[string]interface{}{"field": "S"}, `EVAL(S => *)`},
+		{`EVAL(LEN(:p) =GT> 1)`, map[string]interface{}{"p": "SS"}, `EVAL(LEN(SS) =GT> 1)`},
+		{`EVAL(COUNT(NTS.:id.*, $created) => $1)`, map[string]interface{}{"id": 0, "1": 2}, `EVAL(COUNT(NTS.0.*, $created) => 2)`},
+	}
+	for _, test := range tests {
+		q, err := NewQuery(test.statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", test.statement, err)
+			continue
+		}
+		bound, err := q.Bind(test.values)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", test.statement, err)
+			continue
+		}
+		if got := bound.String(); got != test.want {
+			t.Errorf("incorrect result for %s, got: %s, want: %s", test.statement, got, test.want)
+		}
+		if len(bound.Params()) != 0 {
+			t.Errorf("unexpected placeholders for %s: %v", test.statement, bound.Params())
+		}
+	}
+
+	errs := []struct {
+		statement string
+		values    map[string]interface{}
+		want      string
+	}{
+		{`EVAL(S => :v)`, map[string]interface{}{}, "missing value for v"},
+		{`EVAL(S => :v)`, map[string]interface{}{"v": "a", "w": "b"}, "unknown placeholder w"},
+		{`EVAL(S => :v)`, map[string]interface{}{"v": []int{1}}, "cannot bind []int"},
+		{`EVAL(F64 => :v)`, map[string]interface{}{"v": math.NaN()}, "cannot bind NaN to v"},
+		{`EVAL(NTS.:i.NS => *)`, map[string]interface{}{"i": "*"}, `cannot bind "*" to path component :i`},
+		{`EVAL(NTS.:i.NS => *)`, map[string]interface{}{"i": "0.NS"}, `cannot bind "0.NS" to path component :i`},
+		{`EVAL(NTS.:i.NS => *)`, map[string]interface{}{"i": 1.5}, "cannot bind float64 to path component :i"},
+		{`EACH(NTS.:i, EVAL(.NS => *))`, map[string]interface{}{}, "missing value for i"},
+		{`EACH(NTS.:i, EVAL(.NS => *))`, map[string]interface{}{"i": "*"}, `cannot bind "*" to path component :i`},
+	}
+	for _, test := range errs {
+		q, err := NewQuery(test.statement)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", test.statement, err)
+			continue
+		}
+		_, err = q.Bind(test.values)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("incorrect error for %s, got: %v, want: %s", test.statement, err, test.want)
+		}
+	}
+}
+
+func TestQueryEvaluate(t *testing.T) {
+	d, _ := Differential(&OuterType{S: "Draft", I: 1}, &OuterType{S: "Done", I: 2})
+
+	q, err := NewQuery(`AND(EVAL(S => :status), EVAL(I =GT> $1))`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := q.Evaluate(d); err == nil {
+		t.Error("expected error evaluating unbound query")
+	}
+
+	tests := map[string]bool{
+		"Done":    true,
+		"Draft":   false,
+		"a) OR(T": false,
+	}
+	for status, want := range tests {
+		bound, err := q.Bind(map[string]interface{}{"status": status, "1": 1})
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", status, err)
+			continue
+		}
+		result, err := bound.Evaluate(d)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", status, err)
+		}
+		if result != want {
+			t.Errorf("incorrect result for %s, got: %t, want: %t", status, result, want)
+		}
+	}
+}
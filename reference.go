@@ -0,0 +1,134 @@
+package diffq
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reference is a use of a named statement within a statement, written as
+// REF(name).
+type Reference struct {
+	// Name is the name of the referenced statement.
+	Name string
+	// Offset is the byte offset of the name within the statement.
+	Offset int
+}
+
+// References returns the references of statement in the order they appear.
+func References(statement string) []Reference {
+	var refs []Reference
+	l := newLexer(statement)
+	for tok := l.nextToken(); tok.ttype != cEOF; tok = l.nextToken() {
+		if tok.ttype != cREF {
+			continue
+		}
+		if open := l.nextToken(); open.ttype != cLPAREN {
+			continue
+		}
+		if name := l.nextToken(); name.ttype == cIDENT {
+			refs = append(refs, Reference{Name: name.tliteral, Offset: name.tpos})
+		}
+	}
+	return refs
+}
+
+// ReferenceError describes a reference that cannot be resolved because the
+// statement it names is not defined or refers back to itself.
+type ReferenceError struct {
+	// Name is the name of the reference that cannot be resolved.
+	Name string
+	// Offset is the byte offset of the name, within the statement being resolved,
+	// of the reference leading to the error.
+	Offset int
+	// Cycle holds the names of the statements forming a cycle, beginning and
+	// ending with Name; nil when Name is undefined.
+	Cycle []string
+}
+
+// Error returns the message of the ReferenceError, e.
+func (e *ReferenceError) Error() string {
+	if e.Cycle != nil {
+		return fmt.Sprintf("validation error: reference cycle %s", strings.Join(e.Cycle, " -> "))
+	}
+	return fmt.Sprintf("validation error: undefined reference %s", e.Name)
+}
+
+// ResolveReferences returns statement with each REF(name) replaced by the
+// statement named name in fragments, resolving the references of fragments in
+// turn. A *ReferenceError is returned when a name is undefined or fragments
+// refer to one another in a cycle.
+func ResolveReferences(statement string, fragments map[string]string) (string, error) {
+	resolved, err := newReferenceResolver(fragments).resolve(statement, nil)
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+// referenceResolver resolves references against a set of named fragments.
+type referenceResolver struct {
+	fragments map[string]string
+	// resolved caches the resolved form of each fragment.
+	resolved map[string]string
+}
+
+// newReferenceResolver returns a referenceResolver of fragments.
+func newReferenceResolver(fragments map[string]string) *referenceResolver {
+	return &referenceResolver{fragments: fragments, resolved: make(map[string]string)}
+}
+
+// resolve returns statement with its references resolved. active holds the
+// names of the fragments being resolved, outermost first.
+func (r *referenceResolver) resolve(statement string, active []string) (string, *ReferenceError) {
+	var b strings.Builder
+	last := 0
+
+	l := newLexer(statement)
+	for tok := l.nextToken(); tok.ttype != cEOF; tok = l.nextToken() {
+		if tok.ttype != cREF {
+			continue
+		}
+		open, name, close := l.nextToken(), l.nextToken(), l.nextToken()
+		if open.ttype != cLPAREN || name.ttype != cIDENT || close.ttype != cRPAREN {
+			// malformed references are reported by validation
+			continue
+		}
+
+		fragment, err := r.fragment(name.tliteral, active)
+		if err != nil {
+			// report the error at the reference within this statement
+			err.Offset = name.tpos
+			return "", err
+		}
+		b.WriteString(statement[last:tok.tpos])
+		b.WriteString(fragment)
+		last = close.tpos + 1
+	}
+	b.WriteString(statement[last:])
+	return b.String(), nil
+}
+
+// fragment returns the resolved fragment named name. A cycle through name is
+// reported starting from name when active is empty.
+func (r *referenceResolver) fragment(name string, active []string) (string, *ReferenceError) {
+	if resolved, ok := r.resolved[name]; ok {
+		return resolved, nil
+	}
+	for i, a := range active {
+		if a == name {
+			cycle := append(append([]string(nil), active[i:]...), name)
+			return "", &ReferenceError{Name: name, Cycle: cycle}
+		}
+	}
+	fragment, ok := r.fragments[name]
+	if !ok {
+		return "", &ReferenceError{Name: name}
+	}
+
+	resolved, err := r.resolve(strings.TrimSpace(fragment), append(active, name))
+	if err != nil {
+		return "", err
+	}
+	r.resolved[name] = resolved
+	return resolved, nil
+}
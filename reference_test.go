@@ -0,0 +1,58 @@
+package diffq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveReferences(t *testing.T) {
+	fragments := map[string]string{
+		"terminal": `OR(EVAL(S => "Done"), EVAL(S => "Failed"))`,
+		"owned":    `EVAL(I => *)`,
+		"both":     ` AND(REF(terminal), REF(owned)) `,
+		"a":        `REF(b)`,
+		"b":        `OR(REF(c), REF(a))`,
+		"c":        `TRUE`,
+		"broken":   `REF(missing)`,
+	}
+	tests := map[string]string{
+		`EVAL(S => *)`:                   `EVAL(S => *)`,
+		`AND(REF(terminal), REF(owned))`: `AND(OR(EVAL(S => "Done"), EVAL(S => "Failed")), EVAL(I => *))`,
+		`NOT_REF(REF(both))`:             `NOT_REF(AND(OR(EVAL(S => "Done"), EVAL(S => "Failed")), EVAL(I => *)))`,
+		`ref( terminal )`:                `OR(EVAL(S => "Done"), EVAL(S => "Failed"))`,
+	}
+	for statement, want := range tests {
+		got, err := ResolveReferences(statement, fragments)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", statement, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("incorrect result for %s, got: %s, want: %s", statement, got, want)
+		}
+	}
+
+	errs := map[string]ReferenceError{
+		`AND(REF(missing))`: {Name: "missing", Offset: 8},
+		`AND(REF(broken))`:  {Name: "missing", Offset: 8},
+		`OR(TRUE, REF(a))`:  {Name: "a", Offset: 13, Cycle: []string{"a", "b", "a"}},
+	}
+	for statement, want := range errs {
+		_, err := ResolveReferences(statement, fragments)
+		got, ok := err.(*ReferenceError)
+		if !ok || !reflect.DeepEqual(*got, want) {
+			t.Errorf("incorrect error for %s, got: %#v, want: %#v", statement, err, want)
+		}
+	}
+	if _, err := ResolveReferences(`REF(a)`, fragments); err == nil || err.Error() != "validation error: reference cycle a -> b -> a" {
+		t.Errorf("incorrect cycle message, got: %v", err)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	got := References(`AND(REF(a), /* REF(b) */ EVAL(S => "REF(c)"), ref(d))`)
+	want := []Reference{{Name: "a", Offset: 8}, {Name: "d", Offset: 50}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect references, got: %v, want: %v", got, want)
+	}
+}
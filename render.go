@@ -0,0 +1,283 @@
+package diffq
+
+import (
+	"fmt"
+	"html"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// RenderOption configures the rendering of a Diff.
+type RenderOption func(*renderConfig)
+
+// renderConfig holds the options used when rendering a Diff.
+type renderConfig struct {
+	patterns [][]string
+	maxValue int
+}
+
+// WithPathFilter limits the rendered changes to those whose path matches at
+// least one of the patterns. Patterns use the identifier syntax of the query
+// language: components are separated by '.' and '*' matches any component. A
+// pattern matches the path it identifies and any path nested beneath it.
+func WithPathFilter(patterns ...string) RenderOption {
+	return func(c *renderConfig) {
+		for _, p := range patterns {
+			c.patterns = append(c.patterns, strings.Split(p, "."))
+		}
+	}
+}
+
+// WithMaxValueLength truncates rendered values longer than n characters.
+func WithMaxValueLength(n int) RenderOption {
+	return func(c *renderConfig) {
+		c.maxValue = n
+	}
+}
+
+// newRenderConfig applies opts to the default rendering options.
+func newRenderConfig(opts []RenderOption) *renderConfig {
+	c := &renderConfig{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// changes returns the changes of d selected by the path filter.
+func (c *renderConfig) changes(d *Diff) Changes {
+	if len(c.patterns) == 0 {
+		return d.Changes
+	}
+	var selected Changes
+	for _, ch := range d.Changes {
+		for _, p := range c.patterns {
+			if wildcardPathMatch(p, ch.Path) {
+				selected = append(selected, ch)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// value formats v for display truncating it to the configured length.
+func (c *renderConfig) value(v interface{}) string {
+	var s string
+	switch t := v.(type) {
+	case nil:
+		s = "nil"
+	case string:
+		s = strconv.Quote(t)
+	case time.Time:
+		s = t.Format(time.RFC3339Nano)
+	case time.Duration:
+		s = t.String()
+	default:
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() == reflect.Ptr {
+			s = "nil"
+		} else {
+			s = fmt.Sprintf("%+v", rv.Interface())
+		}
+	}
+	if c.maxValue > 0 && utf8.RuneCountInString(s) > c.maxValue {
+		runes := []rune(s)
+		s = string(runes[:c.maxValue]) + "…"
+	}
+	return s
+}
+
+// transition formats the From and To values of the change ch.
+func (c *renderConfig) transition(ch Change) string {
+	switch ch.Type {
+	case ChangeCreate:
+		return "→ " + c.value(ch.To)
+	case ChangeDelete:
+		return c.value(ch.From) + " →"
+	case ChangeMove:
+		return fmt.Sprintf("[%d] → [%d]", ch.FromIndex, ch.ToIndex)
+	}
+	return c.value(ch.From) + " → " + c.value(ch.To)
+}
+
+// changeSymbols maps each change type to the symbol used to mark it in text
+// output.
+var changeSymbols = map[ChangeType]string{
+	ChangeCreate:   "+",
+	ChangeDelete:   "-",
+	ChangeUpdate:   "~",
+	ChangeMove:     ">",
+	ChangeConflict: "!",
+}
+
+// changeColors maps each change type to the ANSI color used to render it.
+var changeColors = map[ChangeType]string{
+	ChangeCreate:   "\x1b[32m",
+	ChangeDelete:   "\x1b[31m",
+	ChangeUpdate:   "\x1b[33m",
+	ChangeMove:     "\x1b[36m",
+	ChangeConflict: "\x1b[35m",
+}
+
+// changeClasses maps each change type to the CSS class used to style it in
+// HTML output.
+var changeClasses = map[ChangeType]string{
+	ChangeCreate:   "create",
+	ChangeDelete:   "delete",
+	ChangeUpdate:   "update",
+	ChangeMove:     "move",
+	ChangeConflict: "conflict",
+}
+
+// changeClass returns the CSS class for the change type t. Types not known to
+// the package, such as those decoded from JSON, use the neutral class
+// "unknown" so they can never inject markup.
+func changeClass(t ChangeType) string {
+	if class, ok := changeClasses[t]; ok {
+		return class
+	}
+	return "unknown"
+}
+
+// RenderText renders the changes of the Diff, d, one per line in the form
+// "Path: From → To" with the paths aligned. Each line is prefixed with a symbol
+// indicating the change type: + create, - delete, ~ update, > move and
+// ! conflict.
+func (d *Diff) RenderText(opts ...RenderOption) string {
+	return d.renderLines(newRenderConfig(opts), false)
+}
+
+// RenderANSI renders the changes of the Diff, d, in the same format as
+// RenderText colored for display in a terminal.
+func (d *Diff) RenderANSI(opts ...RenderOption) string {
+	return d.renderLines(newRenderConfig(opts), true)
+}
+
+// renderLines renders the changes of d one per line optionally using ANSI
+// colors.
+func (d *Diff) renderLines(c *renderConfig, color bool) string {
+	changes := c.changes(d)
+	width := 0
+	for _, ch := range changes {
+		if w := utf8.RuneCountInString(strings.Join(ch.Path, ".")); w > width {
+			width = w
+		}
+	}
+
+	var b strings.Builder
+	for _, ch := range changes {
+		path := strings.Join(ch.Path, ".") + ":"
+		line := fmt.Sprintf("%s %-*s %s", changeSymbols[ch.Type], width+1, path, c.transition(ch))
+		if color {
+			line = changeColors[ch.Type] + line + "\x1b[0m"
+		}
+		b.WriteString(strings.TrimRight(line, " "))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// RenderMarkdown renders the changes of the Diff, d, as a Markdown table
+// suitable for pull request comments.
+func (d *Diff) RenderMarkdown(opts ...RenderOption) string {
+	c := newRenderConfig(opts)
+
+	var b strings.Builder
+	b.WriteString("| Change | Path | From | To |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, ch := range c.changes(d) {
+		from, to := markdownCode(c.value(ch.From)), markdownCode(c.value(ch.To))
+		switch ch.Type {
+		case ChangeCreate:
+			from = ""
+		case ChangeDelete:
+			to = ""
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", ch.Type, markdownCode(strings.Join(ch.Path, ".")), from, to)
+	}
+	return b.String()
+}
+
+// markdownCode formats s as inline code within a Markdown table cell.
+func markdownCode(s string) string {
+	s = strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+// renderNode represents a path component in the tree of changes rendered as
+// HTML.
+type renderNode struct {
+	name     string
+	changes  Changes
+	children []*renderNode
+}
+
+// child returns the child node named name creating it if necessary.
+func (n *renderNode) child(name string) *renderNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	c := &renderNode{name: name}
+	n.children = append(n.children, c)
+	return c
+}
+
+// RenderHTML renders the changes of the Diff, d, as a self-contained HTML
+// document. Changes are grouped by path with each nested level in a collapsible
+// section.
+func (d *Diff) RenderHTML(opts ...RenderOption) string {
+	c := newRenderConfig(opts)
+
+	root := &renderNode{}
+	for _, ch := range c.changes(d) {
+		n := root
+		for _, p := range ch.Path {
+			n = n.child(p)
+		}
+		n.changes = append(n.changes, ch)
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>diffq</title>\n<style>\n")
+	b.WriteString("body { font-family: monospace; }\n")
+	b.WriteString("details { margin-left: 1em; }\n")
+	b.WriteString(".change { margin-left: 2em; }\n")
+	b.WriteString(".create { color: #22863a; }\n.delete { color: #cb2431; }\n.update { color: #b08800; }\n.move { color: #005cc5; }\n.conflict { color: #6f42c1; }\n")
+	b.WriteString("</style>\n</head>\n<body>\n")
+	renderHTMLNode(&b, c, root)
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// renderHTMLNode writes the changes and children of the node n.
+func renderHTMLNode(b *strings.Builder, c *renderConfig, n *renderNode) {
+	for _, ch := range n.changes {
+		fmt.Fprintf(b, "<div class=\"change %s\">%s %s</div>\n", changeClass(ch.Type), html.EscapeString(string(ch.Type)), html.EscapeString(c.transition(ch)))
+	}
+	for _, child := range n.children {
+		if len(child.children) == 0 && len(child.changes) == 1 {
+			ch := child.changes[0]
+			fmt.Fprintf(b, "<div class=\"change %s\"><b>%s</b>: %s</div>\n", changeClass(ch.Type), html.EscapeString(child.name), html.EscapeString(c.transition(ch)))
+			continue
+		}
+		fmt.Fprintf(b, "<details open>\n<summary>%s</summary>\n", html.EscapeString(child.name))
+		renderHTMLNode(b, c, child)
+		b.WriteString("</details>\n")
+	}
+}
@@ -0,0 +1,87 @@
+package diffq
+
+import (
+	"strings"
+	"testing"
+)
+
+func newRenderDiff() *Diff {
+	return NewDiffFromChanges(Changes{
+		{Type: ChangeUpdate, Path: []string{"Status"}, From: "Draft", To: "Done"},
+		{Type: ChangeCreate, Path: []string{"Tags", "1"}, To: "urgent|high"},
+		{Type: ChangeDelete, Path: []string{"Spec", "Owner"}, From: "someone"},
+		{Type: ChangeMove, Path: []string{"Tags", "0"}, From: "urgent", To: "urgent", FromIndex: 2},
+	})
+}
+
+func TestRenderText(t *testing.T) {
+	got := newRenderDiff().RenderText()
+	want := `~ Status:     "Draft" → "Done"
++ Tags.1:     → "urgent|high"
+- Spec.Owner: "someone" →
+> Tags.0:     [2] → [0]
+`
+	if got != want {
+		t.Errorf("incorrect text, got:\n%s\nwant:\n%s", got, want)
+	}
+
+	got = newRenderDiff().RenderText(WithPathFilter("Tags.*"), WithMaxValueLength(4))
+	want = `+ Tags.1: → "urg…
+> Tags.0: [2] → [0]
+`
+	if got != want {
+		t.Errorf("incorrect filtered text, got:\n%s\nwant:\n%s", got, want)
+	}
+
+	ansi := newRenderDiff().RenderANSI(WithPathFilter("Status"))
+	if ansi != "\x1b[33m~ Status: \"Draft\" → \"Done\"\x1b[0m\n" {
+		t.Errorf("incorrect ansi text, got: %q", ansi)
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	got := newRenderDiff().RenderMarkdown(WithPathFilter("Status", "Tags.1"))
+	want := "| Change | Path | From | To |\n" +
+		"| --- | --- | --- | --- |\n" +
+		"| update | `Status` | `\"Draft\"` | `\"Done\"` |\n" +
+		"| create | `Tags.1` |  | `\"urgent\\|high\"` |\n"
+	if got != want {
+		t.Errorf("incorrect markdown, got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	got := newRenderDiff().RenderHTML()
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		"<div class=\"change update\"><b>Status</b>: &#34;Draft&#34; → &#34;Done&#34;</div>",
+		"<details open>\n<summary>Tags</summary>",
+		"<div class=\"change create\"><b>1</b>: → &#34;urgent|high&#34;</div>",
+		"<summary>Spec</summary>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("html missing %q, got:\n%s", want, got)
+		}
+	}
+}
+
+func TestRenderHTMLChangeType(t *testing.T) {
+	hostile := ChangeType(`x"><script>alert(1)</script>`)
+	d := NewDiffFromChanges(Changes{
+		{Type: hostile, Path: []string{"Status"}, From: "a", To: "b"},
+		{Type: hostile, Path: []string{"Tags", "0"}, From: "a", To: "b"},
+		{Type: hostile, Path: []string{"Tags", "0", "Name"}, From: "a", To: "b"},
+	})
+	got := d.RenderHTML()
+	if strings.Contains(got, "<script>") {
+		t.Errorf("html contains unescaped change type, got:\n%s", got)
+	}
+	for _, want := range []string{
+		"<div class=\"change unknown\"><b>Status</b>: &#34;a&#34; → &#34;b&#34;</div>",
+		"<div class=\"change unknown\">x&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt; &#34;a&#34; → &#34;b&#34;</div>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("html missing %q, got:\n%s", want, got)
+		}
+	}
+}
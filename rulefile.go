@@ -0,0 +1,218 @@
+package diffq
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Rule files
+//
+// A rule file holds one or more named statements, each declared with the RULE
+// keyword followed by the name of the rule, an equals sign and the statement:
+//
+//	/* Orders that shipped without a carrier. */
+//	RULE shipped_without_carrier = AND(
+//	    EVAL(Status => "Shipped"),
+//	    EVAL(Carrier =!> *)
+//	)
+//
+// Comments on the lines preceding a declaration document the rule. A file
+// without declarations holds a single unnamed statement.
+//
+// Fragments shared by several rules are declared with the DEFINE keyword in the
+// same manner and referenced by rules, or other fragments, as REF(name):
+//
+//	DEFINE terminal = OR(EVAL(Status => "Done"), EVAL(Status => "Failed"))
+//	RULE finished_unassigned = AND(REF(terminal), EVAL(Owner =!> *))
+
+// Keywords starting the declaration of a named rule and of a fragment in a rule
+// file.
+const (
+	ruleKeyword   = "RULE"
+	defineKeyword = "DEFINE"
+)
+
+// ruleNamePattern matches valid rule names.
+var ruleNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-.]*$`)
+
+// RuleDeclaration is a named statement declared in a rule file.
+type RuleDeclaration struct {
+	// Name is the name of the rule; empty for a file holding a single unnamed
+	// statement.
+	Name string
+	// Define is true for a fragment declared with DEFINE that is referenced by
+	// other statements rather than evaluated itself.
+	Define bool
+	// Doc holds the text of the comments preceding the declaration.
+	Doc string
+	// Statement holds the statement of the rule.
+	Statement string
+	// Start is the byte offset of the declaration, including the RULE or DEFINE
+	// keyword, in the file.
+	Start int
+	// NameOffset is the byte offset of the name of the rule in the file.
+	NameOffset int
+	// Offset and End are the byte offsets of the start and end of the statement
+	// in the file.
+	Offset, End int
+}
+
+// RuleFileError describes an error in the structure of a rule file.
+type RuleFileError struct {
+	// Offset is the byte offset of the error in the file.
+	Offset int
+	// Message describes the error.
+	Message string
+}
+
+// Error returns the message of the RuleFileError, e.
+func (e *RuleFileError) Error() string {
+	return fmt.Sprintf("rule file error: %s at offset %d", e.Message, e.Offset)
+}
+
+// ParseRuleFile parses the declarations of the rule file src. The statements
+// are not validated.
+func ParseRuleFile(src string) ([]RuleDeclaration, error) {
+	var decls []RuleDeclaration
+	var doc []*token
+	depth := 0
+	lastEnd := -1 // end of the last token that is not a comment
+	bare := -1    // offset of a statement preceding any declaration
+
+	l := newLexer(src)
+	for tok := l.nextToken(); tok.ttype != cEOF; tok = l.nextToken() {
+		end := l.position
+		if tok.ttype == cCOMMENT && depth == 0 {
+			// comments on the line following a statement belong to it
+			if lastEnd >= 0 && !strings.Contains(src[lastEnd:tok.tpos], "\n") && len(doc) == 0 {
+				lastEnd = end
+			} else {
+				doc = append(doc, tok)
+			}
+			continue
+		}
+		if tok.ttype == cCOMMENT {
+			continue
+		}
+
+		if depth == 0 && tok.ttype == cIDENT && (tok.tliteral == ruleKeyword || tok.tliteral == defineKeyword) {
+			if bare >= 0 {
+				return nil, &RuleFileError{Offset: bare, Message: "statement outside of a RULE or DEFINE declaration"}
+			}
+			if len(decls) > 0 {
+				decls[len(decls)-1].finish(src, lastEnd)
+			}
+
+			name := l.nextToken()
+			if name.ttype != cIDENT || !ruleNamePattern.MatchString(name.tliteral) {
+				return nil, &RuleFileError{Offset: name.tpos, Message: fmt.Sprintf("invalid rule name %q", name.tliteral)}
+			}
+			for _, d := range decls {
+				if d.Name == name.tliteral {
+					return nil, &RuleFileError{Offset: name.tpos, Message: fmt.Sprintf("rule %s declared more than once", name.tliteral)}
+				}
+			}
+			eq := l.nextToken()
+			if !strings.HasPrefix(eq.tliteral, "=") || eq.ttype != cIDENT {
+				return nil, &RuleFileError{Offset: eq.tpos, Message: fmt.Sprintf("expected = after rule name %s", name.tliteral)}
+			}
+			// the equals sign may be directly followed by the statement
+			l.seek(eq.tpos + 1)
+
+			var docs []string
+			for _, c := range doc {
+				docs = append(docs, strings.TrimSpace(c.tliteral))
+			}
+			decls = append(decls, RuleDeclaration{
+				Name:       name.tliteral,
+				Define:     tok.tliteral == defineKeyword,
+				Doc:        strings.Join(docs, "\n"),
+				Start:      tok.tpos,
+				NameOffset: name.tpos,
+				Offset:     l.position,
+			})
+			doc = nil
+			lastEnd = -1
+			continue
+		}
+
+		if len(decls) == 0 && bare < 0 {
+			bare = tok.tpos
+		}
+		doc = nil
+		switch tok.ttype {
+		case cLPAREN:
+			depth++
+		case cRPAREN:
+			depth--
+		}
+		lastEnd = end
+	}
+
+	if len(decls) == 0 {
+		return []RuleDeclaration{{
+			Statement: strings.TrimSpace(src),
+			Offset:    len(src) - len(strings.TrimLeft(src, " \t\r\n")),
+			End:       len(strings.TrimRight(src, " \t\r\n")),
+		}}, nil
+	}
+	last := &decls[len(decls)-1]
+	last.finish(src, lastEnd)
+	for _, d := range decls {
+		if d.Statement == "" {
+			return nil, &RuleFileError{Offset: d.NameOffset, Message: fmt.Sprintf("rule %s has no statement", d.Name)}
+		}
+	}
+	return decls, nil
+}
+
+// finish sets the statement of the declaration d ending at end.
+func (d *RuleDeclaration) finish(src string, end int) {
+	if end < d.Offset {
+		end = d.Offset
+	}
+	text := src[d.Offset:end]
+	d.Offset += len(text) - len(strings.TrimLeft(text, " \t\r\n"))
+	d.End = end
+	d.Statement = src[d.Offset:d.End]
+}
+
+// FormatRuleFile returns the rule file src with each statement in its canonical
+// form as produced by Format and each declaration written as "RULE name = " or
+// "DEFINE name = ".
+// Comments outside of statements are preserved.
+func FormatRuleFile(src string) (string, error) {
+	decls, err := ParseRuleFile(src)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, d := range decls {
+		formatted, err := Format(d.Statement)
+		if err != nil {
+			if d.Name != "" {
+				return "", errors.Wrapf(err, "rule %s", d.Name)
+			}
+			return "", err
+		}
+		if d.Name != "" {
+			keyword := ruleKeyword
+			if d.Define {
+				keyword = defineKeyword
+			}
+			b.WriteString(src[last:d.Start])
+			b.WriteString(keyword + " " + d.Name + " = ")
+		} else {
+			b.WriteString(src[last:d.Offset])
+		}
+		b.WriteString(formatted)
+		last = d.End
+	}
+	b.WriteString(src[last:])
+	return strings.TrimSpace(b.String()) + "\n", nil
+}
@@ -0,0 +1,113 @@
+package diffq
+
+import (
+	"testing"
+)
+
+func TestParseRuleFile(t *testing.T) {
+	src := `/* Orders that shipped
+   without a carrier. */
+RULE shipped_without_carrier = AND(
+    EVAL(Status => "Shipped"),
+    EVAL(Carrier =!> *)
+) /* trailing */
+
+/* not documentation */
+
+/* Any status change. */
+RULE status-changed =
+    EVAL(Status => *)
+/* end of file */
+`
+	decls, err := ParseRuleFile(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decls) != 2 {
+		t.Fatalf("incorrect number of rules, got: %d, want: %d", len(decls), 2)
+	}
+
+	d := decls[0]
+	if d.Name != "shipped_without_carrier" || d.Doc != "Orders that shipped\n   without a carrier." {
+		t.Errorf("incorrect rule, got: %+v", d)
+	}
+	if d.Statement != "AND(\n    EVAL(Status => \"Shipped\"),\n    EVAL(Carrier =!> *)\n) /* trailing */" {
+		t.Errorf("incorrect statement, got: %q", d.Statement)
+	}
+	if src[d.Offset:d.End] != d.Statement || src[d.NameOffset:d.NameOffset+len(d.Name)] != d.Name || src[d.Start:d.Start+4] != "RULE" {
+		t.Errorf("incorrect offsets, got: %+v", d)
+	}
+
+	d = decls[1]
+	if d.Name != "status-changed" || d.Doc != "not documentation\nAny status change." || d.Statement != "EVAL(Status => *)" {
+		t.Errorf("incorrect rule, got: %+v", d)
+	}
+
+	decls, err = ParseRuleFile("\n  EVAL(A => 1)\n")
+	if err != nil || len(decls) != 1 || decls[0].Name != "" || decls[0].Statement != "EVAL(A => 1)" || decls[0].Offset != 3 {
+		t.Errorf("incorrect unnamed rule, got: %+v, %v", decls, err)
+	}
+
+	for _, src := range []string{
+		"EVAL(A => 1)\nRULE a = EVAL(B => 1)",
+		"RULE a = EVAL(A => 1)\nRULE a = EVAL(B => 1)",
+		"RULE = EVAL(A => 1)",
+		"RULE a EVAL(A => 1)",
+		"RULE a =",
+	} {
+		if _, err := ParseRuleFile(src); err == nil {
+			t.Errorf("expected error for %q", src)
+		} else if _, ok := err.(*RuleFileError); !ok {
+			t.Errorf("incorrect error type for %q, got: %T", src, err)
+		}
+	}
+}
+
+func TestParseRuleFileDefine(t *testing.T) {
+	src := "DEFINE terminal = OR(EVAL(Status => \"Done\"), EVAL(Status => \"Failed\"))\nRULE unowned = AND(REF(terminal), EVAL(Owner =!> *))\n"
+	decls, err := ParseRuleFile(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(decls) != 2 || !decls[0].Define || decls[0].Name != "terminal" || decls[1].Define || decls[1].Statement != "AND(REF(terminal), EVAL(Owner =!> *))" {
+		t.Errorf("incorrect declarations, got: %+v", decls)
+	}
+	if _, err := ParseRuleFile("DEFINE a = TRUE\nRULE a = TRUE"); err == nil {
+		t.Error("expected error for rule and fragment of the same name")
+	}
+}
+
+func TestFormatRuleFile(t *testing.T) {
+	src := `/* shipped */
+RULE   shipped=AND(eval(Status => "Shipped"),EVAL(Carrier =!> *),)
+
+RULE changed =
+  eval(Status => *)
+
+DEFINE   done=eval(Status => "Done")
+`
+	want := `/* shipped */
+RULE shipped = AND(
+    EVAL(Status => "Shipped"),
+    EVAL(Carrier =!> *)
+)
+
+RULE changed = EVAL(Status => *)
+
+DEFINE done = EVAL(Status => "Done")
+`
+	got, err := FormatRuleFile(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("incorrect result, got:\n%s\nwant:\n%s", got, want)
+	}
+	if again, err := FormatRuleFile(got); err != nil || again != got {
+		t.Errorf("format not idempotent, got:\n%s", again)
+	}
+
+	if _, err := FormatRuleFile("RULE a = AND(EVAL(A => 1)"); err == nil {
+		t.Errorf("expected error for invalid statement")
+	}
+}
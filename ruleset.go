@@ -0,0 +1,304 @@
+package diffq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule is a named statement along with metadata describing it.
+type Rule struct {
+	// Name identifies the rule within a RuleSet.
+	Name string `json:"name" yaml:"name"`
+	// Statement holds the statement of the rule.
+	Statement string `json:"statement" yaml:"statement"`
+	// Description documents the rule.
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Severity classifies the rule, e.g. "error" or "warning".
+	Severity string `json:"severity,omitempty" yaml:"severity,omitempty"`
+	// Owner identifies who is responsible for the rule.
+	Owner string `json:"owner,omitempty" yaml:"owner,omitempty"`
+	// Tags holds arbitrary labels of the rule.
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Define marks a fragment that other rules reference with REF(name) but
+	// that is not evaluated itself.
+	Define bool `json:"define,omitempty" yaml:"define,omitempty"`
+}
+
+// Result is the outcome of evaluating a Rule against a Diff.
+type Result struct {
+	// Rule is the rule evaluated.
+	Rule Rule
+	// Matched is true when the statement of the rule holds.
+	Matched bool
+	// Err holds the error encountered evaluating the rule, if any.
+	Err error
+}
+
+// RuleSet is a collection of named rules compiled once when the RuleSet is
+// created so they may be evaluated together against any number of Diffs. A rule
+// may reference any other rule of the RuleSet with REF(name); references are
+// resolved when the RuleSet is created.
+type RuleSet struct {
+	rules []Rule
+	// compiled holds the statement of each rule with its references resolved.
+	compiled []string
+	index    map[string]int
+}
+
+// NewRuleSet returns a RuleSet holding rules in the order given. An error is
+// returned if a name is invalid or repeated, a reference is undefined or cyclic
+// or a statement is invalid.
+func NewRuleSet(rules ...Rule) (*RuleSet, error) {
+	rs := &RuleSet{index: make(map[string]int)}
+	for _, r := range rules {
+		if err := rs.add(r); err != nil {
+			return nil, err
+		}
+	}
+	if err := rs.compile(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// add checks the name and statement of r and appends it to the RuleSet, rs.
+func (rs *RuleSet) add(r Rule) error {
+	if !ruleNamePattern.MatchString(r.Name) {
+		return errors.Errorf("rule set error: invalid rule name %q", r.Name)
+	}
+	if _, ok := rs.index[r.Name]; ok {
+		return errors.Errorf("rule set error: rule %s declared more than once", r.Name)
+	}
+	if strings.TrimSpace(r.Statement) == "" {
+		return errors.Errorf("rule set error: rule %s has no statement", r.Name)
+	}
+	r.Tags = append([]string(nil), r.Tags...)
+	rs.index[r.Name] = len(rs.rules)
+	rs.rules = append(rs.rules, r)
+	return nil
+}
+
+// compile resolves the references of each rule of the RuleSet, rs, and
+// validates the resulting statements.
+func (rs *RuleSet) compile() error {
+	fragments := make(map[string]string, len(rs.rules))
+	for _, r := range rs.rules {
+		fragments[r.Name] = r.Statement
+	}
+	resolver := newReferenceResolver(fragments)
+	rs.compiled = make([]string, len(rs.rules))
+	for i, r := range rs.rules {
+		if err := validate(r.Statement); err != nil {
+			return errors.Wrapf(err, "rule set error: rule %s", r.Name)
+		}
+		resolved, rerr := resolver.fragment(r.Name, nil)
+		if rerr != nil {
+			return errors.Wrapf(rerr, "rule set error: rule %s", r.Name)
+		}
+		if err := validate(resolved); err != nil {
+			return errors.Wrapf(err, "rule set error: rule %s", r.Name)
+		}
+		rs.compiled[i] = resolved
+	}
+	return nil
+}
+
+// ruleSetDocument is the structure of a YAML or JSON rule set file.
+type ruleSetDocument struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// ParseRuleSet returns the RuleSet described by the YAML or JSON document data
+// holding a list of rules:
+//
+//	rules:
+//	  - name: shipped_without_carrier
+//	    statement: AND(EVAL(Status => "Shipped"), EVAL(Carrier =!> *))
+//	    severity: error
+//	    owner: fulfillment
+//	    tags: [orders]
+func ParseRuleSet(data []byte) (*RuleSet, error) {
+	var doc ruleSetDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "rule set error: invalid rule set document")
+	}
+	return NewRuleSet(doc.Rules...)
+}
+
+// LoadRuleSet returns the RuleSet loaded from path. A directory is searched
+// recursively for rule files ending in .dq; a file ending in .dq is read as a
+// rule file and any other file as a YAML or JSON rule set document.
+//
+// The doc comments of a declaration in a rule file describe the rule; lines of
+// the form "severity: error", "owner: fulfillment" or "tags: orders, shipping"
+// set the metadata of the rule. An unnamed statement is named after its file.
+func LoadRuleSet(path string) (*RuleSet, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "rule set error")
+	}
+	if !info.IsDir() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "rule set error")
+		}
+		if filepath.Ext(path) != ".dq" {
+			rs, err := ParseRuleSet(data)
+			return rs, errors.Wrap(err, path)
+		}
+		rules, err := parseRules(path, string(data))
+		if err != nil {
+			return nil, err
+		}
+		rs, err := NewRuleSet(rules...)
+		return rs, errors.Wrap(err, path)
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(p) == ".dq" {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "rule set error")
+	}
+	sort.Strings(files)
+
+	rs := &RuleSet{index: make(map[string]int)}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrap(err, "rule set error")
+		}
+		rules, err := parseRules(file, string(data))
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			if err := rs.add(r); err != nil {
+				return nil, errors.Wrap(err, file)
+			}
+		}
+	}
+	if err := rs.compile(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// parseRules returns the rules declared in the rule file src read from path.
+func parseRules(path, src string) ([]Rule, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	decls, err := ParseRuleFile(src)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	var rules []Rule
+	for _, d := range decls {
+		r := Rule{Name: d.Name, Statement: d.Statement, Define: d.Define}
+		if r.Name == "" {
+			r.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		var description []string
+		for _, line := range strings.Split(d.Doc, "\n") {
+			key, value := splitMetadata(line)
+			switch key {
+			case "severity":
+				r.Severity = value
+			case "owner":
+				r.Owner = value
+			case "tags":
+				for _, tag := range strings.Split(value, ",") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						r.Tags = append(r.Tags, tag)
+					}
+				}
+			default:
+				if line = strings.TrimSpace(line); line != "" {
+					description = append(description, line)
+				}
+			}
+		}
+		r.Description = strings.Join(description, "\n")
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// splitMetadata splits a line of a doc comment of the form "key: value"
+// returning an empty key when the line is not metadata.
+func splitMetadata(line string) (string, string) {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return "", ""
+	}
+	key := strings.ToLower(strings.TrimSpace(line[:i]))
+	switch key {
+	case "severity", "owner", "tags":
+		return key, strings.TrimSpace(line[i+1:])
+	}
+	return "", ""
+}
+
+// Rules returns the rules of the RuleSet, rs, in order including fragments.
+func (rs *RuleSet) Rules() []Rule {
+	return append([]Rule(nil), rs.rules...)
+}
+
+// Rule returns the rule named name and true if it exists.
+func (rs *RuleSet) Rule(name string) (Rule, bool) {
+	i, ok := rs.index[name]
+	if !ok {
+		return Rule{}, false
+	}
+	return rs.rules[i], true
+}
+
+// Len returns the number of rules in the RuleSet, rs, including fragments.
+func (rs *RuleSet) Len() int {
+	return len(rs.rules)
+}
+
+// Evaluate evaluates every rule of the RuleSet, rs, other than fragments
+// against the Diff, d, returning the Result of each rule by name. The rules are
+// not validated again.
+func (rs *RuleSet) Evaluate(d *Diff) map[string]Result {
+	results := make(map[string]Result, len(rs.rules))
+	for i, r := range rs.rules {
+		if r.Define {
+			continue
+		}
+		matched, err := evaluate(rs.compiled[i], d)
+		if err != nil {
+			err = errors.Wrapf(err, "error: failed to evaluate rule %s", r.Name)
+		}
+		results[r.Name] = Result{Rule: r, Matched: matched && err == nil, Err: err}
+	}
+	return results
+}
+
+// Matching returns the names of the rules of the RuleSet, rs, that hold for the
+// Diff, d, in order. Rules that fail to evaluate do not match.
+func (rs *RuleSet) Matching(d *Diff) []string {
+	results := rs.Evaluate(d)
+	var names []string
+	for _, r := range rs.rules {
+		if results[r.Name].Matched {
+			names = append(names, r.Name)
+		}
+	}
+	return names
+}
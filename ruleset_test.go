@@ -0,0 +1,206 @@
+package diffq
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRuleSet(t *testing.T) {
+	rs, err := NewRuleSet(
+		Rule{Name: "s_changed", Statement: `EVAL(S => *)`, Severity: "warning", Owner: "team-a", Tags: []string{"a"}},
+		Rule{Name: "i_two", Statement: `EVAL(I => 2)`},
+		Rule{Name: "b_changed", Statement: `EVAL(B => *)`},
+		Rule{Name: "ss_created", Statement: `EVAL(SS.* => $created)`},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, err := Differential(OuterType{S: "a", I: 1}, OuterType{S: "b", I: 2, SS: []string{"x"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := rs.Evaluate(d)
+	tests := map[string]bool{
+		"s_changed":  true,
+		"i_two":      true,
+		"b_changed":  false,
+		"ss_created": true,
+	}
+	for name, want := range tests {
+		r, ok := results[name]
+		if !ok {
+			t.Fatalf("missing result for %s", name)
+		}
+		if r.Matched != want || r.Err != nil {
+			t.Errorf("incorrect result for %s, got: %t, want: %t; %v", name, r.Matched, want, r.Err)
+		}
+		if r.Rule.Name != name {
+			t.Errorf("incorrect rule for %s, got: %s", name, r.Rule.Name)
+		}
+	}
+	if r := results["s_changed"].Rule; r.Severity != "warning" || r.Owner != "team-a" || !reflect.DeepEqual(r.Tags, []string{"a"}) {
+		t.Errorf("incorrect metadata, got: %+v", r)
+	}
+
+	want := []string{"s_changed", "i_two", "ss_created"}
+	if got := rs.Matching(d); !reflect.DeepEqual(got, want) {
+		t.Errorf("incorrect matching rules, got: %v, want: %v", got, want)
+	}
+	if rs.Len() != 4 {
+		t.Errorf("incorrect length, got: %d, want: %d", rs.Len(), 4)
+	}
+	if _, ok := rs.Rule("i_two"); !ok {
+		t.Error("expected rule i_two")
+	}
+	if _, ok := rs.Rule("missing"); ok {
+		t.Error("unexpected rule missing")
+	}
+}
+
+func TestNewRuleSetErrors(t *testing.T) {
+	tests := map[string][]Rule{
+		"invalid rule name":         {{Name: "1st", Statement: "TRUE"}},
+		"declared more than once":   {{Name: "a", Statement: "TRUE"}, {Name: "a", Statement: "FALSE"}},
+		"has no statement":          {{Name: "a", Statement: " "}},
+		"rule set error: rule bad:": {{Name: "bad", Statement: "AND(EVAL(A => 1)"}},
+	}
+	for want, rules := range tests {
+		_, err := NewRuleSet(rules...)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("incorrect error for %v, got: %v, want: %s", rules, err, want)
+		}
+	}
+}
+
+func TestRuleSetReferences(t *testing.T) {
+	rs, err := NewRuleSet(
+		Rule{Name: "i_changed", Statement: `AND(REF(i_up), EVAL(S => *))`},
+		Rule{Name: "i_up", Statement: `EVAL(I =GT> 1)`, Define: true},
+		Rule{Name: "s_or_i", Statement: `OR(REF(i_changed), REF(i_up))`},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	d, _ := Differential(OuterType{S: "a", I: 1}, OuterType{S: "b", I: 2})
+	results := rs.Evaluate(d)
+	if _, ok := results["i_up"]; ok {
+		t.Error("unexpected result for fragment i_up")
+	}
+	if want := []string{"i_changed", "s_or_i"}; !reflect.DeepEqual(rs.Matching(d), want) {
+		t.Errorf("incorrect matching rules, got: %v, want: %v", rs.Matching(d), want)
+	}
+	if r, _ := rs.Rule("i_changed"); r.Statement != `AND(REF(i_up), EVAL(S => *))` {
+		t.Errorf("incorrect statement, got: %s", r.Statement)
+	}
+
+	tests := map[string][]Rule{
+		"undefined reference missing":   {{Name: "a", Statement: "REF(missing)"}},
+		"reference cycle a -> b -> a":   {{Name: "a", Statement: "AND(REF(b))", Define: true}, {Name: "b", Statement: "OR(REF(a))"}},
+		"rule a: validation error":      {{Name: "a", Statement: "AND(REF(b)"}, {Name: "b", Statement: "TRUE"}},
+		"rule b: validation error: mis": {{Name: "a", Statement: "TRUE", Define: true}, {Name: "b", Statement: "AND(REF(a)))"}},
+	}
+	for want, rules := range tests {
+		_, err := NewRuleSet(rules...)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("incorrect error for %v, got: %v, want: %s", rules, err, want)
+		}
+	}
+}
+
+func TestLoadRuleSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diffq-rules")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"rules.yaml": `
+rules:
+  - name: s_changed
+    statement: EVAL(S => *)
+    severity: error
+    owner: team-a
+    tags: [a, b]
+  - name: i_two
+    statement: EVAL(I => 2)
+`,
+		"rules.json": `{"rules": [{"name": "s_changed", "statement": "EVAL(S => *)", "tags": ["a", "b"], "severity": "error", "owner": "team-a"}]}`,
+		"dir/s.dq": `/*
+  S changes to any value.
+  severity: error
+  owner: team-a
+  tags: a, b
+*/
+RULE s_changed = EVAL(S => *)
+`,
+		"dir/nested/i_two.dq": "EVAL(I => 2)\n",
+		"dir/empty.dq":        "",
+		"invalid.yaml":        "rules:\n  - name: bad\n    statement: EVAL(\n",
+		"invalid/bad.dq":      "RULE bad = AND(EVAL(A => 1)\n",
+		"duplicate/a.dq":      "RULE a = TRUE\n",
+		"duplicate/b.dq":      "RULE a = FALSE\n",
+		"refs/defs.dq":        "DEFINE i_two = EVAL(I => 2)\n",
+		"refs/rules.dq":       "RULE i_changed = AND(REF(i_two))\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	want := Rule{Name: "s_changed", Statement: "EVAL(S => *)", Severity: "error", Owner: "team-a", Tags: []string{"a", "b"}}
+	tests := map[string][]string{
+		"rules.yaml": {"s_changed", "i_two"},
+		"rules.json": {"s_changed"},
+		"dir":        {"i_two", "s_changed"},
+	}
+	for name, names := range tests {
+		rs, err := LoadRuleSet(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("unexpected error loading %s: %v", name, err)
+		}
+		var got []string
+		for _, r := range rs.Rules() {
+			got = append(got, r.Name)
+		}
+		if !reflect.DeepEqual(got, names) {
+			t.Errorf("incorrect rules for %s, got: %v, want: %v", name, got, names)
+		}
+		r, _ := rs.Rule("s_changed")
+		r.Description = ""
+		if !reflect.DeepEqual(r, want) {
+			t.Errorf("incorrect rule for %s, got: %+v, want: %+v", name, r, want)
+		}
+	}
+	rs, _ := LoadRuleSet(filepath.Join(dir, "dir"))
+	if r, _ := rs.Rule("s_changed"); r.Description != "S changes to any value." {
+		t.Errorf("incorrect description, got: %q", r.Description)
+	}
+
+	rs, err = LoadRuleSet(filepath.Join(dir, "refs"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if r, _ := rs.Rule("i_two"); !r.Define {
+		t.Errorf("incorrect fragment, got: %+v", r)
+	}
+	d, _ := Differential(OuterType{I: 1}, OuterType{I: 2})
+	if got := rs.Matching(d); !reflect.DeepEqual(got, []string{"i_changed"}) {
+		t.Errorf("incorrect matching rules, got: %v", got)
+	}
+
+	for _, name := range []string{"invalid.yaml", "invalid", "duplicate", "missing"} {
+		if _, err := LoadRuleSet(filepath.Join(dir, name)); err == nil {
+			t.Errorf("expected error loading %s", name)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package diffq
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schema describes the structure of the values statements are evaluated
+// against. A Schema is used to check the paths of a statement and to offer the
+// paths that may be used.
+type Schema struct {
+	root *shape
+}
+
+// NewSchema returns the Schema of the type of v where v is a value or a
+// reflect.Type. Struct fields are named by their path component as produced by
+// Differential; fields of type interface{} may hold any value.
+func NewSchema(v interface{}) *Schema {
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	return &Schema{root: shapeOfType(t)}
+}
+
+// Children returns the path components that may follow path in sorted order.
+// Struct fields are returned by name and the elements of slices as the *
+// wildcard and the $first and $last modifiers. An empty path returns the
+// components at the root.
+func (s *Schema) Children(path string) []string {
+	r := s.lookup(path)
+	if r.shape == nil || !r.known {
+		return nil
+	}
+	switch r.shape.kind {
+	case shapeStruct:
+		var names []string
+		for name := range r.shape.fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names
+	case shapeSlice:
+		return []string{"$first", "$last", "*"}
+	case shapeMap:
+		return []string{"*"}
+	}
+	return nil
+}
+
+// Describe returns a description of the value identified by path and true if
+// the path exists.
+func (s *Schema) Describe(path string) (string, bool) {
+	r := s.lookup(path)
+	if r.shape == nil {
+		return "", false
+	}
+	if !r.known {
+		return "any", true
+	}
+	if r.shape.doc == "" {
+		return r.shape.typeName, true
+	}
+	return r.shape.typeName + ": " + r.shape.doc, true
+}
+
+// lookup resolves path against the root of the Schema, s.
+func (s *Schema) lookup(path string) shapePath {
+	if path == "" {
+		return shapePath{shape: s.root, known: s.root.kind != shapeAny, invalid: -1}
+	}
+	return s.root.resolve(strings.Split(path, "."))
+}
+
+// shapeKind classifies the values described by a shape.
+type shapeKind int
+
+const (
+	// shapeAny describes a value whose structure is not known statically.
+	shapeAny shapeKind = iota
+	// shapeScalar describes a value without nested values.
+	shapeScalar
+	// shapeStruct describes a value with a fixed set of named fields.
+	shapeStruct
+	// shapeMap describes a value with arbitrary keys of a single element shape.
+	shapeMap
+	// shapeSlice describes an ordered collection of a single element shape.
+	shapeSlice
+)
+
+// shape describes the structure of the values a statement is evaluated against
+// so that the paths used by a statement can be checked statically.
+type shape struct {
+	kind shapeKind
+	// fields holds the shape of each field of a struct by path component.
+	fields map[string]*shape
+	// elem holds the shape of the elements of a map or slice.
+	elem *shape
+	// typeName names the type of the value.
+	typeName string
+	// doc holds a description of the value.
+	doc string
+}
+
+// shapeOfType returns the shape of values of type t. Struct fields are named by
+// their path component as produced by Differential.
+func shapeOfType(t reflect.Type) *shape {
+	return shapeOfTypeMemo(t, make(map[reflect.Type]*shape))
+}
+
+// shapeOfTypeMemo returns the shape of t reusing the shapes in seen so that
+// recursive types terminate.
+func shapeOfTypeMemo(t reflect.Type, seen map[reflect.Type]*shape) *shape {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return &shape{kind: shapeAny}
+	}
+	if s, ok := seen[t]; ok {
+		return s
+	}
+
+	s := &shape{typeName: t.String()}
+	seen[t] = s
+	switch t.Kind() {
+	case reflect.Interface:
+		s.kind = shapeAny
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			s.kind = shapeScalar
+			break
+		}
+		s.kind = shapeStruct
+		s.fields = make(map[string]*shape)
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldPathName(t.Field(i))
+			if !ok {
+				continue
+			}
+			s.fields[name] = shapeOfTypeMemo(t.Field(i).Type, seen)
+		}
+	case reflect.Map:
+		s.kind = shapeMap
+		s.elem = shapeOfTypeMemo(t.Elem(), seen)
+	case reflect.Slice, reflect.Array:
+		s.kind = shapeSlice
+		s.elem = shapeOfTypeMemo(t.Elem(), seen)
+	default:
+		s.kind = shapeScalar
+	}
+	return s
+}
+
+// shapePath describes the result of resolving a path against a shape.
+type shapePath struct {
+	// shape is the shape of the value identified by the path or nil if the path
+	// does not exist.
+	shape *shape
+	// known is false when the path passes through a value of unknown shape.
+	known bool
+	// inElement is true when the path identifies a value within an element of a
+	// map or slice.
+	inElement bool
+	// inSliceElement is true when the path identifies a value within an element
+	// of a slice.
+	inSliceElement bool
+	// invalid holds the index of the first path component that does not exist.
+	invalid int
+}
+
+// resolve resolves the components of path against the shape s. Components of
+// slices may be indexes, identifiers, wildcards or the $first and $last
+// modifiers; components of maps may be any key.
+func (s *shape) resolve(path []string) shapePath {
+	r := shapePath{shape: s, known: true, invalid: -1}
+	for i, c := range path {
+		cur := r.shape
+		switch cur.kind {
+		case shapeAny:
+			r.known = false
+			return r
+		case shapeStruct:
+			if c == "*" {
+				// a wildcard may select any field; the result is not known
+				r.known = false
+				return r
+			}
+			f, ok := cur.fields[c]
+			if !ok {
+				r.shape = nil
+				r.invalid = i
+				return r
+			}
+			r.shape = f
+		case shapeMap:
+			r.shape = cur.elem
+			r.inElement = true
+		case shapeSlice:
+			r.shape = cur.elem
+			r.inElement = true
+			r.inSliceElement = true
+		default:
+			r.shape = nil
+			r.invalid = i
+			return r
+		}
+	}
+	return r
+}
+
+// containsCollection reports whether a map or slice, or only a slice when
+// slicesOnly is true, is reachable from the shape s. Shapes of unknown structure
+// may contain collections.
+func (s *shape) containsCollection(slicesOnly bool) bool {
+	return s.reaches(func(n *shape) bool {
+		return n.kind == shapeAny || n.kind == shapeSlice || (!slicesOnly && n.kind == shapeMap)
+	}, make(map[*shape]bool))
+}
+
+// reaches reports whether match holds for s or any shape nested within it.
+func (s *shape) reaches(match func(*shape) bool, seen map[*shape]bool) bool {
+	if s == nil || seen[s] {
+		return false
+	}
+	seen[s] = true
+	if match(s) {
+		return true
+	}
+	for _, f := range s.fields {
+		if f.reaches(match, seen) {
+			return true
+		}
+	}
+	return s.elem.reaches(match, seen)
+}
+
+// jsonSchema is the subset of a JSON Schema document used to build a Schema.
+type jsonSchema struct {
+	Type                 interface{}            `json:"type"`
+	Description          string                 `json:"description"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Items                json.RawMessage        `json:"items"`
+	Ref                  string                 `json:"$ref"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+	AllOf                []*jsonSchema          `json:"allOf"`
+}
+
+// ParseJSONSchema returns the Schema described by the JSON Schema document
+// data. Objects with properties are treated as closed; objects with only
+// additionalProperties are treated as maps. References to the definitions of
+// the document are followed and allOf is merged; any other combination of
+// schemas may hold any value.
+func ParseJSONSchema(data []byte) (*Schema, error) {
+	var root jsonSchema
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, errors.Wrap(err, "schema error: invalid JSON Schema")
+	}
+	c := &jsonSchemaConverter{root: &root, seen: make(map[*jsonSchema]*shape)}
+	s, err := c.convert(&root)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: s}, nil
+}
+
+// jsonSchemaConverter converts a JSON Schema document into shapes.
+type jsonSchemaConverter struct {
+	root *jsonSchema
+	seen map[*jsonSchema]*shape
+}
+
+// convert returns the shape described by js.
+func (c *jsonSchemaConverter) convert(js *jsonSchema) (*shape, error) {
+	if js == nil {
+		return &shape{kind: shapeAny, typeName: "any"}, nil
+	}
+	if s, ok := c.seen[js]; ok {
+		return s, nil
+	}
+
+	if js.Ref != "" {
+		target, err := c.resolve(js.Ref)
+		if err != nil {
+			return nil, err
+		}
+		// a reference cycle without an intervening schema may hold any value
+		c.seen[js] = &shape{kind: shapeAny, typeName: "any"}
+		s, err := c.convert(target)
+		if err != nil {
+			return nil, err
+		}
+		c.seen[js] = s
+		return s, nil
+	}
+
+	s := &shape{doc: js.Description}
+	c.seen[js] = s
+
+	if len(js.AllOf) > 0 {
+		s.kind = shapeStruct
+		s.typeName = "object"
+		s.fields = make(map[string]*shape)
+		for _, part := range js.AllOf {
+			ps, err := c.convert(part)
+			if err != nil {
+				return nil, err
+			}
+			if ps.kind != shapeStruct {
+				s.kind, s.fields = shapeAny, nil
+				s.typeName = "any"
+				return s, nil
+			}
+			for name, f := range ps.fields {
+				s.fields[name] = f
+			}
+		}
+		return s, c.properties(s, js)
+	}
+
+	typ := jsonSchemaType(js)
+	s.typeName = typ
+	switch typ {
+	case "object":
+		if len(js.Properties) > 0 {
+			s.kind = shapeStruct
+			s.fields = make(map[string]*shape)
+			return s, c.properties(s, js)
+		}
+		s.kind = shapeMap
+		elem, err := c.subschema(js.AdditionalProperties)
+		if err != nil {
+			return nil, err
+		}
+		s.elem = elem
+	case "array":
+		s.kind = shapeSlice
+		elem, err := c.subschema(js.Items)
+		if err != nil {
+			return nil, err
+		}
+		s.elem = elem
+	case "string", "number", "integer", "boolean", "null":
+		s.kind = shapeScalar
+	default:
+		s.kind = shapeAny
+		s.typeName = "any"
+	}
+	return s, nil
+}
+
+// properties adds the properties of js to the fields of s.
+func (c *jsonSchemaConverter) properties(s *shape, js *jsonSchema) error {
+	for name, p := range js.Properties {
+		f, err := c.convert(p)
+		if err != nil {
+			return err
+		}
+		s.fields[name] = f
+	}
+	return nil
+}
+
+// subschema converts the schema held by the items or additionalProperties
+// keyword raw. A boolean or a list of schemas may hold any value.
+func (c *jsonSchemaConverter) subschema(raw json.RawMessage) (*shape, error) {
+	var js *jsonSchema
+	if len(raw) > 0 && raw[0] == '{' {
+		if err := json.Unmarshal(raw, &js); err != nil {
+			return nil, errors.Wrap(err, "schema error: invalid JSON Schema")
+		}
+	}
+	return c.convert(js)
+}
+
+// resolve returns the schema identified by the reference ref which must refer
+// to the definitions of the document.
+func (c *jsonSchemaConverter) resolve(ref string) (*jsonSchema, error) {
+	var defs map[string]*jsonSchema
+	var name string
+	switch {
+	case strings.HasPrefix(ref, "#/definitions/"):
+		defs, name = c.root.Definitions, strings.TrimPrefix(ref, "#/definitions/")
+	case strings.HasPrefix(ref, "#/$defs/"):
+		defs, name = c.root.Defs, strings.TrimPrefix(ref, "#/$defs/")
+	case ref == "#":
+		return c.root, nil
+	default:
+		return nil, errors.Errorf("schema error: unsupported reference %s", ref)
+	}
+	target, ok := defs[name]
+	if !ok {
+		return nil, errors.Errorf("schema error: undefined reference %s", ref)
+	}
+	return target, nil
+}
+
+// jsonSchemaType returns the type of the values described by js. A list of types
+// uses the first type other than null; a schema without a type is inferred from
+// its keywords.
+func jsonSchemaType(js *jsonSchema) string {
+	switch t := js.Type.(type) {
+	case string:
+		return t
+	case []interface{}:
+		for _, e := range t {
+			if s, ok := e.(string); ok && s != "null" {
+				return s
+			}
+		}
+	}
+	if len(js.Properties) > 0 || len(js.AdditionalProperties) > 0 {
+		return "object"
+	}
+	if len(js.Items) > 0 {
+		return "array"
+	}
+	return ""
+}
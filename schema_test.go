@@ -0,0 +1,108 @@
+package diffq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	type Item struct {
+		Name  string
+		Price int `diff:"cost"`
+		skip  bool
+	}
+	type Order struct {
+		Status string
+		Items  []Item
+		Labels map[string]string
+		Next   *Order
+		Extra  interface{}
+	}
+	s := NewSchema(&Order{})
+
+	tests := map[string][]string{
+		"":            {"Extra", "Items", "Labels", "Next", "Status"},
+		"Items":       {"$first", "$last", "*"},
+		"Items.0":     {"Name", "cost"},
+		"Items.$last": {"Name", "cost"},
+		"Labels":      {"*"},
+		"Next.Next":   {"Extra", "Items", "Labels", "Next", "Status"},
+		"Status":      nil,
+		"Extra":       nil,
+		"Missing":     nil,
+	}
+	for path, want := range tests {
+		if got := s.Children(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect children for %q, got: %v, want: %v", path, got, want)
+		}
+	}
+
+	if desc, ok := s.Describe("Items.*.cost"); !ok || desc != "int" {
+		t.Errorf("incorrect description, got: %q %t", desc, ok)
+	}
+	if desc, ok := s.Describe("Extra.Anything"); !ok || desc != "any" {
+		t.Errorf("incorrect description, got: %q %t", desc, ok)
+	}
+	if _, ok := s.Describe("Items.*.Missing"); ok {
+		t.Errorf("expected missing path")
+	}
+}
+
+func TestParseJSONSchema(t *testing.T) {
+	s, err := ParseJSONSchema([]byte(`{
+		"type": "object",
+		"properties": {
+			"status": {"type": "string", "description": "Lifecycle state."},
+			"items": {"type": "array", "items": {"$ref": "#/definitions/item"}},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"parent": {"$ref": "#"},
+			"meta": {"allOf": [
+				{"properties": {"a": {"type": "integer"}}},
+				{"properties": {"b": {"type": ["null", "boolean"]}}}
+			]},
+			"any": {}
+		},
+		"definitions": {
+			"item": {"type": "object", "properties": {"sku": {"type": "string"}, "qty": {"type": "integer"}}}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := map[string][]string{
+		"":              {"any", "items", "labels", "meta", "parent", "status"},
+		"items":         {"$first", "$last", "*"},
+		"items.*":       {"qty", "sku"},
+		"labels":        {"*"},
+		"meta":          {"a", "b"},
+		"parent.parent": {"any", "items", "labels", "meta", "parent", "status"},
+		"any":           nil,
+	}
+	for path, want := range tests {
+		if got := s.Children(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect children for %q, got: %v, want: %v", path, got, want)
+		}
+	}
+	if desc, _ := s.Describe("status"); desc != "string: Lifecycle state." {
+		t.Errorf("incorrect description, got: %q", desc)
+	}
+	if desc, _ := s.Describe("meta.b"); desc != "boolean" {
+		t.Errorf("incorrect description, got: %q", desc)
+	}
+
+	d := Lint(`AND(EVAL(status => $created), EVAL(items.*.sku => $created), EVAL(items.*.price => 1))`, WithLintSchema(s))
+	var rules []string
+	for _, diag := range d {
+		rules = append(rules, diag.Rule)
+	}
+	if want := []string{LintNonCollection, LintUnknownPath}; !reflect.DeepEqual(rules, want) {
+		t.Errorf("incorrect diagnostics, got: %v, want: %v", rules, want)
+	}
+
+	for _, doc := range []string{`{`, `{"$ref": "#/definitions/missing"}`, `{"$ref": "other.json"}`} {
+		if _, err := ParseJSONSchema([]byte(doc)); err == nil {
+			t.Errorf("expected error for %s", doc)
+		}
+	}
+}
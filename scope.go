@@ -0,0 +1,269 @@
+package diffq
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// An EACH expression binds the wildcards of a path, its scope, once for each
+// element the path identifies and evaluates a statement in which relative
+// paths, those starting with '.', are resolved against the element:
+//
+//	EACH(Orders.*, AND(EVAL(.Status => "Shipped"), EVAL(.Carrier => *)))
+//
+// The expression holds when the statement holds for at least one element.
+
+// isRelativePath reports whether the identifier path is relative to the scope
+// of an enclosing EACH expression.
+func isRelativePath(path string) bool {
+	return strings.HasPrefix(path, ".")
+}
+
+// bindRelativePath resolves the relative identifier path against the path of
+// an enclosing scope as written in a statement.
+func bindRelativePath(path, binding string) string {
+	if path == "." {
+		return binding
+	}
+	return binding + path
+}
+
+// scopeLexer reads the tokens of a statement skipping comments.
+type scopeLexer struct {
+	*lexer
+}
+
+// next returns the next token that is not a comment.
+func (l scopeLexer) next() *token {
+	tok := l.nextToken()
+	for tok.ttype == cCOMMENT {
+		tok = l.nextToken()
+	}
+	return tok
+}
+
+// skipGroup advances the lexer past the ')' closing a '(' that has been read
+// returning the ')' token, or an EOF token if there is none, along with the
+// token preceding it.
+func (l scopeLexer) skipGroup() (*token, *token) {
+	depth := 1
+	var prev *token
+	for {
+		tok := l.next()
+		switch tok.ttype {
+		case cLPAREN:
+			depth++
+		case cRPAREN:
+			depth--
+			if depth == 0 {
+				return tok, prev
+			}
+		case cEOF:
+			return tok, prev
+		}
+		prev = tok
+	}
+}
+
+// validateScope ensures that the tokens read by the lexer l following EACH, e,
+// are a scope and a single statement, e.g. EACH(Orders.*, EVAL(...)). The lexer
+// is a copy so the tokens are read again by validate.
+func validateScope(e *token, l lexer) error {
+	s := scopeLexer{&l}
+	invalid := errors.Errorf("validation error: expected EACH(path, statement) at offset %d", e.tpos)
+	if s.next().ttype != cLPAREN || s.next().ttype != cIDENT || s.next().ttype != cCOMMA {
+		return invalid
+	}
+	tok := s.next()
+	switch {
+	case tok.ttype == cTRUE || tok.ttype == cFALSE:
+	case isOperation(tok.ttype) || tok.ttype == cREF || tok.ttype == cEACH:
+		if s.next().ttype != cLPAREN {
+			return invalid
+		}
+		if close, _ := s.skipGroup(); close.ttype != cRPAREN {
+			return invalid
+		}
+	default:
+		return invalid
+	}
+	if tok = s.next(); tok.ttype == cCOMMA {
+		tok = s.next()
+	}
+	if tok.ttype != cRPAREN {
+		return invalid
+	}
+	return nil
+}
+
+// evaluateEach evaluates the EACH expression e against the Diff, d, reading
+// the tokens that follow it in statement from l up to and including the ')'
+// closing it. If trace is not nil a step for the expression, at the nesting
+// depth given, is appended followed by the steps of the statement for each
+// element evaluated. The scope of an EACH may only be relative when d is bound
+// to the element of an enclosing scope.
+func (d *Diff) evaluateEach(statement string, e *token, l *lexer, depth int, trace *[]TraceStep) (bool, error) {
+	s := scopeLexer{l}
+	open, scope, comma := s.next(), s.next(), s.next()
+	if open.ttype != cLPAREN || scope.ttype != cIDENT || comma.ttype != cCOMMA {
+		return false, errors.Errorf("validation error: expected EACH(path, statement) at offset %d", e.tpos)
+	}
+	if isRelativePath(scope.tliteral) && d.binding == nil {
+		return false, errors.Errorf("validation error: relative path %s outside of EACH at offset %d", scope.tliteral, scope.tpos)
+	}
+	close, prev := s.skipGroup()
+	if close.ttype != cRPAREN {
+		return false, errors.New("validation error: mismatched parentheses")
+	}
+	end := close.tpos
+	if prev != nil && prev.ttype == cCOMMA {
+		end = prev.tpos
+	}
+
+	var steps *[]TraceStep
+	if trace != nil {
+		steps = &[]TraceStep{}
+	}
+	result, err := d.evaluateScope(scope.tliteral, statement[comma.tpos+1:end], steps)
+	if err != nil {
+		return false, err
+	}
+
+	if trace != nil {
+		*trace = append(*trace, TraceStep{
+			Depth:      depth,
+			Operation:  e.tliteral,
+			Expression: statement[e.tpos : close.tpos+1],
+			Result:     result,
+			Binding:    d.binding,
+			offset:     e.tpos,
+		})
+		// the steps of the statement are ordered by element and share the
+		// offset of the expression so they follow it once the trace is sorted
+		for _, step := range *steps {
+			step.Depth += depth + 1
+			step.offset = e.tpos
+			*trace = append(*trace, step)
+		}
+	}
+	return result, nil
+}
+
+// evaluateScope evaluates statement once for each element identified by scope
+// with its relative paths bound to the element returning true if it holds for
+// any element. Elements are bound by path rather than by rewriting statement so
+// that map keys are never read as part of the statement. If trace is not nil
+// the steps of each evaluation, ordered as they appear in statement, are
+// appended to it.
+func (d *Diff) evaluateScope(scope, statement string, trace *[]TraceStep) (bool, error) {
+	for _, binding := range d.scopeBindings(scope) {
+		bound := *d
+		bound.binding = binding
+		var steps []TraceStep
+		var result bool
+		var err error
+		if trace != nil {
+			result, err = evaluateTrace(statement, &bound, &steps)
+		} else {
+			result, err = evaluate(statement, &bound)
+		}
+		if err != nil {
+			return false, err
+		}
+		sort.SliceStable(steps, func(i, j int) bool {
+			return steps[i].offset < steps[j].offset
+		})
+		if trace != nil {
+			*trace = append(*trace, steps...)
+		}
+		if result {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// scopeBindings returns the paths of the elements identified by scope: those
+// with a change and those in the Original or New value of the Diff, d, ordered
+// by path.
+func (d *Diff) scopeBindings(scope string) [][]string {
+	path := d.expandIdentifier(scope)
+
+	var bindings [][]string
+	seen := make(map[string]bool)
+	add := func(p []string) {
+		// path components may hold any character so are joined by NUL
+		key := strings.Join(p, "\x00")
+		if !seen[key] {
+			seen[key] = true
+			bindings = append(bindings, appendPath(p))
+		}
+	}
+	for _, c := range d.Changes {
+		if len(c.Path) >= len(path) && wildcardPathMatch(path, c.Path) {
+			add(c.Path[:len(path)])
+		}
+	}
+	for _, v := range []interface{}{d.Original, d.New} {
+		findValues(reflect.ValueOf(v), path, nil, func(p []string, _ reflect.Value) {
+			add(p)
+		})
+	}
+
+	sort.Slice(bindings, func(i, j int) bool {
+		return strings.Join(bindings[i], "\x00") < strings.Join(bindings[j], "\x00")
+	})
+	return bindings
+}
+
+// absoluteIdentifiers returns the identifiers of the EVAL expressions of
+// statement, including the paths of collection expressions, with relative paths
+// resolved against the scope of the enclosing EACH expression.
+func absoluteIdentifiers(statement string) []string {
+	var identifiers []string
+	// scopes holds the scope of each enclosing EACH expression and the depth
+	// of parentheses at which its statement ends
+	type scope struct {
+		path  string
+		depth int
+	}
+	var scopes []scope
+	resolve := func(path string) string {
+		if isRelativePath(path) && len(scopes) > 0 {
+			return bindRelativePath(path, scopes[len(scopes)-1].path)
+		}
+		return path
+	}
+
+	depth := 0
+	l := scopeLexer{newLexer(statement)}
+	for tok := l.next(); tok.ttype != cEOF; tok = l.next() {
+		switch tok.ttype {
+		case cLPAREN:
+			depth++
+		case cRPAREN:
+			depth--
+			if len(scopes) > 0 && scopes[len(scopes)-1].depth > depth {
+				scopes = scopes[:len(scopes)-1]
+			}
+		case cIDENT:
+			identifiers = append(identifiers, resolve(tok.tliteral))
+		case cAGGREGATE:
+			if a, err := parseAggregate(tok.tliteral); err == nil {
+				identifiers = append(identifiers, resolve(a.path))
+			}
+		case cEACH:
+			if l.next().ttype != cLPAREN {
+				continue
+			}
+			depth++
+			if path := l.next(); path.ttype == cIDENT {
+				scopes = append(scopes, scope{path: resolve(path.tliteral), depth: depth})
+			}
+		}
+	}
+	return identifiers
+}
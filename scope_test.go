@@ -0,0 +1,53 @@
+package diffq
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandIdentifierBinding(t *testing.T) {
+	d := &Diff{binding: []string{"M", "a.b c)"}}
+
+	tests := map[string][]string{
+		".":      {"M", "a.b c)"},
+		".NS":    {"M", "a.b c)", "NS"},
+		".NSS.*": {"M", "a.b c)", "NSS", "*"},
+		"S":      {"S"},
+	}
+	for identifier, want := range tests {
+		if got := d.expandIdentifier(identifier); !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect result for %s, got: %v, want: %v", identifier, got, want)
+		}
+	}
+}
+
+func TestScopeBindings(t *testing.T) {
+	a := &OuterType{NTS: []*NestedType{{NSS: []string{"x"}}, {}}, M: map[string]int{"one": 1}}
+	b := &OuterType{NTS: []*NestedType{{}}, M: map[string]int{"two": 2}}
+	d, _ := Differential(a, b)
+
+	tests := map[string][][]string{
+		"NTS.*":       {{"NTS", "0"}, {"NTS", "1"}},
+		"NTS.*.NSS.*": {{"NTS", "0", "NSS", "0"}},
+		"M.*":         {{"M", "one"}, {"M", "two"}},
+		"SS.*":        nil,
+	}
+	for scope, want := range tests {
+		if got := d.scopeBindings(scope); !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect result for %s, got: %v, want: %v", scope, got, want)
+		}
+	}
+}
+
+func TestAbsoluteIdentifiers(t *testing.T) {
+	tests := map[string][]string{
+		`EVAL(S => 1)`: {"S"},
+		`AND(EACH(NTS.*, AND(EVAL(.NS => 1), EVAL(COUNT(.NSS, *) => 1))), EVAL(.I => 1))`: {"NTS.*.NS", "NTS.*.NSS", ".I"},
+		`EACH(NTS.*, EACH(.NSS.*, EVAL(. => "a")))`:                                       {"NTS.*.NSS.*"},
+	}
+	for statement, want := range tests {
+		if got := absoluteIdentifiers(statement); !reflect.DeepEqual(got, want) {
+			t.Errorf("incorrect result for %s, got: %v, want: %v", statement, got, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package diffq
+
+import (
+	"strings"
+
+	"github.com/spf13/cast"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Modifiers of string literals. A string literal may be prefixed by any of the
+// modifiers, each at most once, e.g. i"done" or is"done", changing how both the
+// literal and the values it is compared to are read:
+//
+//	i: case is ignored using Unicode case folding
+//	s: surrounding whitespace is ignored
+//	n: values are compared in Unicode normalization form NFC
+const stringModifiers = "isn"
+
+// parseStringModifiers returns the modifiers s, the letters preceding the
+// opening quote of a string literal, in canonical order, or false if s holds
+// any other letter or a modifier more than once.
+func parseStringModifiers(s string) (string, bool) {
+	if s == "" {
+		return "", false
+	}
+	for i, r := range s {
+		if !strings.ContainsRune(stringModifiers, r) || strings.ContainsRune(s[i+1:], r) {
+			return "", false
+		}
+	}
+	var mods strings.Builder
+	for _, r := range stringModifiers {
+		if strings.ContainsRune(s, r) {
+			mods.WriteRune(r)
+		}
+	}
+	return mods.String(), true
+}
+
+// normalizeString returns s as read by the string modifiers mods.
+func normalizeString(s, mods string) string {
+	if strings.ContainsRune(mods, 's') {
+		s = strings.TrimSpace(s)
+	}
+	if strings.ContainsRune(mods, 'n') {
+		s = norm.NFC.String(s)
+	}
+	if strings.ContainsRune(mods, 'i') {
+		s = cases.Fold().String(s)
+	}
+	return s
+}
+
+// compareString compares the value v to the STRING literal tok, both read by
+// the modifiers of the literal, returning -1, 0 or 1 and true, or false if v
+// cannot be converted to a string.
+func compareString(v interface{}, tok *token) (int, bool) {
+	if tok.ttype != cSTRING {
+		return 0, false
+	}
+	s, err := cast.ToStringE(v)
+	if err != nil {
+		return 0, false
+	}
+	return strings.Compare(normalizeString(s, tok.tmods), normalizeString(tok.tliteral, tok.tmods)), true
+}
+
+// matchString reports whether the value v satisfies the string operator op,
+// =STARTSWITH>, =ENDSWITH> or =CONTAINS>, given the STRING literal tok. Both are
+// read by the modifiers of the literal.
+func matchString(op tokenType, v interface{}, tok *token) bool {
+	if tok.ttype != cSTRING {
+		return false
+	}
+	s, err := cast.ToStringE(v)
+	if err != nil {
+		return false
+	}
+	s, lit := normalizeString(s, tok.tmods), normalizeString(tok.tliteral, tok.tmods)
+	switch op {
+	case cSTARTSWITH:
+		return strings.HasPrefix(s, lit)
+	case cENDSWITH:
+		return strings.HasSuffix(s, lit)
+	case cCONTAINS:
+		return strings.Contains(s, lit)
+	}
+	return false
+}
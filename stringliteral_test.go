@@ -0,0 +1,82 @@
+package diffq
+
+import "testing"
+
+func TestParseStringModifiers(t *testing.T) {
+	tests := map[string]string{
+		"i":   "i",
+		"s":   "s",
+		"n":   "n",
+		"si":  "is",
+		"nsi": "isn",
+		"in":  "in",
+	}
+	for s, want := range tests {
+		got, ok := parseStringModifiers(s)
+		if !ok || got != want {
+			t.Errorf("incorrect result for %s, got: %s %t, want: %s", s, got, ok, want)
+		}
+	}
+
+	for _, s := range []string{"", "ii", "x", "is_", "d", "t", "isni"} {
+		if _, ok := parseStringModifiers(s); ok {
+			t.Errorf("expected %s to be rejected", s)
+		}
+	}
+}
+
+func TestCompareString(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		tok   *token
+		want  int
+		ok    bool
+	}{
+		{"Done", &token{ttype: cSTRING, tliteral: "Done"}, 0, true},
+		{"done", &token{ttype: cSTRING, tliteral: "Done"}, 1, true},
+		{"DONE", &token{ttype: cSTRING, tliteral: "done", tmods: "i"}, 0, true},
+		{"Straße", &token{ttype: cSTRING, tliteral: "STRASSE", tmods: "i"}, 0, true},
+		{" done\t", &token{ttype: cSTRING, tliteral: "done"}, -1, true},
+		{" done\t", &token{ttype: cSTRING, tliteral: "done", tmods: "s"}, 0, true},
+		{" DONE ", &token{ttype: cSTRING, tliteral: "done", tmods: "is"}, 0, true},
+		{"cafe\u0301", &token{ttype: cSTRING, tliteral: "café"}, -1, true},
+		{"cafe\u0301", &token{ttype: cSTRING, tliteral: "café", tmods: "n"}, 0, true},
+		{"CAFE\u0301", &token{ttype: cSTRING, tliteral: "café", tmods: "in"}, 0, true},
+		{42, &token{ttype: cSTRING, tliteral: "42"}, 0, true},
+		{[]string{"a"}, &token{ttype: cSTRING, tliteral: "a"}, 0, false},
+		{"a", &token{ttype: cINT, tliteral: "1"}, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := compareString(test.value, test.tok)
+		if got != test.want || ok != test.ok {
+			t.Errorf("incorrect result for %v and %s, got: %d %t, want: %d %t", test.value, formatToken(test.tok), got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestMatchString(t *testing.T) {
+	tests := []struct {
+		op    tokenType
+		value interface{}
+		tok   *token
+		want  bool
+	}{
+		{cSTARTSWITH, "ERR-1024", &token{ttype: cSTRING, tliteral: "ERR-"}, true},
+		{cSTARTSWITH, "err-1024", &token{ttype: cSTRING, tliteral: "ERR-"}, false},
+		{cSTARTSWITH, "err-1024", &token{ttype: cSTRING, tliteral: "ERR-", tmods: "i"}, true},
+		{cSTARTSWITH, "  ERR-1024", &token{ttype: cSTRING, tliteral: "ERR-", tmods: "s"}, true},
+		{cENDSWITH, "report.PDF", &token{ttype: cSTRING, tliteral: ".pdf"}, false},
+		{cENDSWITH, "report.PDF", &token{ttype: cSTRING, tliteral: ".pdf", tmods: "i"}, true},
+		{cCONTAINS, "payment declined", &token{ttype: cSTRING, tliteral: "declined"}, true},
+		{cCONTAINS, "payment declined", &token{ttype: cSTRING, tliteral: "refused"}, false},
+		{cCONTAINS, "re\u0301sume\u0301", &token{ttype: cSTRING, tliteral: "sumé", tmods: "n"}, true},
+		{cCONTAINS, "anything", &token{ttype: cSTRING, tliteral: ""}, true},
+		{cCONTAINS, []int{1}, &token{ttype: cSTRING, tliteral: "1"}, false},
+		{cGOESTO, "a", &token{ttype: cSTRING, tliteral: "a"}, false},
+	}
+	for _, test := range tests {
+		if got := matchString(test.op, test.value, test.tok); got != test.want {
+			t.Errorf("incorrect result for %v %s %s, got: %t, want: %t", test.value, test.op, formatToken(test.tok), got, test.want)
+		}
+	}
+}
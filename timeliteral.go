@@ -0,0 +1,301 @@
+package diffq
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+)
+
+// Functions of time expressions. now() and startOfDay() are relative to the
+// clock of the Diff being evaluated; the granularity functions compare the
+// value and the time they enclose truncated to the unit, e.g. day(now()).
+const (
+	timeNow        = "now"
+	timeStartOfDay = "startOfDay"
+)
+
+// granularities lists the units time expressions may be truncated to.
+var granularities = []string{"year", "month", "day", "hour", "minute", "second"}
+
+// timeLayouts lists the layouts accepted by time literals other than RFC 3339
+// and Unix times. Times without an offset are in the location of the clock.
+var timeLayouts = []string{
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// timeExpr is a parsed time literal or time expression.
+type timeExpr struct {
+	// base is the text of the time literal, i.e. the content of t"...", or
+	// timeNow or timeStartOfDay.
+	base string
+	// relative is true when base is timeNow or timeStartOfDay.
+	relative bool
+	// offset is added to the time of base.
+	offset time.Duration
+	// sign and duration hold the offset as written, e.g. '-' and "24h", so
+	// that it is formatted unchanged.
+	sign     byte
+	duration string
+	// unit is the granularity of comparisons or empty to compare exactly.
+	unit string
+}
+
+// isTimeFunction reports whether name, the identifier at the start of a token,
+// begins a time expression.
+func isTimeFunction(name string) bool {
+	return name == timeNow || name == timeStartOfDay || isGranularity(name)
+}
+
+// isGranularity reports whether name is a unit time expressions may be
+// truncated to.
+func isGranularity(name string) bool {
+	for _, g := range granularities {
+		if g == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeExpr parses the time expression s:
+//
+//	now()
+//	startOfDay() + d"9h"
+//	day(t"2024-01-01")
+//	hour(now() - d"1h")
+func parseTimeExpr(s string) (*timeExpr, error) {
+	s = strings.TrimSpace(s)
+	name, rest := splitTimeFunction(s)
+	if isGranularity(name) {
+		if !strings.HasPrefix(rest, "(") || !strings.HasSuffix(rest, ")") {
+			return nil, errors.Errorf("invalid time expression %s", s)
+		}
+		e, err := parseTimeBase(rest[1 : len(rest)-1])
+		if err != nil {
+			return nil, err
+		}
+		e.unit = name
+		return e, nil
+	}
+	return parseTimeBase(s)
+}
+
+// parseTimeBase parses a time literal or relative time followed by an optional
+// offset.
+func parseTimeBase(s string) (*timeExpr, error) {
+	s = strings.TrimSpace(s)
+	e := &timeExpr{}
+	var rest string
+	name, after := splitTimeFunction(s)
+	switch {
+	case strings.HasPrefix(s, `t"`):
+		value, after, err := readQuoted(s[1:])
+		if err != nil {
+			return nil, errors.Errorf("invalid time expression %s", s)
+		}
+		if _, err := parseTime(value, time.UTC); err != nil {
+			return nil, err
+		}
+		e.base, rest = value, after
+	case (name == timeNow || name == timeStartOfDay) && strings.HasPrefix(after, "()"):
+		e.base, e.relative = name, true
+		rest = after[2:]
+	default:
+		return nil, errors.Errorf("invalid time expression %s", s)
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return e, nil
+	}
+	sign := rest[0]
+	rest = strings.TrimSpace(rest[1:])
+	if (sign != '+' && sign != '-') || !strings.HasPrefix(rest, `d"`) {
+		return nil, errors.Errorf("invalid time expression %s", s)
+	}
+	value, after, err := readQuoted(rest[1:])
+	if err != nil || after != "" {
+		return nil, errors.Errorf("invalid time expression %s", s)
+	}
+	offset, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, errors.Errorf("invalid duration %s in time expression", value)
+	}
+	if sign == '-' {
+		offset = -offset
+	}
+	e.offset, e.sign, e.duration = offset, sign, value
+	return e, nil
+}
+
+// readQuoted returns the value of the double quoted string at the start of s
+// along with the remainder of s.
+func readQuoted(s string) (string, string, error) {
+	l := newLexer(s)
+	if l.ch != '"' {
+		return "", "", errors.Errorf("expected string in %s", s)
+	}
+	value, err := l.readString()
+	if err != nil {
+		return "", "", err
+	}
+	return value, s[l.position:], nil
+}
+
+// splitTimeFunction splits the leading identifier from s.
+func splitTimeFunction(s string) (string, string) {
+	i := 0
+	for i < len(s) && isLetter(rune(s[i])) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// String returns the canonical source form of the time expression e.
+func (e *timeExpr) String() string {
+	var s string
+	if e.relative {
+		s = e.base + "()"
+	} else {
+		s = "t" + strconv.Quote(e.base)
+	}
+	switch {
+	case e.duration != "":
+		s += " " + string(e.sign) + ` d"` + e.duration + `"`
+	case e.offset > 0:
+		s += ` + d"` + e.offset.String() + `"`
+	case e.offset < 0:
+		s += ` - d"` + (-e.offset).String() + `"`
+	}
+	if e.unit != "" {
+		s = e.unit + "(" + s + ")"
+	}
+	return s
+}
+
+// time returns the time of the expression e given the current time now. Times
+// without an offset are in the location of now.
+func (e *timeExpr) time(now time.Time) (time.Time, error) {
+	var t time.Time
+	switch e.base {
+	case timeNow:
+		t = now
+	case timeStartOfDay:
+		t = truncateTime(now, "day", now.Location())
+	default:
+		var err error
+		if t, err = parseTime(e.base, now.Location()); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return t.Add(e.offset), nil
+}
+
+// parseTime parses the content of a time literal: an RFC 3339 time with
+// optional fractional seconds, a date and time without an offset, a date, or a
+// Unix time in seconds written as @1700000000 or @1700000000.5. Times without
+// an offset are in loc.
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	if strings.HasPrefix(s, "@") {
+		parts := strings.SplitN(s[1:], ".", 2)
+		sec, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || parts[0] == "" || parts[0][0] == '+' {
+			return time.Time{}, errors.Errorf("invalid time %s", s)
+		}
+		var nsec int64
+		if len(parts) == 2 {
+			frac := parts[1]
+			if frac == "" || len(frac) > 9 || strings.TrimLeft(frac, "0123456789") != "" {
+				return time.Time{}, errors.Errorf("invalid time %s", s)
+			}
+			nsec, _ = strconv.ParseInt(frac+strings.Repeat("0", 9-len(frac)), 10, 64)
+			if sec < 0 || parts[0] == "-0" {
+				nsec = -nsec
+			}
+		}
+		return time.Unix(sec, nsec).In(loc), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("invalid time %s", s)
+}
+
+// truncateTime returns t in loc truncated to unit.
+func truncateTime(t time.Time, unit string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	y, mo, d := t.Date()
+	h, mi, s := t.Clock()
+	switch unit {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	case "month":
+		return time.Date(y, mo, 1, 0, 0, 0, 0, loc)
+	case "day":
+		return time.Date(y, mo, d, 0, 0, 0, 0, loc)
+	case "hour":
+		return time.Date(y, mo, d, h, 0, 0, 0, loc)
+	case "minute":
+		return time.Date(y, mo, d, h, mi, 0, 0, loc)
+	case "second":
+		return time.Date(y, mo, d, h, mi, s, 0, loc)
+	}
+	return t
+}
+
+// now returns the current time according to the clock of the Diff, d.
+func (d *Diff) now() time.Time {
+	if d.Clock != nil {
+		return d.Clock()
+	}
+	return time.Now()
+}
+
+// compareTime compares the value v to the TIME or TIMEEXPR literal tok
+// returning -1, 0 or 1 and true, or false if v is not a time. When the literal
+// has a granularity both times are truncated to it in the location of the
+// literal before being compared.
+func (d *Diff) compareTime(v interface{}, tok *token) (int, bool) {
+	var e *timeExpr
+	switch tok.ttype {
+	case cTIME:
+		e = &timeExpr{base: tok.tliteral}
+	case cTIMEEXPR:
+		var err error
+		if e, err = parseTimeExpr(tok.tliteral); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	lit, err := e.time(d.now())
+	if err != nil {
+		return 0, false
+	}
+	value, err := cast.ToTimeE(v)
+	if err != nil {
+		return 0, false
+	}
+	if e.unit != "" {
+		lit = truncateTime(lit, e.unit, lit.Location())
+		value = truncateTime(value, e.unit, lit.Location())
+	}
+	switch {
+	case value.Before(lit):
+		return -1, true
+	case value.After(lit):
+		return 1, true
+	}
+	return 0, true
+}
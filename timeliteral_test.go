@@ -0,0 +1,114 @@
+package diffq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	tests := map[string]time.Time{
+		`2024-01-01T12:00:00Z`:           time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		`2024-01-01T12:00:00-04:00`:      time.Date(2024, 1, 1, 16, 0, 0, 0, time.UTC),
+		`2024-01-01T12:00:00.123456789Z`: time.Date(2024, 1, 1, 12, 0, 0, 123456789, time.UTC),
+		`2024-01-01`:                     time.Date(2024, 1, 1, 0, 0, 0, 0, est),
+		`2024-01-01T08:30`:               time.Date(2024, 1, 1, 8, 30, 0, 0, est),
+		`2024-01-01T08:30:15`:            time.Date(2024, 1, 1, 8, 30, 15, 0, est),
+		`2024-01-01T08:30:15.5`:          time.Date(2024, 1, 1, 8, 30, 15, 500000000, est),
+		`@1700000000`:                    time.Unix(1700000000, 0),
+		`@1700000000.25`:                 time.Unix(1700000000, 250000000),
+		`@-1.5`:                          time.Unix(-2, 500000000),
+		`@0`:                             time.Unix(0, 0),
+	}
+	for literal, want := range tests {
+		got, err := parseTime(literal, est)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", literal, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("incorrect result for %s, got: %s, want: %s", literal, got, want)
+		}
+	}
+
+	for _, literal := range []string{``, `2024-13-01`, `2024-01-01 12:00`, `@`, `@+1`, `@1.`, `@1.1234567891`, `@abc`, `yesterday`} {
+		if _, err := parseTime(literal, est); err == nil {
+			t.Errorf("expected error for %s", literal)
+		}
+	}
+}
+
+func TestParseTimeExpr(t *testing.T) {
+	tests := map[string]string{
+		`now()`:                             `now()`,
+		`startOfDay()`:                      `startOfDay()`,
+		`now()-d"24h"`:                      `now() - d"24h"`,
+		`startOfDay() + d"90m"`:             `startOfDay() + d"90m"`,
+		`day( t"2024-01-01" )`:              `day(t"2024-01-01")`,
+		`hour(now() - d"1h")`:               `hour(now() - d"1h")`,
+		`now()+d"0s"`:                       `now() + d"0s"`,
+		`month(t"2024-01-01T00:00:00Z")`:    `month(t"2024-01-01T00:00:00Z")`,
+		`second(t"@1700000000" + d"500ms")`: `second(t"@1700000000" + d"500ms")`,
+	}
+	for expr, want := range tests {
+		e, err := parseTimeExpr(expr)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", expr, err)
+			continue
+		}
+		if got := e.String(); got != want {
+			t.Errorf("incorrect result for %s, got: %s, want: %s", expr, got, want)
+		}
+	}
+
+	for _, expr := range []string{
+		`now`, `now(1)`, `later()`, `day()`, `day(now()`, `week(now())`, `now() * d"1h"`,
+		`now() - "1h"`, `now() - d"1x"`, `now() - d"1h" + d"1h"`, `day(day(now()))`, `day(t"soon")`,
+	} {
+		if _, err := parseTimeExpr(expr); err == nil {
+			t.Errorf("expected error for %s", expr)
+		}
+	}
+}
+
+func TestCompareTime(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	now := time.Date(2024, 3, 10, 15, 30, 0, 0, est)
+	d := &Diff{Clock: func() time.Time { return now }}
+
+	tests := []struct {
+		value interface{}
+		ttype tokenType
+		lit   string
+		want  int
+		ok    bool
+	}{
+		{now, cTIMEEXPR, `now()`, 0, true},
+		{now.Add(-time.Hour), cTIMEEXPR, `now() - d"1h0m0s"`, 0, true},
+		{now.Add(-time.Minute), cTIMEEXPR, `now() - d"1h0m0s"`, 1, true},
+		{time.Date(2024, 3, 10, 0, 0, 0, 0, est), cTIMEEXPR, `startOfDay()`, 0, true},
+		{time.Date(2024, 3, 10, 4, 59, 0, 0, time.UTC), cTIMEEXPR, `startOfDay()`, -1, true},
+		{time.Date(2024, 3, 10, 1, 0, 0, 0, est), cTIMEEXPR, `day(now())`, 0, true},
+		{time.Date(2024, 3, 10, 23, 59, 0, 0, est), cTIMEEXPR, `day(now())`, 0, true},
+		{time.Date(2024, 3, 11, 1, 0, 0, 0, time.UTC), cTIMEEXPR, `day(now())`, 0, true},
+		{time.Date(2024, 3, 11, 6, 0, 0, 0, time.UTC), cTIMEEXPR, `day(now())`, 1, true},
+		{time.Date(2024, 3, 9, 12, 0, 0, 0, est), cTIMEEXPR, `day(now() - d"24h0m0s")`, 0, true},
+		{time.Date(2024, 3, 10, 15, 59, 59, 0, est), cTIMEEXPR, `hour(now())`, 0, true},
+		{time.Date(2024, 3, 10, 16, 0, 0, 0, est), cTIMEEXPR, `hour(now())`, 1, true},
+		{time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), cTIMEEXPR, `day(t"2024-01-01T00:00:00Z")`, 0, true},
+		{time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), cTIMEEXPR, `day(t"2024-01-01T00:00:00-05:00")`, 0, true},
+		{time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC), cTIMEEXPR, `day(t"2024-01-01T00:00:00-05:00")`, 1, true},
+		{time.Date(2024, 12, 31, 0, 0, 0, 0, est), cTIMEEXPR, `year(t"2024-06-01")`, 0, true},
+		{time.Date(2024, 1, 1, 5, 0, 0, 0, time.UTC), cTIME, `2024-01-01`, 0, true},
+		{time.Unix(1700000000, 0), cTIME, `@1700000000`, 0, true},
+		{"2024-01-01T05:00:00Z", cTIME, `2024-01-01`, 0, true},
+		{nil, cTIME, `2024-01-01`, 0, false},
+		{"soon", cTIMEEXPR, `now()`, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := d.compareTime(test.value, &token{ttype: test.ttype, tliteral: test.lit})
+		if got != test.want || ok != test.ok {
+			t.Errorf("incorrect result for %v and %s, got: %d %t, want: %d %t", test.value, test.lit, got, ok, test.want, test.ok)
+		}
+	}
+}
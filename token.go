@@ -15,12 +15,15 @@ const (
 
 	// Identifiers and Literals
 
-	cIDENT    = "IDENT"    // field, field.val, array.0.val
+	cIDENT    = "IDENT"    // field, field.val, array.0.val, .val
 	cINT      = "INT"      // 1343456, -123456
-	cSTRING   = "STRING"   // "foobar"
+	cSTRING   = "STRING"   // "foobar", i"foobar"
 	cFLOAT    = "FLOAT"    // 123.456, -123.456
 	cDURATION = "DURATION" // d"12h30m"
 	cTIME     = "TIME"     // t"2006-01-02T15:04:05+07:00" t"2006-01-02T15:04:05Z" (time.RFC3339)
+	cTIMEEXPR = "TIMEEXPR" // now(), startOfDay() + d"9h", day(t"2024-01-01")
+
+	cAGGREGATE = "AGGREGATE" // LEN(Items), COUNT(Items, $deleted)
 
 	cASTERISK = "*"
 
@@ -36,20 +39,34 @@ const (
 
 	// Keywords
 
-	cTRUE      = "TRUE"
-	cFALSE     = "FALSE"
-	cAND       = "AND"
-	cOR        = "OR"
-	cEVAL      = "EVAL"
-	cGOESTO    = "=>"
-	cNOTGOESTO = "=!>"
-	cGOESGT    = "=GT>"
-	cGOESLT    = "=LT>"
-	cGOESGTE   = "=GTE>"
-	cGOESLTE   = "=LTE>"
-	cNIL       = "NIL"
-	cCREATED   = "$created"
-	cDELETED   = "$deleted"
+	cTRUE       = "TRUE"
+	cFALSE      = "FALSE"
+	cAND        = "AND"
+	cOR         = "OR"
+	cEVAL       = "EVAL"
+	cANYSTEP    = "ANY_STEP"
+	cALLSTEPS   = "ALL_STEPS"
+	cEVENTUALLY = "EVENTUALLY"
+	cREF        = "REF"
+	cANY        = "ANY"
+	cALL        = "ALL"
+	cNONE       = "NONE"
+	cEACH       = "EACH"
+	cGOESTO     = "=>"
+	cNOTGOESTO  = "=!>"
+	cGOESGT     = "=GT>"
+	cGOESLT     = "=LT>"
+	cGOESGTE    = "=GTE>"
+	cGOESLTE    = "=LTE>"
+	cSTARTSWITH = "=STARTSWITH>"
+	cENDSWITH   = "=ENDSWITH>"
+	cCONTAINS   = "=CONTAINS>"
+	cNIL        = "NIL"
+	cCREATED    = "$created"
+	cDELETED    = "$deleted"
+	cUPDATED    = "$updated"
+	cMOVED      = "$moved"
+	cCONFLICT   = "$conflict"
 )
 
 // token represents the output of the lexer representing each component of the
@@ -59,6 +76,14 @@ type token struct {
 	ttype tokenType
 	// tliteral represents the actual value parsed by the lexer
 	tliteral string
+	// tpos represents the offset of the start of the token in the input
+	tpos int
+	// traw is true for a string delimited by '`' rather than '"'
+	traw bool
+	// tmods holds the modifiers of a string in canonical order, e.g. "is"
+	tmods string
+	// terr describes why an ILLEGAL token could not be read, if known
+	terr error
 }
 
 // String returns a human readable string format of token.
@@ -80,6 +105,26 @@ var keywords = map[string]tokenType{
 	"AND":   cAND,
 	"EVAL":  cEVAL,
 
+	"any_step":   cANYSTEP,
+	"all_steps":  cALLSTEPS,
+	"eventually": cEVENTUALLY,
+	"ANY_STEP":   cANYSTEP,
+	"ALL_STEPS":  cALLSTEPS,
+	"EVENTUALLY": cEVENTUALLY,
+
+	"ref": cREF,
+	"REF": cREF,
+
+	"any":  cANY,
+	"all":  cALL,
+	"none": cNONE,
+	"ANY":  cANY,
+	"ALL":  cALL,
+	"NONE": cNONE,
+
+	"each": cEACH,
+	"EACH": cEACH,
+
 	"=>":    cGOESTO,
 	"=!>":   cNOTGOESTO,
 	"=gt>":  cGOESGT,
@@ -91,6 +136,13 @@ var keywords = map[string]tokenType{
 	"=GTE>": cGOESGTE,
 	"=LTE>": cGOESLTE,
 
+	"=startswith>": cSTARTSWITH,
+	"=endswith>":   cENDSWITH,
+	"=contains>":   cCONTAINS,
+	"=STARTSWITH>": cSTARTSWITH,
+	"=ENDSWITH>":   cENDSWITH,
+	"=CONTAINS>":   cCONTAINS,
+
 	"nil": cNIL,
 	"NIL": cNIL,
 
@@ -98,6 +150,13 @@ var keywords = map[string]tokenType{
 	"$deleted": cDELETED,
 	"$CREATED": cCREATED,
 	"$DELETED": cDELETED,
+	"$updated": cUPDATED,
+	"$moved":   cMOVED,
+	"$UPDATED": cUPDATED,
+	"$MOVED":   cMOVED,
+
+	"$conflict": cCONFLICT,
+	"$CONFLICT": cCONFLICT,
 }
 
 // lookupIdent first checks for and returns a matching keyword otherwise returns